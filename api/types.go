@@ -6,27 +6,335 @@ type ShellRunRequest struct {
     Env       map[string]string `json:"env,omitempty"`
     TimeoutMS int64             `json:"timeout_ms,omitempty"`
     StdinB64  string            `json:"stdin,omitempty"`
+    // PTYID runs the command with the cwd and environment of the session's
+    // foreground process. Explicit Cwd and Env entries take precedence.
+    PTYID string `json:"pty_id,omitempty"`
+    // Output caps; zero max_* fields use the server default.
+    MaxStdoutBytes int64 `json:"max_stdout_bytes,omitempty"`
+    MaxStderrBytes int64 `json:"max_stderr_bytes,omitempty"`
+    KeepTail       bool  `json:"keep_tail,omitempty"`        // keep head and tail instead of head only
+    KillAfterBytes int64 `json:"kill_after_bytes,omitempty"` // kill once combined output exceeds this
+    // KillGraceMS is the SIGTERM to SIGKILL delay for the process group; 0 uses the server default.
+    KillGraceMS int64 `json:"kill_grace_ms,omitempty"`
+    // Pipeline runs argv stages connected by pipes, instead of Argv. Stdin
+    // feeds the first stage; Cwd and Env are defaults for every stage.
+    Pipeline []PipelineStage `json:"pipeline,omitempty"`
+    // EnvPolicy narrows the server's environment policy (see envpolicy.Restrict).
+    EnvPolicy *EnvPolicy `json:"env_policy,omitempty"`
+    // Track snapshots these roots before and after the run and reports changes.
+    Track *FSTrackRequest `json:"track,omitempty"`
+    // Collect returns files matching these globs (relative to cwd, "**" allowed)
+    // after the run: inline while collect_inline_bytes lasts (0 = 1 MiB,
+    // negative = never), as downloadable artifacts otherwise.
+    Collect            []string `json:"collect,omitempty"`
+    CollectInlineBytes int64    `json:"collect_inline_bytes,omitempty"`
+    // SpillBytes moves stdout/stderr larger than this into artifacts
+    // (0 = server default, negative = never).
+    SpillBytes int64 `json:"spill_bytes,omitempty"`
+    // Cache opts into memoization of deterministic commands.
+    Cache *ShellRunCache `json:"cache,omitempty"`
+    // Parsers extract diagnostics from stdout and stderr: gcc (also clang),
+    // go (build/vet), gotest (go test -json), junit (XML), python (tracebacks).
+    Parsers []string `json:"parsers,omitempty"`
+    // Retry reruns a failing command; the response describes the last attempt
+    // and lists every attempt.
+    Retry *ShellRunRetry `json:"retry,omitempty"`
+    // TTY runs argv on a pseudo-terminal of rows x cols (default 24x80)
+    // instead of pipes: stdout carries the combined terminal output, stdin is
+    // typed in followed by Ctrl-D, and screen asks for the rendered final screen.
+    // Rows and cols are at most 65535, or 1000 with screen.
+    TTY    bool `json:"tty,omitempty"`
+    Rows   int  `json:"rows,omitempty"`
+    Cols   int  `json:"cols,omitempty"`
+    Screen bool `json:"screen,omitempty"`
 }
 
-type ShellRunResponse struct {
-    RC         int    `json:"rc"`
-    StdoutB64  string `json:"stdout"`
-    StderrB64  string `json:"stderr"`
-    DurationMS int64  `json:"duration_ms"`
-    Cwd        string `json:"cwd"`
+// ShellRunRetry selects which failures are retried and how long to wait
+// between attempts. Without on_exit_codes or stderr_regex every non-zero
+// rc (including a timeout) is retried; with them, a failure matching either.
+type ShellRunRetry struct {
+    MaxAttempts  int      `json:"max_attempts,omitempty"`   // including the first; default 3, max 20
+    BackoffMS    int64    `json:"backoff_ms,omitempty"`     // delay before the second attempt, doubled after each; default 200
+    MaxBackoffMS int64    `json:"max_backoff_ms,omitempty"` // default 10000
+    Jitter       *float64 `json:"jitter,omitempty"`         // each delay varies by up to this fraction, 0-1; default 0.2
+    OnExitCodes  []int    `json:"on_exit_codes,omitempty"`
+    StderrRegex  string   `json:"stderr_regex,omitempty"`
+    // AttemptTimeoutMS replaces timeout_ms for each attempt.
+    AttemptTimeoutMS int64 `json:"attempt_timeout_ms,omitempty"`
+}
+
+// ShellRunAttempt summarizes one try; output keeps the last 4 KiB of each stream.
+type ShellRunAttempt struct {
+    Attempt         int         `json:"attempt"` // 1-based
+    RC              int         `json:"rc"`
+    Signal          *ExitSignal `json:"signal,omitempty"`
+    TimedOut        bool        `json:"timed_out,omitempty"`
+    DurationMS      int64       `json:"duration_ms"`
+    StdoutB64       string      `json:"stdout"`
+    StderrB64       string      `json:"stderr"`
+    StdoutTruncated bool        `json:"stdout_truncated,omitempty"`
+    StderrTruncated bool        `json:"stderr_truncated,omitempty"`
+    Retried         bool        `json:"retried"`              // another attempt followed
+    BackoffMS       int64       `json:"backoff_ms,omitempty"` // delay before the next attempt
+    Error           string      `json:"error,omitempty"`
+}
+
+// Diagnostic is a located compiler, linter or test message.
+type Diagnostic struct {
+    File     string `json:"file,omitempty"`
+    Line     int    `json:"line,omitempty"`
+    Column   int    `json:"column,omitempty"`
+    Severity string `json:"severity"` // error|warning|note
+    Message  string `json:"message"`
+    Tool     string `json:"tool"` // parser that produced it
+}
+
+// ShellRunCache keys a result on argv (or pipeline), the effective env, cwd,
+// stdin, the output options and the content of Inputs.
+type ShellRunCache struct {
+    Inputs []string `json:"inputs,omitempty"` // files the command reads, relative to cwd
+    TTLMS  int64    `json:"ttl_ms,omitempty"` // 0 = server default
+}
+
+type CacheStatsResponse struct {
+    Entries    int   `json:"entries"`
+    Bytes      int64 `json:"bytes"`
+    MaxEntries int   `json:"max_entries"`
+    MaxBytes   int64 `json:"max_bytes"`
+    Hits       int64 `json:"hits"`
+    Misses     int64 `json:"misses"`
+    Evictions  int64 `json:"evictions"`
+}
+
+type CachePurgeRequest struct {
+    Key string `json:"key,omitempty"` // cache_key (or prefix) to drop; empty purges everything
+}
+
+type CachePurgeResponse struct {
+    Purged int `json:"purged"`
+}
+
+// CollectedFile is one file gathered by collect: either data or artifact_id is set.
+type CollectedFile struct {
+    Path       string `json:"path"` // relative to cwd
+    Size       int64  `json:"size"`
+    Mode       string `json:"mode"`
+    SHA256     string `json:"sha256,omitempty"`
+    DataB64    string `json:"data,omitempty"`
+    ArtifactID string `json:"artifact_id,omitempty"` // fetch with /v1/artifacts/get
     Error      string `json:"error,omitempty"`
 }
 
-type PTYOpenRequest struct {
+// ArtifactGetRequest selects an artifact and optionally a byte range; a
+// Range header is honoured as well (GET /v1/artifacts/get?id=... also works).
+type ArtifactGetRequest struct {
+    ID     string `json:"id"`
+    Offset int64  `json:"offset,omitempty"`
+    Length int64  `json:"length,omitempty"` // 0 = to the end
+}
+
+type ArtifactStatRequest struct {
+    ID string `json:"id"`
+}
+
+type ArtifactInfo struct {
+    ID         string   `json:"id"` // sha256 of the content
+    Size       int64    `json:"size"`
+    CreatedMS  int64    `json:"created_ms"`
+    AccessedMS int64    `json:"accessed_ms"`
+    Refs       []string `json:"refs"` // owners such as "job:<id>" or "pty:<id>"; referenced artifacts are never collected
+}
+
+type ArtifactListResponse struct {
+    Artifacts  []ArtifactInfo `json:"artifacts"` // newest first
+    TotalBytes int64          `json:"total_bytes"`
+    MaxBytes   int64          `json:"max_bytes"` // unreferenced artifacts are collected above this
+}
+
+type ArtifactDeleteRequest struct {
+    ID    string `json:"id"`
+    Force bool   `json:"force,omitempty"` // delete even if referenced
+}
+
+type FSTrackRequest struct {
+    Roots    []string `json:"roots"`               // relative to cwd unless absolute
+    Ignore   []string `json:"ignore,omitempty"`    // globs on base names or root-relative paths, e.g. ".git", "*.o"
+    Hash     bool     `json:"hash,omitempty"`      // compare sha256 as well as size/mtime/mode
+    MaxFiles int      `json:"max_files,omitempty"` // default 10000
+}
+
+type FSChange struct {
+    Path    string `json:"path"`
+    Size    int64  `json:"size"`
+    MtimeMS int64  `json:"mtime_ms"`
+    Mode    string `json:"mode"`
+    SHA256  string `json:"sha256,omitempty"`
+}
+
+type FSChanges struct {
+    Created   []FSChange `json:"created"`
+    Modified  []FSChange `json:"modified"`
+    Deleted   []FSChange `json:"deleted"` // state before the run
+    Truncated bool       `json:"truncated,omitempty"`
+    Error     string     `json:"error,omitempty"` // the post-run scan failed
+}
+
+// EnvPolicy controls which variables a process inherits from the daemon.
+// Layers: inherited (per mode/allow) and files, minus deny, then presets,
+// then the request's env.
+type EnvPolicy struct {
+    Mode    string   `json:"mode,omitempty"`    // empty|inherit|allowlist
+    Allow   []string `json:"allow,omitempty"`   // names, or prefixes ending in "*"
+    Deny    []string `json:"deny,omitempty"`    // glob patterns, e.g. "*_TOKEN"
+    Files   []string `json:"files,omitempty"`   // .env files on the server
+    Presets []string `json:"presets,omitempty"` // deterministic|locale|utc|no_color
+}
+
+type PipelineStage struct {
     Argv []string          `json:"argv"`
-    Rows int               `json:"rows,omitempty"`
-    Cols int               `json:"cols,omitempty"`
     Cwd  string            `json:"cwd,omitempty"`
     Env  map[string]string `json:"env,omitempty"`
 }
 
+type PipelineStageResult struct {
+    Argv            []string      `json:"argv"`
+    RC              int           `json:"rc"`
+    Signal          *ExitSignal   `json:"signal,omitempty"`
+    CoreDumped      bool          `json:"core_dumped,omitempty"`
+    StderrB64       string        `json:"stderr"`
+    StderrBytes     int64         `json:"stderr_bytes"`
+    StderrTruncated bool          `json:"stderr_truncated"`
+    Usage           *ProcessUsage `json:"usage,omitempty"`
+}
+
+// ShellRunContext identifies the process a pty_id run borrowed its context from.
+type ShellRunContext struct {
+    PTYID string `json:"pty_id"`
+    PID   int    `json:"pid"`
+    Comm  string `json:"comm,omitempty"`
+    Cwd   string `json:"cwd"`
+}
+
+// ExitSignal names the signal that terminated a process.
+type ExitSignal struct {
+    Name   string `json:"name"`   // e.g. "SIGSEGV"
+    Number int    `json:"number"` // rc is 128+number
+}
+
+type ShellRunResponse struct {
+    RC         int              `json:"rc"` // 128+signo when killed by a signal
+    Signal     *ExitSignal      `json:"signal,omitempty"`
+    CoreDumped bool             `json:"core_dumped,omitempty"`
+    TimedOut   bool             `json:"timed_out,omitempty"`
+    StdoutB64  string           `json:"stdout"`
+    StderrB64  string           `json:"stderr"`
+    DurationMS int64            `json:"duration_ms"`
+    Cwd        string           `json:"cwd"`
+    Context    *ShellRunContext `json:"context,omitempty"`
+    // Totals count every byte written; the *_truncated flags mark dropped output.
+    StdoutBytes     int64         `json:"stdout_bytes"`
+    StderrBytes     int64         `json:"stderr_bytes"`
+    StdoutTruncated bool          `json:"stdout_truncated"`
+    StderrTruncated bool          `json:"stderr_truncated"`
+    LimitExceeded   bool          `json:"limit_exceeded,omitempty"`
+    Usage           *ProcessUsage `json:"usage,omitempty"`
+    // Stages reports each pipeline stage; rc is then the rightmost failing stage's (pipefail).
+    Stages []PipelineStageResult `json:"stages,omitempty"`
+    // Set instead of stdout/stderr when the output was spilled to an artifact.
+    StdoutArtifactID string `json:"stdout_artifact_id,omitempty"`
+    StderrArtifactID string `json:"stderr_artifact_id,omitempty"`
+    // EnvKeys lists the names of the effective environment (values are never echoed).
+    EnvKeys            []string        `json:"env_keys,omitempty"`
+    Changes            *FSChanges      `json:"changes,omitempty"` // set when track was requested
+    Collected          []CollectedFile `json:"collected,omitempty"`
+    CollectedTruncated bool            `json:"collected_truncated,omitempty"` // more files matched than are returned, or the search stopped early
+    Diagnostics        []Diagnostic    `json:"diagnostics,omitempty"` // set when parsers were requested
+    // Cached marks a memoized result; cache_key identifies it for purging.
+    Cached   bool   `json:"cached,omitempty"`
+    CacheKey string `json:"cache_key,omitempty"`
+    // Attempts lists every try, oldest first, when retry was requested.
+    Attempts []ShellRunAttempt `json:"attempts,omitempty"`
+    // Screen is the rendered terminal of a tty run, when requested.
+    Screen string `json:"screen,omitempty"`
+    // Redactions counts replaced matches per rule ("secret" for stored secrets).
+    Redactions map[string]int `json:"redactions,omitempty"`
+    Error      string         `json:"error,omitempty"`
+}
+
+// ProcessUsage is the resource consumption of a process tree.
+type ProcessUsage struct {
+    CPUMS            int64 `json:"cpu_ms"`
+    UserCPUMS        int64 `json:"user_cpu_ms"`
+    SysCPUMS         int64 `json:"sys_cpu_ms"`
+    MaxRSSKB         int64 `json:"max_rss_kb"`
+    MinorFaults      int64 `json:"minor_faults"`
+    MajorFaults      int64 `json:"major_faults"`
+    VolCtxSwitches   int64 `json:"vol_ctx_switches"`
+    InvolCtxSwitches int64 `json:"invol_ctx_switches"`
+    Procs            int   `json:"procs,omitempty"` // live processes sampled
+}
+
+// ShellBatchRequest runs many shell.run requests concurrently.
+type ShellBatchRequest struct {
+    Commands      []ShellRunRequest `json:"commands"`
+    MaxParallel   int               `json:"max_parallel,omitempty"`    // default 4
+    StopOnFailure bool              `json:"stop_on_failure,omitempty"` // skip commands not yet started after a failure
+    DeadlineMS    int64             `json:"deadline_ms,omitempty"`     // total budget; running commands are killed at the deadline
+}
+
+// ShellBatchResult is a shell.run result; Skipped marks commands never started.
+type ShellBatchResult struct {
+    ShellRunResponse
+    Skipped bool `json:"skipped,omitempty"`
+}
+
+type ShellBatchResponse struct {
+    Results    []ShellBatchResult `json:"results"` // in request order
+    Failed     int                `json:"failed"`
+    Skipped    int                `json:"skipped"`
+    DurationMS int64              `json:"duration_ms"`
+}
+
+type PTYOpenRequest struct {
+    Argv   []string          `json:"argv"`
+    Rows   int               `json:"rows,omitempty"`
+    Cols   int               `json:"cols,omitempty"`
+    Cwd    string            `json:"cwd,omitempty"`
+    Env    map[string]string `json:"env,omitempty"`
+    Labels map[string]string `json:"labels,omitempty"`
+    // Responders auto-answer prompts; see PTYResponder.
+    Responders []PTYResponder `json:"responders,omitempty"`
+    EnvPolicy  *EnvPolicy     `json:"env_policy,omitempty"`
+}
+
+// PTYResponder answers output matching Pattern by writing Response to the PTY.
+type PTYResponder struct {
+    ID       string `json:"id,omitempty"`
+    Pattern  string `json:"pattern"`
+    Response string `json:"response"` // {{secret:NAME}} is expanded when the rule fires
+    Once     bool   `json:"once,omitempty"`
+    MaxCount int    `json:"max_count,omitempty"`
+    DelayMS  int64  `json:"delay_ms,omitempty"`
+    // status, set in responses
+    Fired     int  `json:"fired,omitempty"`
+    Exhausted bool `json:"exhausted,omitempty"`
+}
+
+type PTYRespondersRequest struct {
+    ID     string         `json:"id"`
+    Action string         `json:"action,omitempty"` // list (default), add, remove
+    Rules  []PTYResponder `json:"rules,omitempty"`  // add
+    IDs    []string       `json:"ids,omitempty"`    // remove; empty removes all
+}
+
+type PTYRespondersResponse struct {
+    Rules []PTYResponder `json:"rules"`
+    Added []string       `json:"added,omitempty"`
+}
+
 type PTYOpenResponse struct {
-    ID string `json:"id"`
+    ID      string   `json:"id"`
+    EnvKeys []string `json:"env_keys,omitempty"`
 }
 
 type PTYSendRequest struct {
@@ -43,6 +351,8 @@ type PTYReadRequest struct {
     SinceSeq  uint64 `json:"since_seq,omitempty"`
     MaxBytes  int    `json:"max_bytes,omitempty"`
     TimeoutMS int64  `json:"timeout_ms,omitempty"`
+    // Redact applies the redaction filters to returned chunks; nil uses the server default.
+    Redact *bool `json:"redact,omitempty"`
 }
 
 type PTYChunk struct {
@@ -53,7 +363,30 @@ type PTYChunk struct {
 }
 
 type PTYReadResponse struct {
-    Chunks []PTYChunk `json:"chunks"`
+    Chunks     []PTYChunk     `json:"chunks"`
+    Closed     bool           `json:"closed"`
+    Redactions map[string]int `json:"redactions,omitempty"`
+}
+
+type PTYEventsRequest struct {
+    ID        string `json:"id"`
+    SinceSeq  uint64 `json:"since_seq,omitempty"`
+    TimeoutMS int64  `json:"timeout_ms,omitempty"`
+}
+
+type PTYEvent struct {
+    Seq      uint64 `json:"seq"`
+    ChunkSeq uint64 `json:"chunk_seq"` // PTYChunk.Seq the event was parsed from
+    Ts       int64  `json:"ts_ms"`
+    Kind     string `json:"kind"` // title|cwd|prompt_start|command_start|command_executed|command_finished|bell|responder
+    Value    string `json:"value,omitempty"`
+    ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+type PTYEventsResponse struct {
+    Events []PTYEvent `json:"events"`
+    Title  string     `json:"title,omitempty"`
+    Cwd    string     `json:"cwd,omitempty"`
     Closed bool       `json:"closed"`
 }
 
@@ -65,6 +398,132 @@ type PTYResizeRequest struct {
 
 type PTYCloseRequest struct {
     ID string `json:"id"`
+    // SpillBytes stores a larger session log as an artifact, as in shell.run.
+    SpillBytes int64 `json:"spill_bytes,omitempty"`
+}
+
+type PTYUsageRequest struct {
+    ID string `json:"id"`
+}
+
+type PTYUsageResponse struct {
+    Usage ProcessUsage `json:"usage"`
+    Live  bool         `json:"live"` // sampled from /proc; false once the process has exited
+}
+
+type PTYStatusRequest struct {
+    ID string `json:"id"`
+}
+
+type PTYStatusResponse struct {
+    ID          string      `json:"id"`
+    PID         int         `json:"pid"`
+    Argv        []string    `json:"argv"`
+    Running     bool        `json:"running"`
+    RC          *int        `json:"rc,omitempty"` // set once exited; 128+signo when killed by a signal
+    Signal      *ExitSignal `json:"signal,omitempty"`
+    CoreDumped  bool        `json:"core_dumped,omitempty"`
+    StartedAtMS int64       `json:"started_at_ms"`
+    EndedAtMS   int64       `json:"ended_at_ms,omitempty"`
+}
+
+type PTYHistoryRequest struct {
+    ID       string            `json:"id,omitempty"`
+    Command  string            `json:"command,omitempty"`
+    Labels   map[string]string `json:"labels,omitempty"`
+    SinceMS  int64             `json:"since_ms,omitempty"` // started at or after (unix ms)
+    UntilMS  int64             `json:"until_ms,omitempty"` // started before (unix ms)
+    ExitCode *int              `json:"exit_code,omitempty"`
+    Limit    int               `json:"limit,omitempty"`
+}
+
+type PTYHistoryEntry struct {
+    ID          string            `json:"id"`
+    Argv        []string          `json:"argv"`
+    Cwd         string            `json:"cwd,omitempty"`
+    Labels      map[string]string `json:"labels,omitempty"`
+    StartedAtMS int64             `json:"started_at_ms"`
+    EndedAtMS   int64             `json:"ended_at_ms"`
+    ExitCode    *int              `json:"exit_code,omitempty"`
+    Signal      string            `json:"signal,omitempty"`
+    SignalNum   int               `json:"signal_number,omitempty"`
+    CoreDumped  bool              `json:"core_dumped,omitempty"`
+    BytesIn     int64             `json:"bytes_in"`
+    BytesOut    int64             `json:"bytes_out"`
+    CPUMS       int64             `json:"cpu_ms,omitempty"`
+    MaxRSSKB    int64             `json:"max_rss_kb,omitempty"`
+    LogPath     string            `json:"log_path,omitempty"`
+}
+
+type PTYHistoryResponse struct {
+    Sessions []PTYHistoryEntry `json:"sessions"`
+}
+
+// JobStartRequest takes the same fields as shell.run.
+type JobStartRequest struct {
+    ShellRunRequest
+}
+
+type JobStartResponse struct {
+    ID string `json:"id"`
+}
+
+type JobReadRequest struct {
+    ID        string `json:"id"`
+    SinceSeq  uint64 `json:"since_seq,omitempty"`
+    MaxBytes  int    `json:"max_bytes,omitempty"`
+    TimeoutMS int64  `json:"timeout_ms,omitempty"`
+    // Parsers extract diagnostics from all output retained so far, not just
+    // this read's chunks (see ShellRunRequest).
+    Parsers []string `json:"parsers,omitempty"`
+}
+
+type JobReadResponse struct {
+    Chunks      []PTYChunk     `json:"chunks"` // stream is "stdout" or "stderr"
+    Done        bool           `json:"done"`   // job finished and all output returned
+    Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`
+    Redactions  map[string]int `json:"redactions,omitempty"`
+}
+
+type JobWaitRequest struct {
+    ID        string `json:"id"`
+    TimeoutMS int64  `json:"timeout_ms,omitempty"` // 0 waits until the job finishes
+    // Parsers extract diagnostics from the job's output, spilled or retained.
+    Parsers []string `json:"parsers,omitempty"`
+}
+
+type JobCancelRequest struct {
+    ID string `json:"id"`
+}
+
+type JobStatus struct {
+    ID          string        `json:"id"`
+    Argv        []string      `json:"argv"`
+    Cwd         string        `json:"cwd"`
+    State       string        `json:"state"` // running|exited|timeout|canceled|failed
+    Done        bool          `json:"done"`
+    RC          int           `json:"rc"`
+    Signal      *ExitSignal   `json:"signal,omitempty"`
+    CoreDumped  bool          `json:"core_dumped,omitempty"`
+    StartedAtMS int64         `json:"started_at_ms"`
+    DurationMS  int64         `json:"duration_ms"`
+    Error       string        `json:"error,omitempty"`
+    Usage       *ProcessUsage `json:"usage,omitempty"`
+    // Output totals and caps as in shell.run; set once the job has finished.
+    StdoutBytes     int64 `json:"stdout_bytes,omitempty"`
+    StderrBytes     int64 `json:"stderr_bytes,omitempty"`
+    StdoutTruncated bool  `json:"stdout_truncated,omitempty"`
+    StderrTruncated bool  `json:"stderr_truncated,omitempty"`
+    LimitExceeded   bool  `json:"limit_exceeded,omitempty"`
+    // Output of finished jobs that wrote more than the spill threshold.
+    StdoutArtifactID string `json:"stdout_artifact_id,omitempty"`
+    StderrArtifactID string `json:"stderr_artifact_id,omitempty"`
+    // Set by jobs/wait when parsers were requested.
+    Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+type JobListResponse struct {
+    Jobs []JobStatus `json:"jobs"`
 }
 
 type FSReadRequest struct {
@@ -131,3 +590,164 @@ type BridgeTmuxEntry struct {
 type BridgeTmuxListResponse struct {
     Bridges []BridgeTmuxEntry `json:"bridges"`
 }
+
+type SecretSetRequest struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+type SecretDeleteRequest struct {
+    Name string `json:"name"`
+}
+
+// SecretListResponse carries names only; values never leave the daemon.
+type SecretListResponse struct {
+    Names []string `json:"names"`
+}
+
+// ScheduleSpec runs a shell.run payload on a cron expression, a fixed
+// interval, changes to watched paths, or any combination.
+type ScheduleSpec struct {
+    Name         string          `json:"name,omitempty"`
+    Cron         string          `json:"cron,omitempty"`          // "*/5 * * * *" or @hourly etc., server local time
+    IntervalMS   int64           `json:"interval_ms,omitempty"`   // first run one interval after creation
+    Watch        []string        `json:"watch,omitempty"`         // files or directories (relative to run.cwd); a change in mtime, size or presence triggers a run
+    WatchPollMS  int64           `json:"watch_poll_ms,omitempty"` // default 1000
+    HistoryLimit int             `json:"history_limit,omitempty"` // results kept, default 20 (max 200, and at most 8 MiB of output)
+    Paused       bool            `json:"paused,omitempty"`
+    Run          ShellRunRequest `json:"run"`
+}
+
+type ScheduleRun struct {
+    StartedAtMS int64            `json:"started_at_ms"`
+    Trigger     string           `json:"trigger"` // cron|interval|watch
+    Result      ShellRunResponse `json:"result"`
+}
+
+type Schedule struct {
+    ID          string        `json:"id"`
+    Spec        ScheduleSpec  `json:"spec"`
+    CreatedAtMS int64         `json:"created_at_ms"`
+    NextRunMS   int64         `json:"next_run_ms,omitempty"` // next cron/interval run; 0 when paused or watch-only
+    Running     bool          `json:"running"`
+    Runs        int64         `json:"runs"`              // completed runs
+    Failures    int64         `json:"failures"`          // runs with rc != 0 or an error
+    Skipped     int64         `json:"skipped"`           // triggers dropped because the previous run was still going
+    LastRun     *ScheduleRun  `json:"last_run,omitempty"`
+    History     []ScheduleRun `json:"history,omitempty"` // newest first; only from /v1/schedules/get
+}
+
+type ScheduleCreateRequest struct {
+    ScheduleSpec
+}
+
+type ScheduleUpdateRequest struct {
+    ID   string       `json:"id"`
+    Spec ScheduleSpec `json:"spec"` // replaces the spec; history is kept
+}
+
+type ScheduleIDRequest struct {
+    ID string `json:"id"`
+}
+
+type ScheduleListResponse struct {
+    Schedules []Schedule `json:"schedules"`
+}
+
+// ServiceReady is a readiness probe; every check given must pass.
+type ServiceReady struct {
+    TCP        string   `json:"tcp,omitempty"`         // host:port that must accept connections
+    LogRegex   string   `json:"log_regex,omitempty"`   // must match the instance's stdout or stderr
+    Command    []string `json:"command,omitempty"`     // must exit 0; runs in the service's cwd and env
+    IntervalMS int64    `json:"interval_ms,omitempty"` // default 200
+    TimeoutMS  int64    `json:"timeout_ms,omitempty"`  // default 30000; an instance not ready by then is killed and counts as failed
+}
+
+// ServiceStartRequest supervises a long-lived process. Run takes argv, cwd,
+// env, env_policy and kill_grace_ms; other shell.run options are rejected.
+type ServiceStartRequest struct {
+    Name         string          `json:"name,omitempty"`
+    Run          ShellRunRequest `json:"run"`
+    Restart      string          `json:"restart,omitempty"`        // never (default)|on-failure|always
+    MaxRestarts  int             `json:"max_restarts,omitempty"`   // automatic restarts before giving up; 0 = unlimited
+    BackoffMS    int64           `json:"backoff_ms,omitempty"`     // first restart delay, doubled per restart; default 500
+    MaxBackoffMS int64           `json:"max_backoff_ms,omitempty"` // default 30000; the delay resets after 10s of uptime
+    Ready        *ServiceReady   `json:"ready,omitempty"`
+    // WaitReadyMS blocks the response until the service is ready or stops, up to this long.
+    WaitReadyMS int64 `json:"wait_ready_ms,omitempty"`
+}
+
+type ServiceIDRequest struct {
+    ID string `json:"id"`
+}
+
+type ServiceStopRequest struct {
+    ID     string `json:"id"`
+    Remove bool   `json:"remove,omitempty"` // forget the service and its logs after stopping
+}
+
+type ServiceStatus struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name,omitempty"`
+    Argv        []string    `json:"argv"`
+    Cwd         string      `json:"cwd,omitempty"`
+    Restart     string      `json:"restart"`
+    State       string      `json:"state"` // starting|running|backoff|stopped|exited|failed
+    Ready       bool        `json:"ready"`
+    PID         int         `json:"pid,omitempty"`
+    Restarts    int         `json:"restarts"`
+    StartedAtMS int64       `json:"started_at_ms,omitempty"` // current or last instance
+    ReadyAtMS   int64       `json:"ready_at_ms,omitempty"`
+    NextStartMS int64       `json:"next_start_ms,omitempty"` // set in backoff
+    LastRC      *int        `json:"last_rc,omitempty"`       // last finished instance
+    LastSignal  *ExitSignal `json:"last_signal,omitempty"`
+    Error       string      `json:"error,omitempty"`
+}
+
+// ServiceLogsRequest reads the output of every instance, in job-chunk form.
+type ServiceLogsRequest struct {
+    ID        string   `json:"id"`
+    SinceSeq  uint64   `json:"since_seq,omitempty"`
+    MaxBytes  int      `json:"max_bytes,omitempty"`
+    TimeoutMS int64    `json:"timeout_ms,omitempty"`
+    Parsers   []string `json:"parsers,omitempty"`
+}
+
+type ServiceListResponse struct {
+    Services []ServiceStatus `json:"services"`
+}
+
+// WaitCondition is one thing /v1/wait can wait for; set exactly one of
+// tcp, unix, file, pid, job_id or pty_id.
+type WaitCondition struct {
+    TCP  string `json:"tcp,omitempty"`  // host:port accepts connections
+    Unix string `json:"unix,omitempty"` // a unix socket exists at this path
+    File string `json:"file,omitempty"` // the file exists (and matches file_regex, if given)
+    // FileRegex is matched against the file's content, re-read on each poll.
+    FileRegex string `json:"file_regex,omitempty"`
+    PID       int    `json:"pid,omitempty"`    // the process has exited
+    JobID     string `json:"job_id,omitempty"` // the job has finished
+    PTYID     string `json:"pty_id,omitempty"` // pty_regex appears in the session's output
+    PTYRegex  string `json:"pty_regex,omitempty"`
+    // SinceSeq limits the PTY match to chunks after this seq; 0 also searches
+    // output retained from before the wait began.
+    SinceSeq uint64 `json:"since_seq,omitempty"`
+}
+
+// WaitRequest blocks until any condition holds or the timeout expires.
+type WaitRequest struct {
+    Conditions []WaitCondition `json:"conditions"`
+    Cwd        string          `json:"cwd,omitempty"`         // base for relative file and unix paths
+    TimeoutMS  int64           `json:"timeout_ms,omitempty"`  // default 30000, max 600000
+    IntervalMS int64           `json:"interval_ms,omitempty"` // poll interval, default 100
+}
+
+type WaitResponse struct {
+    Fired     bool   `json:"fired"`
+    TimedOut  bool   `json:"timed_out,omitempty"`
+    Index     int    `json:"index"`           // index into conditions of the one that fired; -1 on timeout
+    Kind      string `json:"kind,omitempty"`  // tcp|unix|file|pid|job|pty
+    Match     string `json:"match,omitempty"` // text matched by file_regex or pty_regex
+    RC        *int   `json:"rc,omitempty"`    // exit status of a finished job
+    ElapsedMS int64  `json:"elapsed_ms"`
+}
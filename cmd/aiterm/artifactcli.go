@@ -0,0 +1,73 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+
+    "ai-terminal/api"
+)
+
+func artifactGetCmd(args []string) {
+    fs := flag.NewFlagSet("artifact-get", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "artifact id")
+    offset := fs.Int64("offset", 0, "first byte to download")
+    length := fs.Int64("length", 0, "bytes to download (0 = to the end)")
+    outPath := fs.String("o", "", "write to this file instead of stdout")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    resp, err := postJSON(*server, "/v1/artifacts/get", api.ArtifactGetRequest{ID: *id, Offset: *offset, Length: *length})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        io.Copy(os.Stderr, resp.Body)
+        os.Exit(1)
+    }
+    var w io.Writer = os.Stdout
+    if *outPath != "" {
+        f, err := os.Create(*outPath)
+        if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+        defer f.Close()
+        w = f
+    }
+    if _, err := io.Copy(w, resp.Body); err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+}
+
+func artifactStatCmd(args []string) {
+    fs := flag.NewFlagSet("artifact-stat", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "artifact id")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    resp, err := postJSON(*server, "/v1/artifacts/stat", api.ArtifactStatRequest{ID: *id})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+func artifactListCmd(args []string) {
+    fs := flag.NewFlagSet("artifact-list", flag.ExitOnError)
+    server := defaultServer(fs)
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    resp, err := http.Get(strings.TrimRight(*server, "/") + "/v1/artifacts/list")
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+func artifactDeleteCmd(args []string) {
+    fs := flag.NewFlagSet("artifact-rm", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "artifact id")
+    force := fs.Bool("force", false, "delete even if a job or session references it")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    resp, err := postJSON(*server, "/v1/artifacts/delete", api.ArtifactDeleteRequest{ID: *id, Force: *force})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+
+    "ai-terminal/api"
+)
+
+func cacheStatsCmd(args []string) {
+    fs := flag.NewFlagSet("cache-stats", flag.ExitOnError)
+    server := defaultServer(fs)
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    resp, err := http.Get(strings.TrimRight(*server, "/") + "/v1/cache/stats")
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+func cachePurgeCmd(args []string) {
+    fs := flag.NewFlagSet("cache-purge", flag.ExitOnError)
+    server := defaultServer(fs)
+    key := fs.String("key", "", "cache_key (or prefix) to drop; empty purges everything")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    resp, err := postJSON(*server, "/v1/cache/purge", api.CachePurgeRequest{Key: *key})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "ai-terminal/api"
+)
+
+func postJSON(server, path string, v interface{}) (*http.Response, error) {
+    body, _ := json.Marshal(v)
+    return http.Post(strings.TrimRight(server, "/")+path, "application/json", bytes.NewReader(body))
+}
+
+func jobStartCmd(args []string) {
+    fs := flag.NewFlagSet("job-start", flag.ExitOnError)
+    server := defaultServer(fs)
+    cwd := fs.String("cwd", "", "working directory")
+    timeoutStr := fs.String("timeout", "", "timeout (e.g., 20m)")
+    envCSV := fs.String("env", "", "comma-separated KEY=VAL pairs")
+    sep := indexOf(args, "--")
+    our := args
+    rest := []string{}
+    if sep >= 0 { our = args[:sep]; rest = args[sep+1:] }
+    if err := fs.Parse(our); err != nil { os.Exit(2) }
+    argv := fs.Args()
+    if len(argv) == 0 && len(rest) > 0 { argv = rest }
+    if len(argv) == 0 { fmt.Fprintln(os.Stderr, "missing argv after --"); os.Exit(2) }
+    env, err := parsePairs(*envCSV)
+    if err != nil { fmt.Fprintf(os.Stderr, "invalid env pair: %v\n", err); os.Exit(2) }
+    req := api.JobStartRequest{ShellRunRequest: api.ShellRunRequest{Argv: argv, Cwd: *cwd, Env: env}}
+    if *timeoutStr != "" {
+        d, err := time.ParseDuration(*timeoutStr)
+        if err != nil { fmt.Fprintln(os.Stderr, "bad timeout"); os.Exit(2) }
+        req.TimeoutMS = d.Milliseconds()
+    }
+    resp, err := postJSON(*server, "/v1/jobs/start", req)
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+// jobFollowCmd streams job output to stdout/stderr and exits with the job's rc.
+func jobFollowCmd(args []string) {
+    fs := flag.NewFlagSet("job-follow", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "job id")
+    timeoutStr := fs.String("timeout", "500ms", "read timeout")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    to, err := time.ParseDuration(*timeoutStr)
+    if err != nil { fmt.Fprintln(os.Stderr, "bad timeout"); os.Exit(2) }
+    since := uint64(0)
+    for {
+        resp, err := postJSON(*server, "/v1/jobs/read", api.JobReadRequest{ID: *id, SinceSeq: since, MaxBytes: 1 << 16, TimeoutMS: to.Milliseconds()})
+        if err != nil { fmt.Fprintln(os.Stderr, err); time.Sleep(200 * time.Millisecond); continue }
+        var rr api.JobReadResponse
+        if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil { resp.Body.Close(); fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+        resp.Body.Close()
+        for _, c := range rr.Chunks {
+            b, _ := base64.StdEncoding.DecodeString(c.Data)
+            if c.Stream == "stderr" { os.Stderr.Write(b) } else { os.Stdout.Write(b) }
+            since = c.Seq
+        }
+        if rr.Done { break }
+    }
+    resp, err := postJSON(*server, "/v1/jobs/wait", api.JobWaitRequest{ID: *id})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    var st api.JobStatus
+    if err := json.NewDecoder(resp.Body).Decode(&st); err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    os.Exit(st.RC)
+}
+
+func jobIDCmd(name, path string, args []string) {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "job id")
+    timeoutStr := fs.String("timeout", "0", "wait timeout (job-wait only; 0 waits until done)")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    to, err := time.ParseDuration(*timeoutStr)
+    if err != nil { fmt.Fprintln(os.Stderr, "bad timeout"); os.Exit(2) }
+    resp, err := postJSON(*server, path, api.JobWaitRequest{ID: *id, TimeoutMS: to.Milliseconds()})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+func jobListCmd(args []string) {
+    fs := flag.NewFlagSet("job-list", flag.ExitOnError)
+    server := defaultServer(fs)
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    resp, err := http.Get(strings.TrimRight(*server, "/") + "/v1/jobs/list")
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
@@ -14,12 +14,22 @@ import (
 )
 
 type runOutput struct {
-    RC          int    `json:"rc"`
-    StdoutB64   string `json:"stdout"`
-    StderrB64   string `json:"stderr"`
-    DurationMS  int64  `json:"duration_ms"`
-    Cwd         string `json:"cwd"`
-    Error       string `json:"error,omitempty"`
+    RC              int    `json:"rc"`
+    Signal          string `json:"signal,omitempty"`
+    CoreDumped      bool   `json:"core_dumped,omitempty"`
+    TimedOut        bool   `json:"timed_out,omitempty"`
+    StdoutB64       string `json:"stdout"`
+    StderrB64       string `json:"stderr"`
+    DurationMS      int64  `json:"duration_ms"`
+    Cwd             string `json:"cwd"`
+    StdoutBytes     int64  `json:"stdout_bytes"`
+    StderrBytes     int64  `json:"stderr_bytes"`
+    StdoutTruncated bool   `json:"stdout_truncated"`
+    StderrTruncated bool   `json:"stderr_truncated"`
+    LimitExceeded   bool   `json:"limit_exceeded,omitempty"`
+    CPUMS           int64  `json:"cpu_ms"`
+    MaxRSSKB        int64  `json:"max_rss_kb"`
+    Error           string `json:"error,omitempty"`
 }
 
 func main() {
@@ -38,12 +48,56 @@ func main() {
         ptyReadCmd(os.Args[2:])
     case "pty-follow":
         ptyFollowCmd(os.Args[2:])
+    case "pty-events":
+        ptyEventsCmd(os.Args[2:])
+    case "pty-status":
+        ptyStatusCmd(os.Args[2:])
+    case "pty-usage":
+        ptyUsageCmd(os.Args[2:])
     case "pty-resize":
         ptyResizeCmd(os.Args[2:])
     case "pty-close":
         ptyCloseCmd(os.Args[2:])
     case "bridge-list":
         bridgeListCmd(os.Args[2:])
+    case "history":
+        historyCmd(os.Args[2:])
+    case "job-start":
+        jobStartCmd(os.Args[2:])
+    case "job-follow":
+        jobFollowCmd(os.Args[2:])
+    case "job-wait":
+        jobIDCmd("job-wait", "/v1/jobs/wait", os.Args[2:])
+    case "job-cancel":
+        jobIDCmd("job-cancel", "/v1/jobs/cancel", os.Args[2:])
+    case "job-list":
+        jobListCmd(os.Args[2:])
+    case "artifact-get":
+        artifactGetCmd(os.Args[2:])
+    case "artifact-stat":
+        artifactStatCmd(os.Args[2:])
+    case "artifact-list":
+        artifactListCmd(os.Args[2:])
+    case "artifact-rm":
+        artifactDeleteCmd(os.Args[2:])
+    case "cache-stats":
+        cacheStatsCmd(os.Args[2:])
+    case "cache-purge":
+        cachePurgeCmd(os.Args[2:])
+    case "schedule-list":
+        scheduleListCmd(os.Args[2:])
+    case "schedule-get":
+        scheduleIDCmd("schedule-get", "/v1/schedules/get", os.Args[2:])
+    case "schedule-delete":
+        scheduleIDCmd("schedule-delete", "/v1/schedules/delete", os.Args[2:])
+    case "service-list":
+        serviceListCmd(os.Args[2:])
+    case "service-status":
+        serviceIDCmd("service-status", "/v1/services/status", os.Args[2:])
+    case "service-restart":
+        serviceIDCmd("service-restart", "/v1/services/restart", os.Args[2:])
+    case "service-stop":
+        serviceIDCmd("service-stop", "/v1/services/stop", os.Args[2:])
     default:
         usage()
         os.Exit(2)
@@ -52,14 +106,35 @@ func main() {
 
 func usage() {
     fmt.Fprintf(os.Stderr, "Usage:\n")
-    fmt.Fprintf(os.Stderr, "  aiterm run [--cwd DIR] [--timeout 5s] [--env KEY=VAL,...] [--stdin-base64 DATA] -- argv...\n")
-    fmt.Fprintf(os.Stderr, "  aiterm pty-open [--server URL] -- argv...\n")
+    fmt.Fprintf(os.Stderr, "  aiterm run [--cwd DIR] [--timeout 5s] [--env KEY=VAL,...] [--stdin-base64 DATA] [--max-output N [--keep-tail]] [--kill-after-bytes N] -- argv...\n")
+    fmt.Fprintf(os.Stderr, "  aiterm pty-open [--server URL] [--label KEY=VAL,...] -- argv...\n")
     fmt.Fprintf(os.Stderr, "  aiterm pty-send [--server URL] --id ID [--data STRING|--stdin]\n")
     fmt.Fprintf(os.Stderr, "  aiterm pty-read [--server URL] --id ID [--since N] [--timeout 500ms] [--max-bytes N]\n")
     fmt.Fprintf(os.Stderr, "  aiterm pty-follow [--server URL] --id ID [--timeout 500ms]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm pty-events [--server URL] --id ID [--since N] [--timeout 500ms]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm pty-status [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm pty-usage [--server URL] --id ID\n")
     fmt.Fprintf(os.Stderr, "  aiterm pty-resize [--server URL] --id ID --rows N --cols N\n")
     fmt.Fprintf(os.Stderr, "  aiterm pty-close [--server URL] --id ID\n")
     fmt.Fprintf(os.Stderr, "  aiterm bridge-list [--server URL] [--json]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm job-start [--server URL] [--cwd DIR] [--timeout 20m] [--env KEY=VAL,...] -- argv...\n")
+    fmt.Fprintf(os.Stderr, "  aiterm job-follow [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm job-wait [--server URL] --id ID [--timeout 0]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm job-cancel [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm job-list [--server URL]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm artifact-get [--server URL] --id ID [--offset N] [--length N] [-o FILE]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm artifact-stat [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm artifact-list [--server URL]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm artifact-rm [--server URL] --id ID [--force]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm cache-stats [--server URL]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm cache-purge [--server URL] [--key KEY]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm schedule-list [--server URL]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm schedule-get [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm schedule-delete [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm service-list [--server URL]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm service-status|service-restart [--server URL] --id ID\n")
+    fmt.Fprintf(os.Stderr, "  aiterm service-stop [--server URL] --id ID [--rm]\n")
+    fmt.Fprintf(os.Stderr, "  aiterm history [--server URL] [--id ID] [--command NAME] [--label KEY=VAL,...] [--since 12h] [--rc N] [--limit N] [--json]\n")
 }
 
 func runCmd(args []string) {
@@ -68,6 +143,9 @@ func runCmd(args []string) {
     timeoutStr := fs.String("timeout", "", "timeout (e.g., 5s, 2m)")
     envCSV := fs.String("env", "", "comma-separated KEY=VAL pairs")
     stdinB64 := fs.String("stdin-base64", "", "stdin data as base64")
+    maxOutput := fs.Int64("max-output", 0, "per-stream output cap in bytes (0 = unlimited)")
+    keepTail := fs.Bool("keep-tail", false, "keep head and tail of capped output")
+    killAfter := fs.Int64("kill-after-bytes", 0, "kill once combined output exceeds this many bytes")
     // Split on -- to separate our flags from argv
     // Example: aiterm run --timeout 2s -- -- /bin/echo hi
     sep := indexOf(args, "--")
@@ -101,18 +179,10 @@ func runCmd(args []string) {
             os.Exit(2)
         }
     }
-    envMap := map[string]string{}
-    if *envCSV != "" {
-        pairs := strings.Split(*envCSV, ",")
-        for _, p := range pairs {
-            if p == "" { continue }
-            kv := strings.SplitN(p, "=", 2)
-            if len(kv) != 2 {
-                fmt.Fprintf(os.Stderr, "invalid env pair: %q\n", p)
-                os.Exit(2)
-            }
-            envMap[kv[0]] = kv[1]
-        }
+    envMap, err := parsePairs(*envCSV)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "invalid env pair: %v\n", err)
+        os.Exit(2)
     }
     var stdin []byte
     if *stdinB64 != "" {
@@ -125,20 +195,36 @@ func runCmd(args []string) {
     }
 
     req := term.RunRequest{
-        Argv:    argv,
-        Cwd:     *cwd,
-        Env:     envMap,
-        Timeout: timeout,
-        Stdin:   stdin,
+        Argv:           argv,
+        Cwd:            *cwd,
+        Env:            envMap,
+        Timeout:        timeout,
+        Stdin:          stdin,
+        MaxStdoutBytes: *maxOutput,
+        MaxStderrBytes: *maxOutput,
+        KeepTail:       *keepTail,
+        KillAfterBytes: *killAfter,
     }
 
     res, err := term.ShellRun(context.Background(), req)
     out := runOutput{
-        RC:         res.RC,
-        StdoutB64:  base64.StdEncoding.EncodeToString(res.Stdout),
-        StderrB64:  base64.StdEncoding.EncodeToString(res.Stderr),
-        DurationMS: res.Duration.Milliseconds(),
-        Cwd:        res.Cwd,
+        RC:              res.RC,
+        Signal:          res.Signal,
+        CoreDumped:      res.CoreDumped,
+        TimedOut:        res.TimedOut,
+        StdoutB64:       base64.StdEncoding.EncodeToString(res.Stdout),
+        StderrB64:       base64.StdEncoding.EncodeToString(res.Stderr),
+        DurationMS:      res.Duration.Milliseconds(),
+        Cwd:             res.Cwd,
+        StdoutBytes:     res.StdoutTotal,
+        StderrBytes:     res.StderrTotal,
+        StdoutTruncated: res.StdoutTruncated,
+        StderrTruncated: res.StderrTruncated,
+        LimitExceeded:   res.LimitExceeded,
+    }
+    if res.Usage != nil {
+        out.CPUMS = res.Usage.CPU().Milliseconds()
+        out.MaxRSSKB = res.Usage.MaxRSSKB
     }
     if err != nil {
         out.Error = err.Error()
@@ -153,6 +239,21 @@ func runCmd(args []string) {
     os.Exit(res.RC)
 }
 
+// parsePairs splits a comma-separated KEY=VAL list.
+func parsePairs(csv string) (map[string]string, error) {
+    out := map[string]string{}
+    if csv == "" { return out, nil }
+    for _, p := range strings.Split(csv, ",") {
+        if p == "" { continue }
+        kv := strings.SplitN(p, "=", 2)
+        if len(kv) != 2 {
+            return nil, fmt.Errorf("%q", p)
+        }
+        out[kv[0]] = kv[1]
+    }
+    return out, nil
+}
+
 func indexOf(ss []string, s string) int {
     for i, v := range ss {
         if v == s { return i }
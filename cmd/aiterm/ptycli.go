@@ -24,6 +24,7 @@ func defaultServer(fs *flag.FlagSet) *string {
 func ptyOpenCmd(args []string) {
     fs := flag.NewFlagSet("pty-open", flag.ExitOnError)
     server := defaultServer(fs)
+    labelCSV := fs.String("label", "", "comma-separated KEY=VAL labels")
     sep := indexOf(args, "--")
     our := args
     rest := []string{}
@@ -32,7 +33,9 @@ func ptyOpenCmd(args []string) {
     argv := fs.Args()
     if len(argv) == 0 && len(rest) > 0 { argv = rest }
     if len(argv) == 0 { fmt.Fprintln(os.Stderr, "missing argv after --"); os.Exit(2) }
-    req := api.PTYOpenRequest{Argv: argv, Rows: 24, Cols: 80, Env: map[string]string{"TERM": "dumb", "PS1": ""}}
+    labels, err := parsePairs(*labelCSV)
+    if err != nil { fmt.Fprintf(os.Stderr, "invalid label: %v\n", err); os.Exit(2) }
+    req := api.PTYOpenRequest{Argv: argv, Rows: 24, Cols: 80, Env: map[string]string{"TERM": "dumb", "PS1": ""}, Labels: labels}
     body, _ := json.Marshal(req)
     resp, err := http.Post(strings.TrimRight(*server, "/")+"/v1/pty/open", "application/json", bytes.NewReader(body))
     if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
@@ -112,6 +115,52 @@ func ptyFollowCmd(args []string) {
     }
 }
 
+func ptyEventsCmd(args []string) {
+    fs := flag.NewFlagSet("pty-events", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "session id")
+    since := fs.Uint64("since", 0, "since event seq")
+    timeoutStr := fs.String("timeout", "500ms", "timeout")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    to, err := time.ParseDuration(*timeoutStr)
+    if err != nil { fmt.Fprintln(os.Stderr, "bad timeout"); os.Exit(2) }
+    req := api.PTYEventsRequest{ID: *id, SinceSeq: *since, TimeoutMS: to.Milliseconds()}
+    body, _ := json.Marshal(req)
+    resp, err := http.Post(strings.TrimRight(*server, "/")+"/v1/pty/events", "application/json", bytes.NewReader(body))
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+func ptyStatusCmd(args []string) {
+    fs := flag.NewFlagSet("pty-status", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "session id")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    req := api.PTYStatusRequest{ID: *id}
+    body, _ := json.Marshal(req)
+    resp, err := http.Post(strings.TrimRight(*server, "/")+"/v1/pty/status", "application/json", bytes.NewReader(body))
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+func ptyUsageCmd(args []string) {
+    fs := flag.NewFlagSet("pty-usage", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "session id")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    req := api.PTYUsageRequest{ID: *id}
+    body, _ := json.Marshal(req)
+    resp, err := http.Post(strings.TrimRight(*server, "/")+"/v1/pty/usage", "application/json", bytes.NewReader(body))
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
 func ptyResizeCmd(args []string) {
     fs := flag.NewFlagSet("pty-resize", flag.ExitOnError)
     server := defaultServer(fs)
@@ -166,3 +215,46 @@ func bridgeListCmd(args []string) {
         if b.LogPath != "" { fmt.Printf("  log=%s\n", b.LogPath) }
     }
 }
+
+func historyCmd(args []string) {
+    fs := flag.NewFlagSet("history", flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "session id")
+    command := fs.String("command", "", "argv[0] or its basename")
+    labelCSV := fs.String("label", "", "comma-separated KEY=VAL labels (all must match)")
+    sinceStr := fs.String("since", "", "only sessions started within this duration (e.g., 12h)")
+    rc := fs.Int("rc", -1, "only sessions with this exit code")
+    limit := fs.Int("limit", 0, "max entries (newest first)")
+    asJSON := fs.Bool("json", false, "print raw JSON")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    labels, err := parsePairs(*labelCSV)
+    if err != nil { fmt.Fprintf(os.Stderr, "invalid label: %v\n", err); os.Exit(2) }
+    req := api.PTYHistoryRequest{ID: *id, Command: *command, Labels: labels, Limit: *limit}
+    if *sinceStr != "" {
+        d, err := time.ParseDuration(*sinceStr)
+        if err != nil { fmt.Fprintln(os.Stderr, "bad --since"); os.Exit(2) }
+        req.SinceMS = time.Now().Add(-d).UnixMilli()
+    }
+    if *rc >= 0 { req.ExitCode = rc }
+    body, _ := json.Marshal(req)
+    resp, err := http.Post(strings.TrimRight(*server, "/")+"/v1/pty/history", "application/json", bytes.NewReader(body))
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    if *asJSON {
+        io.Copy(os.Stdout, resp.Body)
+        return
+    }
+    var out api.PTYHistoryResponse
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    if len(out.Sessions) == 0 { fmt.Println("(no sessions)"); return }
+    for _, e := range out.Sessions {
+        rcs := "?"
+        if e.ExitCode != nil { rcs = fmt.Sprint(*e.ExitCode) }
+        if e.Signal != "" { rcs += " (" + e.Signal + ")" }
+        start := time.UnixMilli(e.StartedAtMS)
+        dur := time.UnixMilli(e.EndedAtMS).Sub(start).Round(time.Millisecond)
+        fmt.Printf("id=%s rc=%s started=%s duration=%s\n  argv=%q\n  cwd=%s in=%d out=%d\n", e.ID, rcs, start.Format(time.RFC3339), dur, e.Argv, e.Cwd, e.BytesIn, e.BytesOut)
+        if len(e.Labels) > 0 { fmt.Printf("  labels=%v\n", e.Labels) }
+        if e.LogPath != "" { fmt.Printf("  log=%s\n", e.LogPath) }
+    }
+}
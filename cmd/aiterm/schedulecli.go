@@ -0,0 +1,35 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+
+    "ai-terminal/api"
+)
+
+func scheduleListCmd(args []string) {
+    fs := flag.NewFlagSet("schedule-list", flag.ExitOnError)
+    server := defaultServer(fs)
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    resp, err := http.Get(strings.TrimRight(*server, "/") + "/v1/schedules/list")
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+// scheduleIDCmd posts {"id"} to a /v1/schedules endpoint (get, delete).
+func scheduleIDCmd(name, path string, args []string) {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "schedule id")
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    resp, err := postJSON(*server, path, api.ScheduleIDRequest{ID: *id})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
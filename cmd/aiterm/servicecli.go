@@ -0,0 +1,39 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+
+    "ai-terminal/api"
+)
+
+func serviceListCmd(args []string) {
+    fs := flag.NewFlagSet("service-list", flag.ExitOnError)
+    server := defaultServer(fs)
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    resp, err := http.Get(strings.TrimRight(*server, "/") + "/v1/services/list")
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
+
+// serviceIDCmd posts {"id"} to a /v1/services endpoint (status, restart, stop).
+func serviceIDCmd(name, path string, args []string) {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    server := defaultServer(fs)
+    id := fs.String("id", "", "service id")
+    remove := false
+    if name == "service-stop" {
+        fs.BoolVar(&remove, "rm", false, "forget the service and its logs")
+    }
+    if err := fs.Parse(args); err != nil { os.Exit(2) }
+    if *id == "" { fmt.Fprintln(os.Stderr, "--id required"); os.Exit(2) }
+    resp, err := postJSON(*server, path, api.ServiceStopRequest{ID: *id, Remove: remove})
+    if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+    defer resp.Body.Close()
+    io.Copy(os.Stdout, resp.Body)
+}
@@ -5,18 +5,76 @@ import (
     "fmt"
     "log"
     "net/http"
+    "os"
+    "strings"
 
+    "ai-terminal/internal/envpolicy"
     "ai-terminal/internal/server"
 )
 
 func main() {
+    cfg := server.DefaultConfig()
     addr := flag.String("addr", ":8088", "listen address")
+    flag.Int64Var(&cfg.SessionLog.SegmentBytes, "log-segment-bytes", cfg.SessionLog.SegmentBytes, "rotate PTY session logs after this many bytes (0 disables)")
+    flag.IntVar(&cfg.SessionLog.MaxSegments, "log-max-segments", cfg.SessionLog.MaxSegments, "rotated PTY log segments kept per session (0 keeps all)")
+    flag.BoolVar(&cfg.SessionLog.Compress, "log-gzip", cfg.SessionLog.Compress, "gzip rotated PTY log segments")
+    flag.StringVar(&cfg.HistoryPath, "history", cfg.HistoryPath, "JSON-lines registry of closed PTY sessions (empty disables)")
+    flag.StringVar(&cfg.SecretsFile, "secrets", "", "NAME=VALUE file loaded into the secret store")
+    flag.StringVar(&cfg.AdminToken, "admin-token", os.Getenv("AITERM_ADMIN_TOKEN"), "bearer token for /v1/secrets/* (default $AITERM_ADMIN_TOKEN)")
+    flag.BoolVar(&cfg.RedactBuiltins, "redact-builtins", cfg.RedactBuiltins, "redact common token formats from logs and shell.run output")
+    flag.Func("redact", "extra redaction regexp, optionally NAME=REGEXP (repeatable)", func(v string) error {
+        cfg.RedactPatterns = append(cfg.RedactPatterns, v)
+        return nil
+    })
+    flag.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", cfg.MaxOutputBytes, "default per-stream shell.run output cap (0 = unlimited)")
+    flag.StringVar(&cfg.ArtifactDir, "artifact-dir", cfg.ArtifactDir, "content-addressed store for collected files and spilled output")
+    flag.Int64Var(&cfg.ArtifactMaxBytes, "artifact-max-bytes", cfg.ArtifactMaxBytes, "collect unreferenced artifacts, least recently used first, above this total (0 = unlimited)")
+    flag.Int64Var(&cfg.SpillBytes, "spill-bytes", cfg.SpillBytes, "store shell.run/job output and closed session logs larger than this as artifacts (0: only requests with spill_bytes spill)")
+    flag.DurationVar(&cfg.LogArtifactTTL, "log-artifact-ttl", cfg.LogArtifactTTL, "how long spilled session logs stay pinned before GC may collect them (0 keeps them)")
+    flag.DurationVar(&cfg.RunArtifactTTL, "run-artifact-ttl", cfg.RunArtifactTTL, "how long shell.run spilled output and collected files stay pinned before GC may collect them (0 never pins them)")
+    flag.IntVar(&cfg.CacheEntries, "cache-entries", cfg.CacheEntries, "memoized shell.run results kept for requests with \"cache\" (0 disables)")
+    flag.Int64Var(&cfg.CacheMaxBytes, "cache-max-bytes", cfg.CacheMaxBytes, "total size of memoized shell.run results")
+    flag.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "default lifetime of memoized shell.run results")
+    flag.DurationVar(&cfg.KillGrace, "kill-grace", cfg.KillGrace, "delay between SIGTERM and SIGKILL when tearing down process groups")
+    flag.StringVar(&cfg.Env.Mode, "env-mode", cfg.Env.Mode, "environment inheritance for spawned processes: empty, inherit or allowlist")
+    flag.Func("env-allow", "comma-separated variables (or PREFIX*) inherited in allowlist mode", func(v string) error {
+        cfg.Env.Allow = append(cfg.Env.Allow, splitList(v)...)
+        return nil
+    })
+    flag.Func("env-deny", "comma-separated glob patterns never inherited (e.g. *_TOKEN)", func(v string) error {
+        cfg.Env.Deny = append(cfg.Env.Deny, splitList(v)...)
+        return nil
+    })
+    flag.Func("env-file", ".env file layered under request env (repeatable)", func(v string) error {
+        cfg.Env.Files = append(cfg.Env.Files, v)
+        return nil
+    })
+    flag.StringVar(&cfg.EnvFileDir, "env-file-dir", cfg.EnvFileDir, "directory request env_policy files must lie in (default: request files rejected)")
+    flag.Func("env-preset", "comma-separated presets: "+strings.Join(envpolicy.Presets(), ", "), func(v string) error {
+        cfg.Env.Presets = append(cfg.Env.Presets, splitList(v)...)
+        return nil
+    })
+    flag.BoolVar(&cfg.RedactReads, "redact-reads", cfg.RedactReads, "apply redaction to pty.read results by default")
     flag.Parse()
 
-    srv := server.New()
+    srv, err := server.NewWithConfig(cfg)
+    if err != nil {
+        log.Fatalf("aitermd: %v", err)
+    }
     h := srv.Handler()
     log.Printf("aitermd listening on %s", *addr)
     if err := http.ListenAndServe(*addr, h); err != nil {
         fmt.Println("server error:", err)
     }
 }
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(v string) []string {
+    var out []string
+    for _, item := range strings.Split(v, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            out = append(out, item)
+        }
+    }
+    return out
+}
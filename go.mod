@@ -3,7 +3,7 @@ module ai-terminal
 go 1.24.2
 
 require (
-	github.com/creack/pty v1.1.21 // indirect
-	golang.org/x/sys v0.27.0 // indirect
-	golang.org/x/term v0.26.0 // indirect
+	github.com/creack/pty v1.1.21
+	golang.org/x/sys v0.27.0
+	golang.org/x/term v0.26.0
 )
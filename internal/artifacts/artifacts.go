@@ -0,0 +1,337 @@
+// Package artifacts stores files produced by commands so clients can
+// download them later by ID. Content is addressed by its sha256.
+//
+// Artifacts may be referenced by owners such as "job:<id>" or "pty:<id>";
+// referenced artifacts survive garbage collection and plain deletes. The
+// references are kept in refs.json next to the content so they outlive
+// restarts.
+package artifacts
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "sync"
+    "time"
+)
+
+var idRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ErrNotFound is returned for unknown or malformed IDs.
+var ErrNotFound = errors.New("no such artifact")
+
+// ErrInUse is returned when deleting an artifact that still has references.
+var ErrInUse = errors.New("artifact is referenced")
+
+// Info describes a stored artifact.
+type Info struct {
+    ID       string
+    Size     int64
+    Created  time.Time
+    Accessed time.Time
+    Refs     []string // owners, sorted
+}
+
+type entry struct {
+    size     int64
+    created  time.Time
+    accessed time.Time
+    refs     map[string]bool
+}
+
+// Store keeps artifacts under dir as <id[:2]>/<id>.
+type Store struct {
+    dir string
+
+    mu       sync.Mutex
+    loaded   bool
+    entries  map[string]*entry
+    total    int64
+    maxBytes int64 // GC threshold applied after Put; 0 = unlimited
+}
+
+func NewStore(dir string) *Store { return &Store{dir: dir} }
+
+// SetMaxBytes sets the total size above which Put collects unreferenced
+// artifacts, least recently used first.
+func (s *Store) SetMaxBytes(n int64) {
+    s.mu.Lock()
+    s.maxBytes = n
+    s.mu.Unlock()
+}
+
+func (s *Store) path(id string) string { return filepath.Join(s.dir, id[:2], id) }
+
+func (s *Store) refsPath() string { return filepath.Join(s.dir, "refs.json") }
+
+// loadLocked indexes the content on disk and the saved references once.
+// Caller holds s.mu.
+func (s *Store) loadLocked() {
+    if s.loaded {
+        return
+    }
+    s.loaded = true
+    s.entries = map[string]*entry{}
+    _ = filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() || !idRe.MatchString(d.Name()) {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return nil
+        }
+        s.entries[d.Name()] = &entry{size: info.Size(), created: info.ModTime(), accessed: info.ModTime(), refs: map[string]bool{}}
+        s.total += info.Size()
+        return nil
+    })
+    var refs map[string][]string
+    if b, err := os.ReadFile(s.refsPath()); err == nil && json.Unmarshal(b, &refs) == nil {
+        for id, owners := range refs {
+            if e := s.entries[id]; e != nil {
+                for _, o := range owners {
+                    e.refs[o] = true
+                }
+            }
+        }
+    }
+}
+
+// saveRefsLocked persists the reference table. Caller holds s.mu.
+func (s *Store) saveRefsLocked() {
+    refs := map[string][]string{}
+    for id, e := range s.entries {
+        for o := range e.refs {
+            refs[id] = append(refs[id], o)
+        }
+    }
+    b, _ := json.Marshal(refs)
+    tmp := s.refsPath() + ".tmp"
+    if os.WriteFile(tmp, b, 0o644) == nil {
+        _ = os.Rename(tmp, s.refsPath())
+    }
+}
+
+// Put copies r into the store and returns its ID and size. A non-empty
+// owner references the artifact before the store lock is released, so a
+// concurrent Put cannot collect it first.
+func (s *Store) Put(r io.Reader, owner string) (string, int64, error) {
+    if err := os.MkdirAll(s.dir, 0o755); err != nil {
+        return "", 0, err
+    }
+    tmp, err := os.CreateTemp(s.dir, ".put-*")
+    if err != nil {
+        return "", 0, err
+    }
+    defer os.Remove(tmp.Name())
+    h := sha256.New()
+    n, err := io.Copy(io.MultiWriter(tmp, h), r)
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return "", 0, err
+    }
+    id := hex.EncodeToString(h.Sum(nil))
+    dst := s.path(id)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    now := time.Now()
+    if e := s.entries[id]; e != nil {
+        e.accessed = now // identical content already stored
+        s.refLocked(e, owner)
+        return id, n, nil
+    }
+    if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+        return "", 0, err
+    }
+    if err := os.Rename(tmp.Name(), dst); err != nil {
+        return "", 0, err
+    }
+    s.entries[id] = &entry{size: n, created: now, accessed: now, refs: map[string]bool{}}
+    s.total += n
+    s.refLocked(s.entries[id], owner)
+    if s.maxBytes > 0 && s.total > s.maxBytes {
+        s.gcLocked(s.maxBytes, id)
+    }
+    return id, n, nil
+}
+
+// PutFile stores the file at path like Put.
+func (s *Store) PutFile(path, owner string) (string, int64, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return "", 0, err
+    }
+    defer f.Close()
+    return s.Put(f, owner)
+}
+
+// Open returns the artifact's content.
+func (s *Store) Open(id string) (*os.File, error) {
+    s.mu.Lock()
+    s.loadLocked()
+    e := s.entries[id]
+    if e != nil {
+        e.accessed = time.Now()
+    }
+    s.mu.Unlock()
+    if e == nil {
+        return nil, ErrNotFound
+    }
+    f, err := os.Open(s.path(id))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    return f, err
+}
+
+// Stat describes one artifact.
+func (s *Store) Stat(id string) (Info, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    e := s.entries[id]
+    if e == nil {
+        return Info{}, ErrNotFound
+    }
+    return e.info(id), nil
+}
+
+func (e *entry) info(id string) Info {
+    in := Info{ID: id, Size: e.size, Created: e.created, Accessed: e.accessed, Refs: []string{}}
+    for o := range e.refs {
+        in.Refs = append(in.Refs, o)
+    }
+    sort.Strings(in.Refs)
+    return in
+}
+
+// List returns every artifact, newest first, and their total size.
+func (s *Store) List() ([]Info, int64) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    out := make([]Info, 0, len(s.entries))
+    for id, e := range s.entries {
+        out = append(out, e.info(id))
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if !out[i].Created.Equal(out[j].Created) {
+            return out[i].Created.After(out[j].Created)
+        }
+        return out[i].ID < out[j].ID
+    })
+    return out, s.total
+}
+
+// Delete removes an artifact. Referenced artifacts are only removed with
+// force, which also drops their references.
+func (s *Store) Delete(id string, force bool) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    e := s.entries[id]
+    if e == nil {
+        return ErrNotFound
+    }
+    if len(e.refs) > 0 && !force {
+        return ErrInUse
+    }
+    if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return err
+    }
+    s.removeLocked(id)
+    if len(e.refs) > 0 {
+        s.saveRefsLocked()
+    }
+    return nil
+}
+
+func (s *Store) removeLocked(id string) {
+    s.total -= s.entries[id].size
+    delete(s.entries, id)
+    _ = os.Remove(filepath.Dir(s.path(id))) // only succeeds once empty
+}
+
+// Ref records that owner uses artifact id.
+func (s *Store) Ref(id, owner string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    e := s.entries[id]
+    if e == nil {
+        return ErrNotFound
+    }
+    s.refLocked(e, owner)
+    return nil
+}
+
+// refLocked adds owner to e's references; an empty owner adds nothing.
+// Caller holds s.mu.
+func (s *Store) refLocked(e *entry, owner string) {
+    if owner != "" && !e.refs[owner] {
+        e.refs[owner] = true
+        s.saveRefsLocked()
+    }
+}
+
+// Release drops every reference held by owner.
+func (s *Store) Release(owner string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    changed := false
+    for _, e := range s.entries {
+        if e.refs[owner] {
+            delete(e.refs, owner)
+            changed = true
+        }
+    }
+    if changed {
+        s.saveRefsLocked()
+    }
+}
+
+// GC removes unreferenced artifacts, least recently used first, until the
+// store holds at most maxBytes. It returns how many were removed and the
+// bytes freed.
+func (s *Store) GC(maxBytes int64) (int, int64) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.loadLocked()
+    return s.gcLocked(maxBytes, "")
+}
+
+// gcLocked implements GC, never removing keep. Caller holds s.mu.
+func (s *Store) gcLocked(maxBytes int64, keep string) (int, int64) {
+    var victims []string
+    for id, e := range s.entries {
+        if len(e.refs) == 0 && id != keep {
+            victims = append(victims, id)
+        }
+    }
+    sort.Slice(victims, func(i, j int) bool {
+        return s.entries[victims[i]].accessed.Before(s.entries[victims[j]].accessed)
+    })
+    removed, freed := 0, int64(0)
+    for _, id := range victims {
+        if s.total <= maxBytes {
+            break
+        }
+        if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+            continue
+        }
+        freed += s.entries[id].size
+        removed++
+        s.removeLocked(id)
+    }
+    return removed, freed
+}
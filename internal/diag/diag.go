@@ -0,0 +1,265 @@
+// Package diag extracts compiler and test diagnostics from tool output so
+// callers do not have to scrape text themselves.
+package diag
+
+import (
+    "bytes"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Severities.
+const (
+    Error   = "error"
+    Warning = "warning"
+    Note    = "note"
+)
+
+// MaxDiagnostics bounds how many diagnostics Parse returns.
+const MaxDiagnostics = 1000
+
+// Diagnostic is one located message. Line and Column are 1-based; zero
+// means unknown.
+type Diagnostic struct {
+    File     string
+    Line     int
+    Column   int
+    Severity string
+    Message  string
+    Tool     string // parser that produced it
+}
+
+var parsers = map[string]func([]byte) []Diagnostic{
+    "gcc":    parseGCC,
+    "go":     parseGo,
+    "gotest": parseGoTest,
+    "junit":  parseJUnit,
+    "python": parsePython,
+}
+
+// Parsers lists the known parser names.
+func Parsers() []string {
+    out := make([]string, 0, len(parsers))
+    for k := range parsers {
+        out = append(out, k)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// Validate rejects unknown parser names.
+func Validate(names []string) error {
+    for _, n := range names {
+        if _, ok := parsers[n]; !ok {
+            return fmt.Errorf("unknown parser %q (known: %s)", n, strings.Join(Parsers(), ", "))
+        }
+    }
+    return nil
+}
+
+// Parse runs each named parser over text and returns their diagnostics in
+// parser order, capped at MaxDiagnostics. Unknown names are ignored; see
+// Validate.
+func Parse(names []string, text []byte) []Diagnostic {
+    var out []Diagnostic
+    for _, n := range names {
+        if p := parsers[n]; p != nil {
+            out = append(out, p(text)...)
+        }
+    }
+    if len(out) > MaxDiagnostics {
+        out = out[:MaxDiagnostics]
+    }
+    return out
+}
+
+// maxLine is the longest line the parsers look at; longer ones (minified
+// output, base64 blobs) are skipped rather than ending the scan.
+const maxLine = 1 << 20
+
+func lines(text []byte) []string {
+    var out []string
+    for len(text) > 0 {
+        line, rest, _ := bytes.Cut(text, []byte("\n"))
+        text = rest
+        if len(line) <= maxLine {
+            out = append(out, strings.TrimRight(string(line), "\r"))
+        }
+    }
+    return out
+}
+
+func atoi(s string) int {
+    n, _ := strconv.Atoi(s)
+    return n
+}
+
+// gcc and clang: "file:line:col: error: message" (column optional).
+var gccRe = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*)$`)
+
+func parseGCC(text []byte) []Diagnostic {
+    var out []Diagnostic
+    for _, l := range lines(text) {
+        m := gccRe.FindStringSubmatch(l)
+        if m == nil { continue }
+        sev := m[4]
+        if sev == "fatal error" { sev = Error }
+        out = append(out, Diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: sev, Message: m[5], Tool: "gcc"})
+    }
+    return out
+}
+
+// go build and go vet: "./pkg/file.go:12:5: message" at the start of a line.
+var goRe = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+func parseGo(text []byte) []Diagnostic {
+    var out []Diagnostic
+    for _, l := range lines(text) {
+        if m := goRe.FindStringSubmatch(l); m != nil {
+            out = append(out, Diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: Error, Message: m[4], Tool: "go"})
+        }
+    }
+    return out
+}
+
+// go test -json: failed tests, located by the "file_test.go:N: msg" lines
+// they logged; failed packages without failed tests (build errors) are
+// parsed like go build output.
+var testLogRe = regexp.MustCompile(`^\s+(\S+\.go):(\d+): (.*)$`)
+
+func parseGoTest(text []byte) []Diagnostic {
+    type event struct {
+        Action  string
+        Package string
+        Test    string
+        Output  string
+    }
+    output := map[[2]string][]string{}
+    failedTests := map[string]bool{}
+    var out []Diagnostic
+    for _, l := range lines(text) {
+        var ev event
+        if !strings.HasPrefix(l, "{") || json.Unmarshal([]byte(l), &ev) != nil {
+            continue
+        }
+        key := [2]string{ev.Package, ev.Test}
+        switch ev.Action {
+        case "output":
+            output[key] = append(output[key], strings.TrimRight(ev.Output, "\n"))
+        case "fail":
+            if ev.Test != "" {
+                failedTests[ev.Package] = true
+                found := false
+                for _, o := range output[key] {
+                    if m := testLogRe.FindStringSubmatch(o); m != nil {
+                        out = append(out, Diagnostic{File: m[1], Line: atoi(m[2]), Severity: Error, Message: ev.Test + ": " + m[3], Tool: "gotest"})
+                        found = true
+                    }
+                }
+                if !found {
+                    out = append(out, Diagnostic{Severity: Error, Message: ev.Test + " failed", Tool: "gotest"})
+                }
+            } else if !failedTests[ev.Package] {
+                ds := parseGo([]byte(strings.Join(output[key], "\n")))
+                if len(ds) == 0 {
+                    ds = []Diagnostic{{Severity: Error, Message: "package " + ev.Package + " failed"}}
+                }
+                for _, d := range ds {
+                    d.Tool = "gotest"
+                    out = append(out, d)
+                }
+            }
+        }
+    }
+    return out
+}
+
+// JUnit XML: every <failure> or <error> inside a <testcase>.
+func parseJUnit(text []byte) []Diagnostic {
+    start := bytes.Index(text, []byte("<testsuite"))
+    if i := bytes.Index(text, []byte("<?xml")); i >= 0 && (start < 0 || i < start) {
+        start = i
+    }
+    if start < 0 {
+        return nil
+    }
+    var out []Diagnostic
+    var tc map[string]string
+    var cur *Diagnostic
+    dec := xml.NewDecoder(bytes.NewReader(text[start:]))
+    dec.Strict = false
+    for {
+        tok, err := dec.Token()
+        if err != nil {
+            break
+        }
+        switch t := tok.(type) {
+        case xml.StartElement:
+            attrs := map[string]string{}
+            for _, a := range t.Attr {
+                attrs[a.Name.Local] = a.Value
+            }
+            switch t.Name.Local {
+            case "testcase":
+                tc = attrs
+            case "failure", "error":
+                if tc == nil { continue }
+                name := tc["name"]
+                if tc["classname"] != "" { name = tc["classname"] + "." + name }
+                msg := attrs["message"]
+                if msg == "" { msg = attrs["type"] }
+                cur = &Diagnostic{File: tc["file"], Line: atoi(tc["line"]), Severity: Error, Message: name + ": " + msg, Tool: "junit"}
+            }
+        case xml.CharData:
+            if cur != nil && strings.HasSuffix(cur.Message, ": ") {
+                // no message attribute; use the first line of the body
+                if first := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(t)), "\n", 2)[0]); first != "" {
+                    cur.Message += first
+                }
+            }
+        case xml.EndElement:
+            switch t.Name.Local {
+            case "failure", "error":
+                if cur != nil {
+                    cur.Message = strings.TrimSuffix(cur.Message, ": ")
+                    out = append(out, *cur)
+                    cur = nil
+                }
+            case "testcase":
+                tc = nil
+            }
+        }
+    }
+    return out
+}
+
+// Python tracebacks: the innermost "File" frame and the final exception line.
+var pyFrameRe = regexp.MustCompile(`^\s+File "(.+)", line (\d+)`)
+
+func parsePython(text []byte) []Diagnostic {
+    var out []Diagnostic
+    var frame *Diagnostic
+    in := false
+    for _, l := range lines(text) {
+        switch {
+        case strings.HasPrefix(l, "Traceback (most recent call last):"):
+            in, frame = true, nil
+        case !in && pyFrameRe.MatchString(l):
+            in, frame = true, nil // SyntaxError reports omit the header
+            fallthrough
+        case in && pyFrameRe.MatchString(l):
+            m := pyFrameRe.FindStringSubmatch(l)
+            frame = &Diagnostic{File: m[1], Line: atoi(m[2]), Severity: Error, Tool: "python"}
+        case in && l != "" && !strings.HasPrefix(l, " ") && frame != nil:
+            frame.Message = l
+            out = append(out, *frame)
+            in, frame = false, nil
+        }
+    }
+    return out
+}
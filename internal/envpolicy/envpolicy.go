@@ -0,0 +1,286 @@
+// Package envpolicy decides which environment variables a spawned process
+// receives: what it inherits from aitermd, what is filtered out, and which
+// base files and deterministic presets are layered underneath the caller's
+// explicit variables.
+package envpolicy
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Inheritance modes.
+const (
+    ModeEmpty     = "empty"     // start from nothing (env -i)
+    ModeInherit   = "inherit"   // start from the daemon's environment
+    ModeAllowlist = "allowlist" // inherit only variables matching Allow
+)
+
+// presets are fixed variable sets that make output reproducible.
+var presets = map[string]map[string]string{
+    "locale":   {"LANG": "C.UTF-8", "LC_ALL": "C.UTF-8"},
+    "utc":      {"TZ": "UTC"},
+    "no_color": {"NO_COLOR": "1"},
+    "deterministic": {
+        "LANG": "C.UTF-8", "LC_ALL": "C.UTF-8", "TZ": "UTC", "NO_COLOR": "1",
+    },
+}
+
+// Policy describes how an environment is assembled. Layers apply in order:
+// inherited variables (per Mode and Allow) and Files, minus Deny matches,
+// then Presets, then the caller's explicit variables, which always win.
+type Policy struct {
+    Mode    string   // empty (default), inherit or allowlist
+    Allow   []string // allowlist entries: exact names or prefixes ending in "*"
+    Deny    []string // glob patterns removed from inherited and file variables
+    Files   []string // .env files (KEY=VALUE, optional "export ", quotes)
+    Presets []string // names from Presets()
+}
+
+// Presets lists the known preset names.
+func Presets() []string {
+    out := make([]string, 0, len(presets))
+    for k := range presets {
+        out = append(out, k)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// Restrict layers a caller's policy o on top of the operator's p and can only
+// narrow what p lets through: Mode may only get stricter (inherit, allowlist,
+// empty), Allow is intersected with p's, Deny is added to p's, and Files
+// replace p's but must lie under filesDir (none are accepted when it is "").
+// Presets replace p's.
+func (p Policy) Restrict(o Policy, filesDir string) (Policy, error) {
+    if err := o.Validate(); err != nil {
+        return p, err
+    }
+    base := p.Mode
+    if o.Mode != "" {
+        if strictness(o.Mode) < strictness(base) {
+            return p, fmt.Errorf("env mode %q is looser than the server's %q", o.Mode, base)
+        }
+        p.Mode = o.Mode
+    }
+    if o.Allow != nil {
+        if base == ModeAllowlist {
+            p.Allow = intersect(p.Allow, o.Allow)
+        } else {
+            p.Allow = o.Allow
+        }
+    }
+    p.Deny = append(p.Deny[:len(p.Deny):len(p.Deny)], o.Deny...)
+    if o.Files != nil {
+        files := make([]string, 0, len(o.Files))
+        for _, f := range o.Files {
+            name, err := within(filesDir, f)
+            if err != nil {
+                return p, err
+            }
+            files = append(files, name)
+        }
+        p.Files = files
+    }
+    if o.Presets != nil {
+        p.Presets = o.Presets
+    }
+    return p, nil
+}
+
+// strictness orders modes from the loosest (inherit) to the tightest (empty).
+func strictness(mode string) int {
+    switch mode {
+    case ModeInherit:
+        return 0
+    case ModeAllowlist:
+        return 1
+    }
+    return 2
+}
+
+// intersect returns the allowlist entries whose names both a and b accept.
+func intersect(a, b []string) []string {
+    var out []string
+    for _, x := range a {
+        xp, xw := strings.CutSuffix(x, "*")
+        for _, y := range b {
+            yp, yw := strings.CutSuffix(y, "*")
+            switch {
+            case xw && yw && strings.HasPrefix(xp, yp), !xw && yw && strings.HasPrefix(x, yp), !xw && !yw && x == y:
+                out = append(out, x)
+            case xw && yw && strings.HasPrefix(yp, xp), xw && !yw && strings.HasPrefix(y, xp):
+                out = append(out, y)
+            }
+        }
+    }
+    return out
+}
+
+// within resolves name (relative names against dir) and checks that it lies
+// under dir once symlinks are followed.
+func within(dir, name string) (string, error) {
+    if dir == "" {
+        return "", fmt.Errorf("env file %q: request env files are disabled", name)
+    }
+    if !filepath.IsAbs(name) {
+        name = filepath.Join(dir, name)
+    }
+    resolved, err := filepath.EvalSymlinks(name)
+    if err != nil {
+        return "", err
+    }
+    root, err := filepath.EvalSymlinks(dir)
+    if err != nil {
+        return "", err
+    }
+    if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+        return "", fmt.Errorf("env file %q is outside %s", name, dir)
+    }
+    return resolved, nil
+}
+
+// Validate checks the mode, preset names and deny patterns.
+func (p Policy) Validate() error {
+    switch p.Mode {
+    case "", ModeEmpty, ModeInherit, ModeAllowlist:
+    default:
+        return fmt.Errorf("unknown env mode %q", p.Mode)
+    }
+    for _, name := range p.Presets {
+        if _, ok := presets[name]; !ok {
+            return fmt.Errorf("unknown env preset %q", name)
+        }
+    }
+    for _, pat := range p.Deny {
+        if _, err := path.Match(pat, ""); err != nil {
+            return fmt.Errorf("env deny pattern %q: %w", pat, err)
+        }
+    }
+    return nil
+}
+
+// Environ builds the environment for a process. inherited is the source for
+// ModeInherit/ModeAllowlist (normally Environ() of the daemon); explicit is
+// the caller's map and is applied last, unfiltered.
+func (p Policy) Environ(inherited, explicit map[string]string) (map[string]string, error) {
+    if err := p.Validate(); err != nil {
+        return nil, err
+    }
+    env := map[string]string{}
+    switch p.Mode {
+    case ModeInherit:
+        for k, v := range inherited {
+            env[k] = v
+        }
+    case ModeAllowlist:
+        for k, v := range inherited {
+            if p.allowed(k) {
+                env[k] = v
+            }
+        }
+    }
+    for _, f := range p.Files {
+        vars, err := ReadFile(f)
+        if err != nil {
+            return nil, err
+        }
+        for k, v := range vars {
+            env[k] = v
+        }
+    }
+    for k := range env {
+        if p.denied(k) {
+            delete(env, k)
+        }
+    }
+    for _, name := range p.Presets {
+        for k, v := range presets[name] {
+            env[k] = v
+        }
+    }
+    for k, v := range explicit {
+        env[k] = v
+    }
+    return env, nil
+}
+
+func (p Policy) allowed(name string) bool {
+    for _, a := range p.Allow {
+        if prefix, ok := strings.CutSuffix(a, "*"); ok {
+            if strings.HasPrefix(name, prefix) {
+                return true
+            }
+        } else if a == name {
+            return true
+        }
+    }
+    return false
+}
+
+func (p Policy) denied(name string) bool {
+    for _, pat := range p.Deny {
+        if ok, _ := path.Match(pat, name); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// Environ returns the current process environment as a map.
+func Environ() map[string]string {
+    out := map[string]string{}
+    for _, kv := range os.Environ() {
+        if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+            out[k] = v
+        }
+    }
+    return out
+}
+
+// ReadFile parses a .env file: KEY=VALUE lines, blank lines and # comments
+// ignored, an optional "export " prefix, and single or double quoted values.
+func ReadFile(name string) (map[string]string, error) {
+    f, err := os.Open(name)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    out := map[string]string{}
+    sc := bufio.NewScanner(f)
+    line := 0
+    for sc.Scan() {
+        line++
+        text := strings.TrimSpace(sc.Text())
+        if text == "" || strings.HasPrefix(text, "#") {
+            continue
+        }
+        text = strings.TrimPrefix(text, "export ")
+        k, v, ok := strings.Cut(text, "=")
+        k = strings.TrimSpace(k)
+        if !ok || k == "" {
+            return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", name, line)
+        }
+        v = strings.TrimSpace(v)
+        if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+            v = v[1 : len(v)-1]
+        }
+        out[k] = v
+    }
+    return out, sc.Err()
+}
+
+// Keys returns the sorted variable names of env.
+func Keys(env map[string]string) []string {
+    out := make([]string, 0, len(env))
+    for k := range env {
+        out = append(out, k)
+    }
+    sort.Strings(out)
+    return out
+}
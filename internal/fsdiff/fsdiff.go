@@ -0,0 +1,174 @@
+// Package fsdiff snapshots directory trees and reports which files a command
+// created, modified or deleted between two snapshots.
+package fsdiff
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+// Defaults for Options fields left zero.
+const (
+    DefaultMaxFiles     = 10000
+    DefaultMaxHashBytes = 64 << 20
+)
+
+// Options selects what a snapshot covers.
+type Options struct {
+    Roots        []string // directories (or files) to watch; relative roots resolve against Dir
+    Dir          string   // base for relative roots
+    Ignore       []string // globs matched against base names and root-relative paths
+    Hash         bool     // record sha256 of regular files up to MaxHashBytes
+    MaxFiles     int      // stop recording after this many entries (0 = DefaultMaxFiles)
+    MaxHashBytes int64    // larger files are compared by size and mtime only
+}
+
+// Entry is the recorded state of one file.
+type Entry struct {
+    Size    int64
+    ModTime time.Time
+    Mode    fs.FileMode
+    SHA256  string // empty unless hashed
+}
+
+// Snapshot is the state of the watched roots at one point in time.
+type Snapshot struct {
+    Files     map[string]Entry // keyed by the root as given joined with the relative path
+    Truncated bool             // MaxFiles was reached
+}
+
+// Change describes one created, modified or deleted file. For deletions the
+// entry is the state before the command ran.
+type Change struct {
+    Path string
+    Entry
+}
+
+// Changes is the difference between two snapshots, each list sorted by path.
+type Changes struct {
+    Created   []Change
+    Modified  []Change
+    Deleted   []Change
+    Truncated bool // either snapshot was truncated; the lists may be incomplete
+}
+
+// Take walks the roots and records every regular file and symlink. Missing
+// roots are recorded as empty so that creating them shows up as new files.
+func Take(opts Options) (*Snapshot, error) {
+    if opts.MaxFiles <= 0 {
+        opts.MaxFiles = DefaultMaxFiles
+    }
+    if opts.MaxHashBytes <= 0 {
+        opts.MaxHashBytes = DefaultMaxHashBytes
+    }
+    for _, pat := range opts.Ignore {
+        if _, err := path.Match(pat, ""); err != nil {
+            return nil, err
+        }
+    }
+    snap := &Snapshot{Files: map[string]Entry{}}
+    for _, root := range opts.Roots {
+        abs := root
+        if !filepath.IsAbs(abs) && opts.Dir != "" {
+            abs = filepath.Join(opts.Dir, root)
+        }
+        err := filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+            if err != nil {
+                return nil // missing roots and unreadable entries are skipped, not fatal
+            }
+            rel, _ := filepath.Rel(abs, p)
+            if p != abs && ignored(opts.Ignore, rel) {
+                if d.IsDir() {
+                    return filepath.SkipDir
+                }
+                return nil
+            }
+            if d.IsDir() {
+                return nil
+            }
+            if len(snap.Files) >= opts.MaxFiles {
+                snap.Truncated = true
+                return filepath.SkipAll
+            }
+            info, err := d.Info()
+            if err != nil {
+                return nil
+            }
+            e := Entry{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+            if opts.Hash && info.Mode().IsRegular() && info.Size() <= opts.MaxHashBytes {
+                e.SHA256, _ = HashFile(p)
+            }
+            snap.Files[filepath.Join(root, rel)] = e
+            return nil
+        })
+        if err != nil {
+            return nil, err
+        }
+    }
+    return snap, nil
+}
+
+func ignored(patterns []string, rel string) bool {
+    rel = filepath.ToSlash(rel)
+    base := path.Base(rel)
+    for _, pat := range patterns {
+        if ok, _ := path.Match(pat, base); ok {
+            return true
+        }
+        if ok, _ := path.Match(pat, rel); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// HashFile returns the hex sha256 of the file at p.
+func HashFile(p string) (string, error) {
+    f, err := os.Open(p)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    h := sha256.New()
+    if _, err := io.Copy(h, f); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Diff compares two snapshots of the same roots.
+func Diff(before, after *Snapshot) Changes {
+    c := Changes{Truncated: before.Truncated || after.Truncated}
+    for p, a := range after.Files {
+        b, ok := before.Files[p]
+        switch {
+        case !ok:
+            c.Created = append(c.Created, Change{Path: p, Entry: a})
+        case changed(b, a):
+            c.Modified = append(c.Modified, Change{Path: p, Entry: a})
+        }
+    }
+    for p, b := range before.Files {
+        if _, ok := after.Files[p]; !ok {
+            c.Deleted = append(c.Deleted, Change{Path: p, Entry: b})
+        }
+    }
+    for _, list := range [][]Change{c.Created, c.Modified, c.Deleted} {
+        sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+    }
+    return c
+}
+
+func changed(b, a Entry) bool {
+    if b.Size != a.Size || !b.ModTime.Equal(a.ModTime) || b.Mode != a.Mode {
+        return true
+    }
+    return b.SHA256 != "" && a.SHA256 != "" && b.SHA256 != a.SHA256
+}
@@ -0,0 +1,128 @@
+// Package redact scrubs credential-looking text out of process output using
+// built-in token detectors and operator-supplied regular expressions.
+package redact
+
+import (
+    "bytes"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Rule replaces matches of a pattern with [REDACTED:Name].
+type Rule struct {
+    Name string
+    re   *regexp.Regexp
+}
+
+// builtins detect common token formats.
+var builtins = []struct{ name, pattern string }{
+    {"private_key", `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+    {"aws_access_key", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+    {"github_token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+    {"gitlab_token", `\bglpat-[A-Za-z0-9_-]{20,}`},
+    {"slack_token", `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+    {"google_api_key", `\bAIza[0-9A-Za-z_-]{35}`},
+    {"api_key", `\bsk-[A-Za-z0-9_-]{20,}`},
+    {"jwt", `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`},
+    {"bearer", `(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`},
+}
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Pipeline applies rules in order.
+type Pipeline struct {
+    rules []Rule
+}
+
+// New builds a pipeline from the built-in detectors (if enabled) followed by
+// custom patterns. A pattern may be prefixed with "name=" to label its matches.
+func New(useBuiltins bool, patterns []string) (*Pipeline, error) {
+    p := &Pipeline{}
+    if useBuiltins {
+        for _, b := range builtins {
+            p.rules = append(p.rules, Rule{Name: b.name, re: regexp.MustCompile(b.pattern)})
+        }
+    }
+    for i, pat := range patterns {
+        name := fmt.Sprintf("pattern%d", i+1)
+        if n, rest, ok := strings.Cut(pat, "="); ok && nameRe.MatchString(n) {
+            name, pat = n, rest
+        }
+        re, err := regexp.Compile(pat)
+        if err != nil {
+            return nil, fmt.Errorf("redact pattern %s: %w", name, err)
+        }
+        p.rules = append(p.rules, Rule{Name: name, re: re})
+    }
+    return p, nil
+}
+
+// Empty reports whether the pipeline has no rules.
+func (p *Pipeline) Empty() bool { return p == nil || len(p.rules) == 0 }
+
+// Names lists rule names in application order.
+func (p *Pipeline) Names() []string {
+    if p == nil {
+        return nil
+    }
+    out := make([]string, 0, len(p.rules))
+    for _, r := range p.rules {
+        out = append(out, r.Name)
+    }
+    return out
+}
+
+// Apply returns data with every match replaced, adding per-rule match counts
+// to counts (which may be nil if not needed).
+func (p *Pipeline) Apply(data []byte, counts map[string]int) []byte {
+    if p.Empty() || len(data) == 0 {
+        return data
+    }
+    for _, r := range p.rules {
+        n := 0
+        repl := []byte("[REDACTED:" + r.Name + "]")
+        out := r.re.ReplaceAllFunc(data, func([]byte) []byte {
+            n++
+            return repl
+        })
+        if n > 0 {
+            data = out
+            if counts != nil {
+                counts[r.Name] += n
+            }
+        }
+    }
+    return data
+}
+
+// Redact is Apply without counts, for use as a log filter.
+func (p *Pipeline) Redact(data []byte) []byte { return p.Apply(data, nil) }
+
+const (
+    // maxPartialLine bounds how much of an unterminated line is held back.
+    maxPartialLine = 4 << 10
+    // maxPartialBlock bounds how much of an unterminated private key is held back.
+    maxPartialBlock = 64 << 10
+)
+
+// PartialSuffix reports how many trailing bytes a match could still extend
+// into the next read. Rules match within a line, so that is the unterminated
+// last line, or its trailing word if the line is long; an open private key
+// block is held back whole.
+func (p *Pipeline) PartialSuffix(data []byte) int {
+    if p.Empty() {
+        return 0
+    }
+    hold := len(data) - (bytes.LastIndexAny(data, "\r\n") + 1)
+    if hold > maxPartialLine {
+        hold = len(data) - (bytes.LastIndexAny(data, " \t") + 1)
+    }
+    hold = min(hold, maxPartialLine)
+    done := data[:len(data)-hold]
+    if i := bytes.LastIndex(done, []byte("-----BEGIN ")); i >= 0 && len(data)-i <= maxPartialBlock &&
+        !bytes.Contains(done[i:], []byte("-----END ")) {
+        hold = len(data) - i
+    }
+    return hold
+}
@@ -0,0 +1,125 @@
+// Package runcache memoizes command results for callers that declare their
+// runs deterministic. Entries are opaque byte slices bounded by count, total
+// size and age, evicted least recently used first.
+package runcache
+
+import (
+    "container/list"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Stats describes the cache's contents and effectiveness.
+type Stats struct {
+    Entries    int
+    Bytes      int64
+    MaxEntries int
+    MaxBytes   int64
+    Hits       int64
+    Misses     int64
+    Evictions  int64
+}
+
+type entry struct {
+    key     string
+    val     []byte
+    expires time.Time // zero = no expiry
+}
+
+// Cache is an LRU map safe for concurrent use.
+type Cache struct {
+    mu         sync.Mutex
+    maxEntries int
+    maxBytes   int64
+    ttl        time.Duration
+    ll         *list.List // front = most recently used
+    items      map[string]*list.Element
+    bytes      int64
+    hits       int64
+    misses     int64
+    evictions  int64
+}
+
+// New returns a cache holding at most maxEntries values and maxBytes in
+// total; ttl is the default lifetime. Zero limits are unbounded.
+func New(maxEntries int, maxBytes int64, ttl time.Duration) *Cache {
+    return &Cache{maxEntries: maxEntries, maxBytes: maxBytes, ttl: ttl, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns the value for key if present and not expired.
+func (c *Cache) Get(key string) ([]byte, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    el := c.items[key]
+    if el == nil {
+        c.misses++
+        return nil, false
+    }
+    e := el.Value.(*entry)
+    if !e.expires.IsZero() && time.Now().After(e.expires) {
+        c.removeLocked(el)
+        c.misses++
+        return nil, false
+    }
+    c.ll.MoveToFront(el)
+    c.hits++
+    return e.val, true
+}
+
+// Put stores val under key for ttl (0 uses the cache default). Values larger
+// than the byte limit are not stored.
+func (c *Cache) Put(key string, val []byte, ttl time.Duration) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.maxBytes > 0 && int64(len(val)) > c.maxBytes {
+        return
+    }
+    if el := c.items[key]; el != nil {
+        c.removeLocked(el)
+    }
+    if ttl <= 0 {
+        ttl = c.ttl
+    }
+    e := &entry{key: key, val: val}
+    if ttl > 0 {
+        e.expires = time.Now().Add(ttl)
+    }
+    c.items[key] = c.ll.PushFront(e)
+    c.bytes += int64(len(val))
+    for c.ll.Len() > 0 && ((c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+        c.removeLocked(c.ll.Back())
+        c.evictions++
+    }
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+    e := c.ll.Remove(el).(*entry)
+    delete(c.items, e.key)
+    c.bytes -= int64(len(e.val))
+}
+
+// Purge removes entries whose key starts with prefix (all entries for an
+// empty prefix) and returns how many were removed.
+func (c *Cache) Purge(prefix string) int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    n := 0
+    for key, el := range c.items {
+        if strings.HasPrefix(key, prefix) {
+            c.removeLocked(el)
+            n++
+        }
+    }
+    return n
+}
+
+// Stats returns a snapshot of the counters.
+func (c *Cache) Stats() Stats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return Stats{
+        Entries: c.ll.Len(), Bytes: c.bytes, MaxEntries: c.maxEntries, MaxBytes: c.maxBytes,
+        Hits: c.hits, Misses: c.misses, Evictions: c.evictions,
+    }
+}
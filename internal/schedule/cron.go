@@ -0,0 +1,139 @@
+// Package schedule parses cron expressions for aitermd's scheduler.
+package schedule
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Cron is a parsed five-field expression: minute hour day-of-month month
+// day-of-week. Fields accept "*", numbers, ranges "a-b", lists "a,b" and
+// steps "*/n" or "a-b/n"; day-of-week 0 and 7 are Sunday. As in classic
+// cron, when both day fields are restricted a day matching either runs.
+type Cron struct {
+    minute, hour, dom, month, dow uint64 // bit i set = value i allowed
+    domAny, dowAny                bool
+}
+
+var descriptors = map[string]string{
+    "@yearly":   "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+    "@monthly":  "0 0 1 * *",
+    "@weekly":   "0 0 * * 0",
+    "@daily":    "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@hourly":   "0 * * * *",
+}
+
+// Parse parses expr, which may also be one of @yearly, @monthly, @weekly,
+// @daily, @midnight or @hourly.
+func Parse(expr string) (*Cron, error) {
+    if d, ok := descriptors[strings.TrimSpace(expr)]; ok {
+        expr = d
+    }
+    fields := strings.Fields(expr)
+    if len(fields) != 5 {
+        return nil, fmt.Errorf("cron %q: want 5 fields (minute hour day month weekday)", expr)
+    }
+    c := &Cron{}
+    bounds := []struct {
+        dst      *uint64
+        min, max int
+    }{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}}
+    for i, b := range bounds {
+        bits, err := parseField(fields[i], b.min, b.max)
+        if err != nil {
+            return nil, fmt.Errorf("cron %q: field %d: %w", expr, i+1, err)
+        }
+        *b.dst = bits
+    }
+    if c.dow&(1<<7) != 0 {
+        c.dow |= 1 // 7 is Sunday too
+    }
+    // a day field is unrestricted when it allows every day, however written
+    // ("*", "*/1", "1-31")
+    c.domAny = c.dom == span(1, 31)
+    c.dowAny = c.dow&span(0, 6) == span(0, 6)
+    return c, nil
+}
+
+func parseField(f string, min, max int) (uint64, error) {
+    var bits uint64
+    for _, part := range strings.Split(f, ",") {
+        rng, stepStr, hasStep := strings.Cut(part, "/")
+        step := 1
+        if hasStep {
+            n, err := strconv.Atoi(stepStr)
+            if err != nil || n <= 0 {
+                return 0, fmt.Errorf("bad step %q", stepStr)
+            }
+            step = n
+        }
+        lo, hi := min, max
+        if rng != "*" {
+            a, b, isRange := strings.Cut(rng, "-")
+            var err error
+            if lo, err = strconv.Atoi(a); err != nil {
+                return 0, fmt.Errorf("bad value %q", a)
+            }
+            hi = lo
+            if isRange {
+                if hi, err = strconv.Atoi(b); err != nil {
+                    return 0, fmt.Errorf("bad value %q", b)
+                }
+            } else if hasStep {
+                hi = max // "a/n" runs from a to the end
+            }
+        }
+        if lo < min || hi > max || lo > hi {
+            return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+        }
+        for v := lo; v <= hi; v += step {
+            bits |= 1 << uint(v)
+        }
+    }
+    return bits, nil
+}
+
+// span returns the bits min through max.
+func span(min, max int) uint64 {
+    return (1<<uint(max+1) - 1) &^ (1<<uint(min) - 1)
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+    dom := c.dom&(1<<uint(t.Day())) != 0
+    dow := c.dow&(1<<uint(t.Weekday())) != 0
+    switch {
+    case c.domAny && c.dowAny:
+        return true
+    case c.domAny:
+        return dow
+    case c.dowAny:
+        return dom
+    }
+    return dom || dow
+}
+
+// Next returns the first matching minute strictly after t, in t's location,
+// or the zero time if none exists within five years (e.g. "0 0 30 2 *").
+func (c *Cron) Next(t time.Time) time.Time {
+    t = t.Truncate(time.Minute).Add(time.Minute)
+    limit := t.AddDate(5, 0, 0)
+    for t.Before(limit) {
+        switch {
+        case c.month&(1<<uint(t.Month())) == 0:
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+        case !c.dayMatches(t):
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+        case c.hour&(1<<uint(t.Hour())) == 0:
+            t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+        case c.minute&(1<<uint(t.Minute())) == 0:
+            t = t.Add(time.Minute)
+        default:
+            return t
+        }
+    }
+    return time.Time{}
+}
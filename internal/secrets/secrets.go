@@ -0,0 +1,190 @@
+// Package secrets keeps named credentials inside aitermd. Clients refer to
+// them as {{secret:NAME}}; values are expanded at the last moment and
+// redacted from anything the daemon stores or returns.
+package secrets
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+)
+
+var refRe = regexp.MustCompile(`\{\{secret:([A-Za-z0-9_.-]+)\}\}`)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Store holds secret values by name.
+type Store struct {
+    mu     sync.RWMutex
+    values map[string]string
+}
+
+func NewStore() *Store { return &Store{values: map[string]string{}} }
+
+// LoadFile reads NAME=VALUE lines (blank lines and # comments ignored).
+func (s *Store) LoadFile(path string) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    sc := bufio.NewScanner(f)
+    line := 0
+    for sc.Scan() {
+        line++
+        text := strings.TrimSpace(sc.Text())
+        if text == "" || strings.HasPrefix(text, "#") {
+            continue
+        }
+        name, value, ok := strings.Cut(text, "=")
+        if !ok {
+            return fmt.Errorf("%s:%d: expected NAME=VALUE", path, line)
+        }
+        if err := s.Set(strings.TrimSpace(name), value); err != nil {
+            return fmt.Errorf("%s:%d: %w", path, line, err)
+        }
+    }
+    return sc.Err()
+}
+
+// Set stores or replaces a secret.
+func (s *Store) Set(name, value string) error {
+    if !nameRe.MatchString(name) {
+        return fmt.Errorf("invalid secret name %q", name)
+    }
+    if value == "" {
+        return fmt.Errorf("secret %s: empty value", name)
+    }
+    s.mu.Lock()
+    s.values[name] = value
+    s.mu.Unlock()
+    return nil
+}
+
+// Delete removes a secret; it reports whether it existed.
+func (s *Store) Delete(name string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, ok := s.values[name]
+    delete(s.values, name)
+    return ok
+}
+
+// Names lists stored secret names, sorted.
+func (s *Store) Names() []string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    out := make([]string, 0, len(s.values))
+    for k := range s.values {
+        out = append(out, k)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// Expand replaces {{secret:NAME}} references. Unknown names are an error.
+func (s *Store) Expand(in string) (string, error) {
+    if !strings.Contains(in, "{{secret:") {
+        return in, nil
+    }
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    var missing string
+    out := refRe.ReplaceAllStringFunc(in, func(ref string) string {
+        name := refRe.FindStringSubmatch(ref)[1]
+        v, ok := s.values[name]
+        if !ok && missing == "" {
+            missing = name
+        }
+        return v
+    })
+    if missing != "" {
+        return "", fmt.Errorf("unknown secret %q", missing)
+    }
+    return out, nil
+}
+
+// ExpandEnv expands references in every value of env, returning a new map.
+func (s *Store) ExpandEnv(env map[string]string) (map[string]string, error) {
+    if env == nil {
+        return nil, nil
+    }
+    out := make(map[string]string, len(env))
+    for k, v := range env {
+        ev, err := s.Expand(v)
+        if err != nil {
+            return nil, fmt.Errorf("env %s: %w", k, err)
+        }
+        out[k] = ev
+    }
+    return out, nil
+}
+
+// Redact replaces every secret value in data with [REDACTED:NAME].
+func (s *Store) Redact(data []byte) []byte {
+    n, out := s.RedactCount(data)
+    if n == 0 {
+        return data
+    }
+    return out
+}
+
+// RedactCount is Redact that also reports how many values were replaced.
+func (s *Store) RedactCount(data []byte) (int, []byte) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    if len(s.values) == 0 || len(data) == 0 {
+        return 0, data
+    }
+    count := 0
+    // longest values first so a secret containing another is replaced whole
+    for _, name := range s.byLength() {
+        v := []byte(s.values[name])
+        if c := bytes.Count(data, v); c > 0 {
+            count += c
+            data = bytes.ReplaceAll(data, v, []byte("[REDACTED:"+name+"]"))
+        }
+    }
+    return count, data
+}
+
+// PartialSuffix returns how many trailing bytes of data form a proper prefix
+// of some secret value, i.e. could complete into a secret in the next read.
+func (s *Store) PartialSuffix(data []byte) int {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    best := 0
+    for _, v := range s.values {
+        max := len(v) - 1
+        if max > len(data) {
+            max = len(data)
+        }
+        for n := max; n > best; n-- {
+            if bytes.HasSuffix(data, []byte(v[:n])) {
+                best = n
+                break
+            }
+        }
+    }
+    return best
+}
+
+// byLength returns names ordered by descending value length. Caller holds s.mu.
+func (s *Store) byLength() []string {
+    names := make([]string, 0, len(s.values))
+    for k := range s.values {
+        names = append(names, k)
+    }
+    sort.Slice(names, func(i, j int) bool {
+        if len(s.values[names[i]]) != len(s.values[names[j]]) {
+            return len(s.values[names[i]]) > len(s.values[names[j]])
+        }
+        return names[i] < names[j]
+    })
+    return names
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "ai-terminal/api"
+    "ai-terminal/internal/artifacts"
+    "ai-terminal/internal/term"
+)
+
+// spillBytes is a request's spill threshold: 0 takes the server default and
+// anything not positive disables spilling.
+func (s *Server) spillBytes(threshold int64) int64 {
+    if threshold == 0 { threshold = s.spill }
+    return max(threshold, 0)
+}
+
+// spillOutput returns b base64-encoded, or stores it as an artifact when it
+// exceeds the threshold (see spillBytes). A non-empty owner keeps the
+// artifact referenced.
+func (s *Server) spillOutput(b []byte, threshold int64, owner string) (string, string) {
+    threshold = s.spillBytes(threshold)
+    if threshold == 0 || int64(len(b)) <= threshold {
+        return base64.StdEncoding.EncodeToString(b), ""
+    }
+    id, _, err := s.artifacts.Put(bytes.NewReader(b), owner)
+    if err != nil {
+        return base64.StdEncoding.EncodeToString(b), ""
+    }
+    return "", id
+}
+
+// spoolJob stores a finished job's output streams that exceeded its spill
+// threshold; they were scrubbed as the job wrote them. They stay referenced
+// until the job is forgotten.
+func (s *Server) spoolJob(st term.JobStatus, files map[string]string) map[string]string {
+    out := map[string]string{}
+    for stream, name := range files {
+        if id, _, err := s.artifacts.PutFile(name, "job:"+st.ID); err == nil {
+            out[stream] = id
+        }
+        _ = os.Remove(name)
+    }
+    return out
+}
+
+// spillLog stores a closed session's log, every retained segment in order,
+// when it is larger than limit. The artifact is referenced by "log:<id>"
+// until the log TTL passes, then left to GC.
+func (s *Server) spillLog(id string, log io.WriterTo, limit int64) (string, error) {
+    tmp, err := os.CreateTemp("", "aiterm-log-*")
+    if err != nil {
+        return "", err
+    }
+    defer os.Remove(tmp.Name())
+    n, err := log.WriteTo(tmp)
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil || n <= limit {
+        return "", err
+    }
+    aid, _, err := s.artifacts.PutFile(tmp.Name(), "log:"+id)
+    if err == nil && s.logTTL > 0 { s.expireRef("log:"+id, time.Now(), s.logTTL) }
+    return aid, err
+}
+
+// runOwner returns the owner of a shell.run's spilled output and collected
+// files: the session for pty_id runs, otherwise "run:<id>", released after
+// -run-artifact-ttl; "" (unreferenced) when that is 0.
+func (s *Server) runOwner(ptyID string) string {
+    if ptyID != "" { return "pty:" + ptyID }
+    if s.runTTL <= 0 { return "" }
+    return "run:" + scheduleID()
+}
+
+// expireRef releases owner's references once ttl has passed since created.
+func (s *Server) expireRef(owner string, created time.Time, ttl time.Duration) {
+    time.AfterFunc(time.Until(created.Add(ttl)), func() { s.artifacts.Release(owner) })
+}
+
+// expireRefs schedules the release of log and run references kept from
+// before a restart.
+func (s *Server) expireRefs() {
+    list, _ := s.artifacts.List()
+    for _, in := range list {
+        for _, o := range in.Refs {
+            switch {
+            case strings.HasPrefix(o, "log:") && s.logTTL > 0:
+                s.expireRef(o, in.Created, s.logTTL)
+            case strings.HasPrefix(o, "run:"):
+                s.expireRef(o, in.Created, s.runTTL)
+            }
+        }
+    }
+}
+
+func artifactInfo(in artifacts.Info) api.ArtifactInfo {
+    return api.ArtifactInfo{ID: in.ID, Size: in.Size, CreatedMS: in.Created.UnixMilli(), AccessedMS: in.Accessed.UnixMilli(), Refs: in.Refs}
+}
+
+// handleArtifactGet streams an artifact's raw bytes. Both GET ?id= and POST
+// with a JSON body are accepted; Range headers are honoured either way.
+func (s *Server) handleArtifactGet(w http.ResponseWriter, r *http.Request) {
+    var req api.ArtifactGetRequest
+    switch r.Method {
+    case http.MethodGet, http.MethodHead:
+        req.ID = r.URL.Query().Get("id")
+    case http.MethodPost:
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+            return
+        }
+    default:
+        w.WriteHeader(http.StatusMethodNotAllowed)
+        return
+    }
+    f, err := s.artifacts.Open(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    defer f.Close()
+    st, err := f.Stat()
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    length := st.Size() - req.Offset
+    if req.Length > 0 && req.Length < length { length = req.Length }
+    if req.Offset < 0 || length < 0 {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "offset out of range"})
+        return
+    }
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Header().Set("X-Artifact-SHA256", req.ID)
+    http.ServeContent(w, r, "", st.ModTime(), io.NewSectionReader(f, req.Offset, length))
+}
+
+func (s *Server) handleArtifactStat(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ArtifactStatRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    in, err := s.artifacts.Stat(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, artifactInfo(in))
+}
+
+func (s *Server) handleArtifactList(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost && r.Method != http.MethodGet { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    list, total := s.artifacts.List()
+    out := api.ArtifactListResponse{Artifacts: make([]api.ArtifactInfo, 0, len(list)), TotalBytes: total, MaxBytes: s.artifactMax}
+    for _, in := range list {
+        out.Artifacts = append(out.Artifacts, artifactInfo(in))
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleArtifactDelete(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ArtifactDeleteRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if err := s.artifacts.Delete(req.ID, req.Force); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "sync"
+    "time"
+
+    "ai-terminal/api"
+)
+
+const (
+    defaultBatchParallel = 4
+    maxBatchParallel     = 64
+)
+
+func (s *Server) handleShellBatch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ShellBatchRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if len(req.Commands) == 0 {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "commands must not be empty"})
+        return
+    }
+    writeJSON(w, http.StatusOK, s.shellBatch(r.Context(), req))
+}
+
+// shellBatch runs the commands with at most MaxParallel in flight and
+// returns their results in request order. Once the deadline passes, or a
+// command fails with StopOnFailure set, commands not yet started are skipped.
+func (s *Server) shellBatch(ctx context.Context, req api.ShellBatchRequest) api.ShellBatchResponse {
+    start := time.Now()
+    parallel := req.MaxParallel
+    if parallel <= 0 { parallel = defaultBatchParallel }
+    if parallel > maxBatchParallel { parallel = maxBatchParallel }
+    if req.DeadlineMS > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, time.Duration(req.DeadlineMS)*time.Millisecond)
+        defer cancel()
+    }
+    // stop is closed on the first failure when StopOnFailure is set
+    stop := make(chan struct{})
+    var stopOnce sync.Once
+
+    results := make([]api.ShellBatchResult, len(req.Commands))
+    sem := make(chan struct{}, parallel)
+    var wg sync.WaitGroup
+    for i, cmd := range req.Commands {
+        // wait for a slot unless the batch is already over
+        select {
+        case sem <- struct{}{}:
+        case <-ctx.Done():
+        case <-stop:
+        }
+        if ctx.Err() != nil || stopped(stop) {
+            results[i].Skipped = true
+            continue
+        }
+        wg.Add(1)
+        go func(i int, cmd api.ShellRunRequest) {
+            defer wg.Done()
+            defer func() { <-sem }()
+            out, err := s.shellRun(ctx, cmd)
+            if err != nil {
+                out = api.ShellRunResponse{RC: -1, Error: err.Error()}
+            }
+            results[i].ShellRunResponse = out
+            if req.StopOnFailure && (out.RC != 0 || out.Error != "") {
+                stopOnce.Do(func() { close(stop) })
+            }
+        }(i, cmd)
+    }
+    wg.Wait()
+
+    resp := api.ShellBatchResponse{Results: results, DurationMS: time.Since(start).Milliseconds()}
+    for _, res := range results {
+        switch {
+        case res.Skipped:
+            resp.Skipped++
+        case res.RC != 0 || res.Error != "":
+            resp.Failed++
+        }
+    }
+    return resp
+}
+
+func stopped(ch chan struct{}) bool {
+    select {
+    case <-ch:
+        return true
+    default:
+        return false
+    }
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "time"
+
+    "ai-terminal/api"
+    "ai-terminal/internal/fsdiff"
+    "ai-terminal/internal/term"
+)
+
+// cacheKey hashes everything that determines a run's response: the command,
+// its effective environment and cwd, stdin, the declared input files and the
+// options that shape the output.
+func cacheKey(req api.ShellRunRequest, rreq term.RunRequest) (string, error) {
+    cwd := rreq.Cwd
+    if cwd == "" { cwd, _ = os.Getwd() }
+    inputs := map[string]string{}
+    for _, in := range req.Cache.Inputs {
+        p := in
+        if !filepath.IsAbs(p) { p = filepath.Join(cwd, p) }
+        sum, err := fsdiff.HashFile(p)
+        if err != nil {
+            return "", fmt.Errorf("cache input %q: %w", in, err)
+        }
+        inputs[in] = sum
+    }
+    stdin := sha256.Sum256(rreq.Stdin)
+    b, err := json.Marshal(struct {
+        Argv               []string
+        Pipeline           []term.PipelineStage
+        Env                map[string]string
+        Cwd                string
+        Stdin              string
+        Inputs             map[string]string
+        MaxStdout          int64
+        MaxStderr          int64
+        KeepTail           bool
+        KillAfterBytes     int64
+        SpillBytes         int64
+        Collect            []string
+        CollectInlineBytes int64
+        Parsers            []string
+        Retry              *api.ShellRunRetry
+        TTY                bool
+        Rows, Cols         int
+        Screen             bool
+    }{rreq.Argv, rreq.Pipeline, rreq.Env, cwd, hex.EncodeToString(stdin[:]), inputs,
+        rreq.MaxStdoutBytes, rreq.MaxStderrBytes, rreq.KeepTail, rreq.KillAfterBytes, req.SpillBytes, req.Collect, req.CollectInlineBytes, req.Parsers, req.Retry,
+        rreq.TTY, rreq.Rows, rreq.Cols, rreq.Screen})
+    if err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256(b)
+    return hex.EncodeToString(sum[:]), nil
+}
+
+// cachedRun returns a memoized response. Entries whose spilled or collected
+// artifacts have since been collected are dropped.
+func (s *Server) cachedRun(key string) (api.ShellRunResponse, bool) {
+    b, ok := s.cache.Get(key)
+    if !ok { return api.ShellRunResponse{}, false }
+    var out api.ShellRunResponse
+    if err := json.Unmarshal(b, &out); err != nil { return out, false }
+    ids := []string{out.StdoutArtifactID, out.StderrArtifactID}
+    for _, f := range out.Collected {
+        ids = append(ids, f.ArtifactID)
+    }
+    for _, id := range ids {
+        if _, err := s.artifacts.Stat(id); id != "" && err != nil {
+            s.cache.Purge(key)
+            return api.ShellRunResponse{}, false
+        }
+    }
+    out.Cached = true
+    return out, true
+}
+
+// storeRun memoizes a completed run. Results shaped by timing (timeouts,
+// kill limits) or failures to start are not cached.
+func (s *Server) storeRun(key string, out api.ShellRunResponse, ttl time.Duration) {
+    if out.Error != "" || out.TimedOut || out.LimitExceeded { return }
+    b, err := json.Marshal(out)
+    if err != nil { return }
+    s.cache.Put(key, b, ttl)
+}
+
+func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    if s.cache == nil {
+        writeJSON(w, http.StatusOK, api.CacheStatsResponse{})
+        return
+    }
+    st := s.cache.Stats()
+    writeJSON(w, http.StatusOK, api.CacheStatsResponse{
+        Entries: st.Entries, Bytes: st.Bytes, MaxEntries: st.MaxEntries, MaxBytes: st.MaxBytes,
+        Hits: st.Hits, Misses: st.Misses, Evictions: st.Evictions,
+    })
+}
+
+func (s *Server) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    if s.cache == nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cache is disabled on this server (-cache-entries 0)"})
+        return
+    }
+    var req api.CachePurgeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, api.CachePurgeResponse{Purged: s.cache.Purge(req.Key)})
+}
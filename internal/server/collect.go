@@ -0,0 +1,166 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "slices"
+    "sort"
+    "strings"
+
+    "ai-terminal/api"
+)
+
+const (
+    defaultCollectInline = 1 << 20 // total bytes inlined per run
+    maxCollectFiles      = 1000
+    maxCollectVisit      = 100000 // directory entries examined per run
+)
+
+// hasArtifacts reports whether a shell.run response refers to any artifact.
+func hasArtifacts(out api.ShellRunResponse) bool {
+    if out.StdoutArtifactID != "" || out.StderrArtifactID != "" { return true }
+    for _, f := range out.Collected {
+        if f.ArtifactID != "" { return true }
+    }
+    return false
+}
+
+// checkGlobs rejects malformed collect patterns before the command runs.
+func checkGlobs(globs []string) error {
+    for _, g := range globs {
+        if g == "" || filepath.IsAbs(g) {
+            return fmt.Errorf("collect %q: patterns must be relative to cwd", g)
+        }
+        for _, seg := range strings.Split(path.Clean(g), "/") {
+            if seg == ".." {
+                return fmt.Errorf("collect %q: patterns must stay inside cwd", g)
+            }
+            if _, err := path.Match(seg, ""); err != nil {
+                return fmt.Errorf("collect %q: %w", g, err)
+            }
+        }
+    }
+    return nil
+}
+
+// matchGlob matches a slash-separated relative path against pattern, where a
+// "**" segment matches any number of directories.
+func matchGlob(pattern, rel []string) bool {
+    for len(pattern) > 0 {
+        if pattern[0] == "**" {
+            for i := 0; i <= len(rel); i++ {
+                if matchGlob(pattern[1:], rel[i:]) {
+                    return true
+                }
+            }
+            return false
+        }
+        if len(rel) == 0 {
+            return false
+        }
+        if ok, _ := path.Match(pattern[0], rel[0]); !ok {
+            return false
+        }
+        pattern, rel = pattern[1:], rel[1:]
+    }
+    return len(rel) == 0
+}
+
+// globFiles returns regular files under cwd matching any of globs, sorted,
+// and whether the result is incomplete: more than limit matched, or the
+// search gave up after visiting maxCollectVisit entries.
+func globFiles(cwd string, globs []string, limit int) ([]string, bool) {
+    seen := map[string]bool{}
+    var out []string
+    visited, truncated := 0, false
+    for _, g := range globs {
+        pat := strings.Split(path.Clean(g), "/")
+        // walk from the literal prefix of the pattern, no deeper than it reaches
+        lit := 0
+        for lit < len(pat)-1 && !strings.ContainsAny(pat[lit], "*?[") {
+            lit++
+        }
+        fixed := len(pat) // segments before any "**"
+        if i := slices.Index(pat, "**"); i >= 0 { fixed = i }
+        root := filepath.Join(cwd, filepath.Join(pat[:lit]...))
+        _ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+            if visited++; visited > maxCollectVisit {
+                truncated = true
+                return fs.SkipAll
+            }
+            rel, _ := filepath.Rel(cwd, p)
+            if err != nil || rel == "." {
+                return nil
+            }
+            rel = filepath.ToSlash(rel)
+            segs := strings.Split(rel, "/")
+            if d.IsDir() {
+                // skip directories the pattern cannot descend into
+                for i := lit; i < min(len(segs), fixed); i++ {
+                    if ok, _ := path.Match(pat[i], segs[i]); !ok || (fixed == len(pat) && i == len(pat)-1) {
+                        return fs.SkipDir
+                    }
+                }
+                return nil
+            }
+            if seen[rel] || !d.Type().IsRegular() || !matchGlob(pat, segs) {
+                return nil
+            }
+            seen[rel] = true
+            out = append(out, rel)
+            return nil
+        })
+    }
+    sort.Strings(out)
+    if len(out) > limit {
+        return out[:limit], true
+    }
+    return out, truncated
+}
+
+// collectFiles gathers files matching globs under cwd. Files are inlined
+// while the inline budget lasts (a negative budget never inlines) and
+// stored as artifacts referenced by owner otherwise.
+func (s *Server) collectFiles(cwd string, globs []string, budget int64, owner string) ([]api.CollectedFile, bool) {
+    if cwd == "" {
+        cwd, _ = os.Getwd()
+    }
+    if budget == 0 {
+        budget = defaultCollectInline
+    }
+    files, truncated := globFiles(cwd, globs, maxCollectFiles)
+    out := make([]api.CollectedFile, 0, len(files))
+    for _, rel := range files {
+        p := filepath.Join(cwd, rel)
+        st, err := os.Stat(p)
+        if err != nil {
+            continue
+        }
+        cf := api.CollectedFile{Path: rel, Size: st.Size(), Mode: st.Mode().String()}
+        if st.Size() <= budget {
+            data, err := os.ReadFile(p)
+            if err == nil && int64(len(data)) <= budget {
+                sum := sha256.Sum256(data)
+                cf.Size, cf.SHA256 = int64(len(data)), hex.EncodeToString(sum[:])
+                cf.DataB64 = base64.StdEncoding.EncodeToString(data)
+                budget -= int64(len(data))
+                out = append(out, cf)
+                continue
+            }
+        }
+        id, n, err := s.artifacts.PutFile(p, owner)
+        if err != nil {
+            cf.Error = err.Error()
+        } else {
+            cf.Size, cf.SHA256, cf.ArtifactID = n, id, id
+        }
+        out = append(out, cf)
+    }
+    return out, truncated
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "time"
+
+    "ai-terminal/api"
+    "ai-terminal/internal/diag"
+    "ai-terminal/internal/term"
+)
+
+func jobStatus(st term.JobStatus) api.JobStatus {
+    end := st.EndedAt
+    if end.IsZero() { end = time.Now() }
+    return api.JobStatus{
+        ID: st.ID, Argv: st.Argv, Cwd: st.Cwd, State: st.State, Done: st.Done(), RC: st.RC,
+        StartedAtMS: st.StartedAt.UnixMilli(), DurationMS: end.Sub(st.StartedAt).Milliseconds(), Error: st.Err,
+        Signal: exitSignal(st.Exit.Signal, st.Exit.SignalNum), CoreDumped: st.Exit.CoreDumped, Usage: processUsage(st.Usage),
+        StdoutBytes: st.StdoutTotal, StderrBytes: st.StderrTotal, StdoutTruncated: st.StdoutTruncated, StderrTruncated: st.StderrTruncated,
+        LimitExceeded:    st.LimitExceeded,
+        StdoutArtifactID: st.Artifacts["stdout"], StderrArtifactID: st.Artifacts["stderr"],
+    }
+}
+
+func (s *Server) handleJobStart(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.JobStartRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    rreq, _, err := s.runRequest(req.ShellRunRequest)
+    if err == nil && len(req.Collect) > 0 {
+        err = errors.New("collect is only supported by shell.run")
+    }
+    if err == nil && req.Track != nil {
+        err = errors.New("track is only supported by shell.run")
+    }
+    if err == nil && req.Cache != nil {
+        err = errors.New("cache is only supported by shell.run")
+    }
+    if err == nil && req.Retry != nil {
+        err = errors.New("retry is only supported by shell.run")
+    }
+    if err == nil && req.TTY {
+        err = errors.New("tty is only supported by shell.run; use /v1/pty/open")
+    }
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    rreq.SpoolBytes = s.spillBytes(req.SpillBytes)
+    id, err := s.jobs.Start(rreq)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, api.JobStartResponse{ID: id})
+}
+
+func (s *Server) handleJobRead(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.JobReadRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if err := diag.Validate(req.Parsers); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    timeout := time.Duration(req.TimeoutMS) * time.Millisecond
+    chunks, done, err := s.jobs.Read(req.ID, req.SinceSeq, req.MaxBytes, timeout)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    out := api.JobReadResponse{Chunks: make([]api.PTYChunk, 0, len(chunks)), Done: done}
+    counts := map[string]int{}
+    for _, c := range chunks {
+        s.countRedactions(c.Data, counts)
+        out.Chunks = append(out.Chunks, api.PTYChunk{
+            Seq: c.Seq, Stream: c.Stream, Ts: c.Ts.UnixMilli(), Data: base64.StdEncoding.EncodeToString(c.Data),
+        })
+    }
+    out.Diagnostics = s.jobDiagnostics(req.ID, req.Parsers)
+    if len(counts) > 0 { out.Redactions = counts }
+    writeJSON(w, http.StatusOK, out)
+}
+
+// jobDiagnostics parses a job's whole output rather than one read's chunks:
+// the spilled artifact of a finished stream, the retained chunks otherwise.
+func (s *Server) jobDiagnostics(id string, parsers []string) []api.Diagnostic {
+    if len(parsers) == 0 { return nil }
+    st, err := s.jobs.Status(id)
+    if err != nil { return nil }
+    chunks, _, _ := s.jobs.Read(id, 0, 0, 0)
+    streams := map[string][]byte{}
+    for _, c := range chunks {
+        streams[c.Stream] = append(streams[c.Stream], c.Data...)
+    }
+    for stream, aid := range st.Artifacts {
+        if f, err := s.artifacts.Open(aid); err == nil {
+            if b, err := io.ReadAll(f); err == nil { streams[stream] = b }
+            f.Close()
+        }
+    }
+    return diagnostics(parsers, streams["stdout"], streams["stderr"])
+}
+
+func (s *Server) handleJobWait(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.JobWaitRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if err := diag.Validate(req.Parsers); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    st, err := s.jobs.Wait(req.ID, time.Duration(req.TimeoutMS)*time.Millisecond)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    out := jobStatus(st)
+    out.Diagnostics = s.jobDiagnostics(req.ID, req.Parsers)
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleJobCancel(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.JobCancelRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    st, err := s.jobs.Cancel(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, jobStatus(st))
+}
+
+func (s *Server) handleJobList(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    list := s.jobs.List()
+    out := api.JobListResponse{Jobs: make([]api.JobStatus, 0, len(list))}
+    for _, st := range list {
+        out.Jobs = append(out.Jobs, jobStatus(st))
+    }
+    writeJSON(w, http.StatusOK, out)
+}
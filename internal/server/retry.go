@@ -0,0 +1,138 @@
+package server
+
+import (
+    "context"
+    "encoding/base64"
+    "errors"
+    "math/rand"
+    "regexp"
+    "slices"
+    "time"
+
+    "ai-terminal/api"
+    "ai-terminal/internal/term"
+)
+
+const (
+    defaultRetryAttempts = 3
+    maxRetryAttempts     = 20
+    defaultRetryBackoff  = 200 * time.Millisecond
+    defaultRetryMax      = 10 * time.Second
+    defaultRetryJitter   = 0.2
+    // retryOutputBytes is the tail of each stream kept per attempt.
+    retryOutputBytes = 4 << 10
+)
+
+// retryPolicy is a validated api.ShellRunRetry with defaults applied.
+type retryPolicy struct {
+    attempts   int
+    backoff    time.Duration
+    maxBackoff time.Duration
+    jitter     float64
+    codes      []int
+    stderr     *regexp.Regexp
+    timeout    time.Duration // per attempt; 0 keeps the request's timeout
+}
+
+func checkRetry(r *api.ShellRunRetry) (*retryPolicy, error) {
+    if r == nil {
+        return nil, nil
+    }
+    p := &retryPolicy{
+        attempts:   r.MaxAttempts,
+        backoff:    time.Duration(r.BackoffMS) * time.Millisecond,
+        maxBackoff: time.Duration(r.MaxBackoffMS) * time.Millisecond,
+        jitter:     defaultRetryJitter,
+        codes:      r.OnExitCodes,
+        timeout:    time.Duration(r.AttemptTimeoutMS) * time.Millisecond,
+    }
+    if p.attempts <= 0 { p.attempts = defaultRetryAttempts }
+    if p.attempts > maxRetryAttempts {
+        return nil, errors.New("retry.max_attempts must be at most 20")
+    }
+    if p.backoff <= 0 { p.backoff = defaultRetryBackoff }
+    if p.maxBackoff <= 0 { p.maxBackoff = defaultRetryMax }
+    if p.maxBackoff < p.backoff { p.maxBackoff = p.backoff }
+    if r.Jitter != nil {
+        if *r.Jitter < 0 || *r.Jitter > 1 {
+            return nil, errors.New("retry.jitter must be between 0 and 1")
+        }
+        p.jitter = *r.Jitter
+    }
+    if r.StderrRegex != "" {
+        re, err := regexp.Compile(r.StderrRegex)
+        if err != nil {
+            return nil, err
+        }
+        p.stderr = re
+    }
+    return p, nil
+}
+
+// retryable reports whether a failed attempt should be tried again.
+func (p *retryPolicy) retryable(res term.RunResult) bool {
+    if res.RC == 0 {
+        return false
+    }
+    if len(p.codes) == 0 && p.stderr == nil {
+        return true
+    }
+    return slices.Contains(p.codes, res.RC) || (p.stderr != nil && p.stderr.Match(res.Stderr))
+}
+
+// delay is the wait after attempt n (1-based), jittered by ±p.jitter.
+func (p *retryPolicy) delay(n int) time.Duration {
+    d := p.backoff
+    for i := 1; i < n && d < p.maxBackoff; i++ {
+        d *= 2
+    }
+    d = min(d, p.maxBackoff)
+    if p.jitter > 0 {
+        d += time.Duration((rand.Float64()*2 - 1) * p.jitter * float64(d))
+    }
+    return d
+}
+
+// runWithRetry runs rreq until it succeeds, a failure is not retryable,
+// attempts run out or ctx ends. It returns the last result and a summary
+// of every attempt (nil without a policy).
+func (s *Server) runWithRetry(ctx context.Context, rreq term.RunRequest, p *retryPolicy) (term.RunResult, []api.ShellRunAttempt, error) {
+    if p == nil {
+        res, err := term.ShellRun(ctx, rreq)
+        return res, nil, err
+    }
+    if p.timeout > 0 { rreq.Timeout = p.timeout }
+    var attempts []api.ShellRunAttempt
+    for n := 1; ; n++ {
+        res, err := term.ShellRun(ctx, rreq)
+        a := api.ShellRunAttempt{
+            Attempt: n, RC: res.RC, Signal: exitSignal(res.Signal, res.SignalNum), TimedOut: res.TimedOut,
+            DurationMS: res.Duration.Milliseconds(),
+        }
+        a.StdoutB64, a.StdoutTruncated = s.attemptOutput(res.Stdout, res.StdoutTruncated)
+        a.StderrB64, a.StderrTruncated = s.attemptOutput(res.Stderr, res.StderrTruncated)
+        if err != nil { a.Error = err.Error() }
+        if n >= p.attempts || !p.retryable(res) || ctx.Err() != nil {
+            return res, append(attempts, a), err
+        }
+        d := p.delay(n)
+        t := time.NewTimer(d)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return res, append(attempts, a), err
+        case <-t.C:
+        }
+        a.Retried, a.BackoffMS = true, d.Milliseconds()
+        attempts = append(attempts, a)
+    }
+}
+
+// attemptOutput scrubs b and keeps its last retryOutputBytes.
+func (s *Server) attemptOutput(b []byte, truncated bool) (string, bool) {
+    b = s.scrubOutput(b, map[string]int{})
+    if len(b) > retryOutputBytes {
+        b, truncated = b[len(b)-retryOutputBytes:], true
+    }
+    return base64.StdEncoding.EncodeToString(b), truncated
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "os"
+    "sort"
+    "sync"
+    "time"
+
+    "ai-terminal/api"
+    "ai-terminal/internal/diag"
+    "ai-terminal/internal/fsdiff"
+    "ai-terminal/internal/schedule"
+)
+
+const (
+    defaultScheduleHistory = 20
+    maxScheduleHistory     = 200
+    // maxScheduleHistoryBytes bounds the output a schedule's history holds;
+    // older runs are dropped past it, the newest is always kept.
+    maxScheduleHistoryBytes = 8 << 20
+    minScheduleInterval    = time.Second
+    defaultWatchPoll       = time.Second
+)
+
+// scheduled is one schedule: its spec, counters, bounded history and the
+// goroutine that fires it.
+type scheduled struct {
+    id      string
+    created time.Time
+    ctx     context.Context // canceled on delete; runs use it
+    cancel  context.CancelFunc
+    update  sync.Mutex // held across stop and start so updates don't interleave
+
+    mu       sync.Mutex
+    spec     api.ScheduleSpec
+    stopLoop context.CancelFunc
+    loopDone chan struct{}
+    next     time.Time
+    running  bool
+    runs     int64
+    failures int64
+    skipped  int64
+    history  []api.ScheduleRun // newest first
+}
+
+// schedules holds every schedule by ID.
+type schedules struct {
+    mu   sync.Mutex
+    byID map[string]*scheduled
+}
+
+func scheduleID() string {
+    b := make([]byte, 4)
+    _, _ = rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// checkSchedule validates spec and fills defaults.
+func (s *Server) checkSchedule(spec *api.ScheduleSpec) (*schedule.Cron, error) {
+    var c *schedule.Cron
+    if spec.Cron != "" {
+        var err error
+        if c, err = schedule.Parse(spec.Cron); err != nil {
+            return nil, err
+        }
+    }
+    if spec.Cron == "" && spec.IntervalMS == 0 && len(spec.Watch) == 0 {
+        return nil, errors.New("schedule needs cron, interval_ms or watch")
+    }
+    if spec.IntervalMS != 0 && time.Duration(spec.IntervalMS)*time.Millisecond < minScheduleInterval {
+        return nil, errors.New("interval_ms must be at least 1000")
+    }
+    if spec.HistoryLimit <= 0 { spec.HistoryLimit = defaultScheduleHistory }
+    if spec.HistoryLimit > maxScheduleHistory { spec.HistoryLimit = maxScheduleHistory }
+    if spec.WatchPollMS <= 0 { spec.WatchPollMS = defaultWatchPoll.Milliseconds() }
+    if _, _, err := s.runRequest(spec.Run); err != nil {
+        return nil, err
+    }
+    if err := checkGlobs(spec.Run.Collect); err != nil {
+        return nil, err
+    }
+    if err := diag.Validate(spec.Run.Parsers); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// start (re)starts the trigger loop for the current spec.
+func (sc *scheduled) start(s *Server, c *schedule.Cron) {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+    sc.next = time.Time{}
+    if sc.spec.Paused {
+        sc.stopLoop, sc.loopDone = nil, nil
+        return
+    }
+    ctx, stop := context.WithCancel(sc.ctx)
+    sc.stopLoop, sc.loopDone = stop, make(chan struct{})
+    go s.scheduleLoop(ctx, sc, sc.spec, c, sc.loopDone)
+}
+
+// stop ends the trigger loop; a run in progress continues.
+func (sc *scheduled) stop() {
+    sc.mu.Lock()
+    stop, done := sc.stopLoop, sc.loopDone
+    sc.mu.Unlock()
+    if stop != nil {
+        stop()
+        <-done
+    }
+}
+
+func (s *Server) scheduleLoop(ctx context.Context, sc *scheduled, spec api.ScheduleSpec, c *schedule.Cron, done chan struct{}) {
+    defer close(done)
+    interval := time.Duration(spec.IntervalMS) * time.Millisecond
+    lastInterval := time.Now()
+    var watch *fsdiff.Options
+    var snap *fsdiff.Snapshot
+    var poll <-chan time.Time
+    if len(spec.Watch) > 0 {
+        watch = &fsdiff.Options{Roots: spec.Watch, Dir: spec.Run.Cwd}
+        if watch.Dir == "" { watch.Dir, _ = os.Getwd() }
+        snap, _ = fsdiff.Take(*watch)
+        t := time.NewTicker(time.Duration(spec.WatchPollMS) * time.Millisecond)
+        defer t.Stop()
+        poll = t.C
+    }
+    for {
+        var next time.Time
+        trigger := ""
+        if c != nil {
+            next, trigger = c.Next(time.Now()), "cron"
+        }
+        if interval > 0 {
+            if n := lastInterval.Add(interval); next.IsZero() || n.Before(next) {
+                next, trigger = n, "interval"
+            }
+        }
+        sc.mu.Lock()
+        sc.next = next
+        sc.mu.Unlock()
+        var timer *time.Timer
+        var fire <-chan time.Time
+        if !next.IsZero() {
+            timer = time.NewTimer(time.Until(next))
+            fire = timer.C
+        }
+        select {
+        case <-ctx.Done():
+            if timer != nil { timer.Stop() }
+            return
+        case <-fire:
+            if trigger == "interval" { lastInterval = next }
+            s.fireSchedule(sc, spec, trigger)
+        case <-poll:
+            after, err := fsdiff.Take(*watch)
+            if err != nil || snap == nil {
+                snap = after
+                break
+            }
+            d := fsdiff.Diff(snap, after)
+            snap = after
+            if len(d.Created)+len(d.Modified)+len(d.Deleted) > 0 {
+                s.fireSchedule(sc, spec, "watch")
+            }
+        }
+        if timer != nil { timer.Stop() }
+    }
+}
+
+// fireSchedule starts a run unless the previous one is still going.
+func (s *Server) fireSchedule(sc *scheduled, spec api.ScheduleSpec, trigger string) {
+    sc.mu.Lock()
+    if sc.running {
+        sc.skipped++
+        sc.mu.Unlock()
+        return
+    }
+    sc.running = true
+    sc.mu.Unlock()
+    go func() {
+        started := time.Now()
+        res, err := s.shellRun(sc.ctx, spec.Run)
+        if err != nil {
+            res = api.ShellRunResponse{RC: -1, Error: err.Error()}
+        }
+        run := api.ScheduleRun{StartedAtMS: started.UnixMilli(), Trigger: trigger, Result: res}
+        sc.mu.Lock()
+        defer sc.mu.Unlock()
+        sc.running = false
+        sc.runs++
+        if res.RC != 0 || res.Error != "" { sc.failures++ }
+        sc.history = append([]api.ScheduleRun{run}, sc.history...)
+        sc.trimHistory()
+    }()
+}
+
+// outputSize is the inline output a run result holds: its streams, stage
+// stderr and collected file contents.
+func outputSize(r api.ShellRunResponse) int {
+    n := len(r.StdoutB64) + len(r.StderrB64)
+    for _, st := range r.Stages { n += len(st.StderrB64) }
+    for _, f := range r.Collected { n += len(f.DataB64) }
+    return n
+}
+
+// trimHistory drops the oldest runs past the history limit or the byte
+// budget. sc.mu must be held.
+func (sc *scheduled) trimHistory() {
+    n, size := 0, 0
+    for ; n < len(sc.history) && n < sc.spec.HistoryLimit; n++ {
+        size += outputSize(sc.history[n].Result)
+        if n > 0 && size > maxScheduleHistoryBytes { break }
+    }
+    clear(sc.history[n:])
+    sc.history = sc.history[:n]
+}
+
+func (sc *scheduled) status(withHistory bool) api.Schedule {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+    out := api.Schedule{
+        ID: sc.id, Spec: sc.spec, CreatedAtMS: sc.created.UnixMilli(), Running: sc.running,
+        Runs: sc.runs, Failures: sc.failures, Skipped: sc.skipped,
+    }
+    if !sc.next.IsZero() { out.NextRunMS = sc.next.UnixMilli() }
+    if len(sc.history) > 0 {
+        last := sc.history[0]
+        out.LastRun = &last
+    }
+    if withHistory { out.History = append([]api.ScheduleRun(nil), sc.history...) }
+    return out
+}
+
+func (s *Server) getSchedule(id string) (*scheduled, error) {
+    s.schedules.mu.Lock()
+    defer s.schedules.mu.Unlock()
+    sc := s.schedules.byID[id]
+    if sc == nil {
+        return nil, errors.New("no such schedule")
+    }
+    return sc, nil
+}
+
+func (s *Server) handleScheduleCreate(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ScheduleCreateRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    c, err := s.checkSchedule(&req.ScheduleSpec)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    sc := &scheduled{id: scheduleID(), created: time.Now(), ctx: ctx, cancel: cancel, spec: req.ScheduleSpec}
+    s.schedules.mu.Lock()
+    s.schedules.byID[sc.id] = sc
+    s.schedules.mu.Unlock()
+    sc.start(s, c)
+    writeJSON(w, http.StatusOK, sc.status(false))
+}
+
+func (s *Server) handleScheduleGet(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ScheduleIDRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    sc, err := s.getSchedule(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, sc.status(true))
+}
+
+func (s *Server) handleScheduleList(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    s.schedules.mu.Lock()
+    list := make([]*scheduled, 0, len(s.schedules.byID))
+    for _, sc := range s.schedules.byID {
+        list = append(list, sc)
+    }
+    s.schedules.mu.Unlock()
+    sort.Slice(list, func(a, b int) bool { return list[a].created.Before(list[b].created) })
+    out := api.ScheduleListResponse{Schedules: make([]api.Schedule, 0, len(list))}
+    for _, sc := range list {
+        out.Schedules = append(out.Schedules, sc.status(false))
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleScheduleUpdate(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ScheduleUpdateRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    sc, err := s.getSchedule(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    c, err := s.checkSchedule(&req.Spec)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    sc.update.Lock()
+    sc.stop()
+    sc.mu.Lock()
+    sc.spec = req.Spec
+    sc.trimHistory()
+    sc.mu.Unlock()
+    sc.start(s, c)
+    sc.update.Unlock()
+    writeJSON(w, http.StatusOK, sc.status(false))
+}
+
+// handleScheduleDelete stops the schedule and cancels a run in progress.
+func (s *Server) handleScheduleDelete(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ScheduleIDRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    s.schedules.mu.Lock()
+    sc := s.schedules.byID[req.ID]
+    delete(s.schedules.byID, req.ID)
+    s.schedules.mu.Unlock()
+    if sc == nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no such schedule"})
+        return
+    }
+    sc.update.Lock()
+    sc.stop()
+    sc.update.Unlock()
+    sc.cancel()
+    writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "ai-terminal/api"
+)
+
+// adminOK checks the bearer token when one is configured.
+func (s *Server) adminOK(w http.ResponseWriter, r *http.Request) bool {
+    if s.adminToken == "" {
+        return true
+    }
+    tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if subtle.ConstantTimeCompare([]byte(tok), []byte(s.adminToken)) != 1 {
+        writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "admin token required"})
+        return false
+    }
+    return true
+}
+
+func (s *Server) handleSecretsSet(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    if !s.adminOK(w, r) { return }
+    var req api.SecretSetRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if err := s.secrets.Set(req.Name, req.Value); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleSecretsDelete(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    if !s.adminOK(w, r) { return }
+    var req api.SecretDeleteRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if !s.secrets.Delete(req.Name) {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no such secret"})
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+func (s *Server) handleSecretsList(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    if !s.adminOK(w, r) { return }
+    writeJSON(w, http.StatusOK, api.SecretListResponse{Names: s.secrets.Names()})
+}
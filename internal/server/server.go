@@ -1,39 +1,204 @@
 package server
 
 import (
+    "bytes"
+    "context"
     "encoding/base64"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
     "os"
     "os/exec"
     "net/http"
     "path/filepath"
+    "regexp"
+    "slices"
     "strings"
     "time"
 
     "ai-terminal/api"
+    "ai-terminal/internal/artifacts"
+    "ai-terminal/internal/diag"
+    "ai-terminal/internal/envpolicy"
+    "ai-terminal/internal/fsdiff"
+    "ai-terminal/internal/redact"
+    "ai-terminal/internal/runcache"
+    "ai-terminal/internal/secrets"
     "ai-terminal/internal/term"
 )
 
-type Server struct { pty *term.PTYManager }
+type Server struct {
+    pty         *term.PTYManager
+    jobs        *term.JobManager
+    secrets     *secrets.Store
+    adminToken  string
+    redact      *redact.Pipeline
+    redactReads bool
+    maxOutput   int64
+    killGrace   time.Duration
+    env         envpolicy.Policy
+    envFileDir  string
+    artifacts   *artifacts.Store
+    artifactMax int64
+    spill       int64
+    logTTL      time.Duration
+    runTTL      time.Duration
+    cache       *runcache.Cache // nil when caching is disabled
+    schedules   schedules
+    services    *term.ServiceManager
+}
+
+// Config holds daemon-wide settings; zero values select defaults.
+type Config struct {
+    SessionLog  term.LogRotation
+    HistoryPath string // JSON-lines registry of closed PTY sessions; empty disables
+    SecretsFile string // NAME=VALUE file loaded into the secret store at startup
+    AdminToken  string // bearer token required by /v1/secrets/*; empty leaves them open
+    // Redaction filters applied to session logs and shell.run output.
+    RedactBuiltins bool
+    RedactPatterns []string // regexps, optionally "name=regexp"
+    RedactReads    bool     // apply filters to pty.read unless the request says otherwise
+    MaxOutputBytes int64    // default per-stream cap for shell.run output; 0 = unlimited
+    // KillGrace is the SIGTERM to SIGKILL delay when process groups are torn down.
+    KillGrace time.Duration
+    // Env is the default environment policy for shell.run, jobs and pty.open.
+    Env envpolicy.Policy
+    // EnvFileDir is the only directory request env_policy files may be read
+    // from; "" rejects request files.
+    EnvFileDir string
+    // ArtifactDir stores collected files and spilled output, keyed by sha256.
+    ArtifactDir      string
+    ArtifactMaxBytes int64 // unreferenced artifacts are collected above this total; 0 = unlimited
+    // SpillBytes moves larger shell.run output, job output and closed session
+    // logs into the artifact store; 0 leaves spilling to requests that set
+    // spill_bytes.
+    SpillBytes int64
+    // LogArtifactTTL is how long a spilled session log stays pinned before
+    // GC may collect it; 0 keeps it until deleted.
+    LogArtifactTTL time.Duration
+    // RunArtifactTTL is how long spilled output and collected files of a
+    // shell.run without pty_id stay pinned; 0 leaves them unreferenced.
+    RunArtifactTTL time.Duration
+    // Memoized shell.run results (requests opt in with "cache"); CacheEntries 0 disables.
+    CacheEntries  int
+    CacheMaxBytes int64
+    CacheTTL      time.Duration
+}
 
-func New() *Server { return &Server{pty: term.NewPTYManager()} }
+// DefaultConfig returns the settings used by New.
+func DefaultConfig() Config {
+    return Config{
+        SessionLog:       term.DefaultLogRotation(),
+        HistoryPath:      "/tmp/aiterm/history.jsonl",
+        RedactBuiltins:   true,
+        MaxOutputBytes:   16 << 20,
+        KillGrace:        term.DefaultKillGrace,
+        Env:              envpolicy.Policy{Mode: envpolicy.ModeEmpty},
+        ArtifactDir:      "/tmp/aiterm/artifacts",
+        ArtifactMaxBytes: 1 << 30,
+        LogArtifactTTL:   24 * time.Hour,
+        RunArtifactTTL:   time.Hour,
+        CacheEntries:     256,
+        CacheMaxBytes:    64 << 20,
+        CacheTTL:         10 * time.Minute,
+    }
+}
+
+func New() *Server {
+    s, _ := NewWithConfig(DefaultConfig()) // defaults load no files
+    return s
+}
+
+// NewWithConfig builds a server using cfg.
+func NewWithConfig(cfg Config) (*Server, error) {
+    store := secrets.NewStore()
+    if cfg.SecretsFile != "" {
+        if err := store.LoadFile(cfg.SecretsFile); err != nil {
+            return nil, err
+        }
+    }
+    // surface bad modes, presets and unreadable env files at startup
+    if _, err := cfg.Env.Environ(nil, nil); err != nil {
+        return nil, err
+    }
+    filters, err := redact.New(cfg.RedactBuiltins, cfg.RedactPatterns)
+    if err != nil {
+        return nil, err
+    }
+    pty := term.NewPTYManager()
+    pty.SetLogRotation(cfg.SessionLog)
+    pty.SetRedactor(store)
+    pty.SetExpander(store)
+    pty.SetKillGrace(cfg.KillGrace)
+    if !filters.Empty() {
+        pty.SetLogFilter(filters)
+    }
+    if cfg.HistoryPath != "" {
+        pty.SetHistory(term.NewHistory(cfg.HistoryPath))
+    }
+    arts := artifacts.NewStore(cfg.ArtifactDir)
+    arts.SetMaxBytes(cfg.ArtifactMaxBytes)
+    s := &Server{pty: pty, jobs: term.NewJobManager(), secrets: store, adminToken: cfg.AdminToken, redact: filters, redactReads: cfg.RedactReads, maxOutput: cfg.MaxOutputBytes, killGrace: cfg.KillGrace, env: cfg.Env, envFileDir: cfg.EnvFileDir, artifacts: arts, artifactMax: cfg.ArtifactMaxBytes, spill: cfg.SpillBytes, logTTL: cfg.LogArtifactTTL, runTTL: cfg.RunArtifactTTL}
+    s.expireRefs()
+    s.jobs.SetRedactor(outputScrubber{s})
+    s.jobs.SetSpool(filepath.Join(cfg.ArtifactDir, "spool"), s.spoolJob)
+    s.jobs.SetOnForget(func(id string) { s.artifacts.Release("job:" + id) })
+    s.schedules.byID = map[string]*scheduled{}
+    s.services = term.NewServiceManager()
+    s.services.SetRedactor(outputScrubber{s})
+    if cfg.CacheEntries > 0 {
+        s.cache = runcache.New(cfg.CacheEntries, cfg.CacheMaxBytes, cfg.CacheTTL)
+    }
+    return s, nil
+}
 
 func (s *Server) Handler() http.Handler {
     mux := http.NewServeMux()
     mux.HandleFunc("/v1/shell/run", s.handleShellRun)
+    mux.HandleFunc("/v1/shell/batch", s.handleShellBatch)
     mux.HandleFunc("/v1/pty/open", s.handlePTYOpen)
     mux.HandleFunc("/v1/pty/send", s.handlePTYSend)
     mux.HandleFunc("/v1/pty/read", s.handlePTYRead)
+    mux.HandleFunc("/v1/pty/events", s.handlePTYEvents)
+    mux.HandleFunc("/v1/pty/responders", s.handlePTYResponders)
     mux.HandleFunc("/v1/pty/resize", s.handlePTYResize)
     mux.HandleFunc("/v1/pty/close", s.handlePTYClose)
+    mux.HandleFunc("/v1/pty/status", s.handlePTYStatus)
+    mux.HandleFunc("/v1/pty/usage", s.handlePTYUsage)
+    mux.HandleFunc("/v1/pty/history", s.handlePTYHistory)
+    mux.HandleFunc("/v1/jobs/start", s.handleJobStart)
+    mux.HandleFunc("/v1/jobs/read", s.handleJobRead)
+    mux.HandleFunc("/v1/jobs/wait", s.handleJobWait)
+    mux.HandleFunc("/v1/jobs/cancel", s.handleJobCancel)
+    mux.HandleFunc("/v1/jobs/list", s.handleJobList)
     mux.HandleFunc("/v1/fs/read", s.handleFSRead)
     mux.HandleFunc("/v1/fs/write", s.handleFSWrite)
     mux.HandleFunc("/v1/fs/list", s.handleFSList)
     mux.HandleFunc("/v1/bridge/tmux/create", s.handleBridgeTmuxCreate)
     mux.HandleFunc("/v1/bridge/tmux/destroy", s.handleBridgeTmuxDestroy)
     mux.HandleFunc("/v1/bridge/tmux/list", s.handleBridgeTmuxList)
+    mux.HandleFunc("/v1/secrets/set", s.handleSecretsSet)
+    mux.HandleFunc("/v1/secrets/delete", s.handleSecretsDelete)
+    mux.HandleFunc("/v1/secrets/list", s.handleSecretsList)
+    mux.HandleFunc("/v1/artifacts/get", s.handleArtifactGet)
+    mux.HandleFunc("/v1/artifacts/stat", s.handleArtifactStat)
+    mux.HandleFunc("/v1/artifacts/list", s.handleArtifactList)
+    mux.HandleFunc("/v1/artifacts/delete", s.handleArtifactDelete)
+    mux.HandleFunc("/v1/cache/stats", s.handleCacheStats)
+    mux.HandleFunc("/v1/cache/purge", s.handleCachePurge)
+    mux.HandleFunc("/v1/schedules/create", s.handleScheduleCreate)
+    mux.HandleFunc("/v1/schedules/get", s.handleScheduleGet)
+    mux.HandleFunc("/v1/schedules/list", s.handleScheduleList)
+    mux.HandleFunc("/v1/schedules/update", s.handleScheduleUpdate)
+    mux.HandleFunc("/v1/schedules/delete", s.handleScheduleDelete)
+    mux.HandleFunc("/v1/services/start", s.handleServiceStart)
+    mux.HandleFunc("/v1/services/stop", s.handleServiceStop)
+    mux.HandleFunc("/v1/services/restart", s.handleServiceRestart)
+    mux.HandleFunc("/v1/services/status", s.handleServiceStatus)
+    mux.HandleFunc("/v1/services/logs", s.handleServiceLogs)
+    mux.HandleFunc("/v1/services/list", s.handleServiceList)
+    mux.HandleFunc("/v1/wait", s.handleWait)
     return mux
 }
 
@@ -52,32 +217,267 @@ func (s *Server) handleShellRun(w http.ResponseWriter, r *http.Request) {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
     }
-    var stdin []byte
-    if req.StdinB64 != "" {
-        b, err := base64.StdEncoding.DecodeString(req.StdinB64)
-        if err != nil {
-            writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid stdin base64"})
-            return
+    out, err := s.shellRun(r.Context(), req)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+// shellRun executes one shell.run request. The error reports an invalid
+// request; failures of the command itself are carried in the response.
+func (s *Server) shellRun(ctx context.Context, req api.ShellRunRequest) (api.ShellRunResponse, error) {
+    rreq, pctx, err := s.runRequest(req)
+    if err != nil {
+        return api.ShellRunResponse{}, err
+    }
+    if err := checkGlobs(req.Collect); err != nil {
+        return api.ShellRunResponse{}, err
+    }
+    if err := diag.Validate(req.Parsers); err != nil {
+        return api.ShellRunResponse{}, err
+    }
+    retry, err := checkRetry(req.Retry)
+    if err != nil {
+        return api.ShellRunResponse{}, err
+    }
+    var key string
+    if req.Cache != nil {
+        if s.cache == nil {
+            return api.ShellRunResponse{}, errors.New("cache is disabled on this server (-cache-entries 0)")
+        }
+        if req.Track != nil {
+            return api.ShellRunResponse{}, errors.New("cache cannot be combined with track")
+        }
+        if key, err = cacheKey(req, rreq); err != nil {
+            return api.ShellRunResponse{}, err
+        }
+        if out, ok := s.cachedRun(key); ok {
+            return out, nil
         }
-        stdin = b
     }
-    timeout := time.Duration(req.TimeoutMS) * time.Millisecond
-    res, err := term.ShellRun(r.Context(), term.RunRequest{
-        Argv:    req.Argv,
-        Cwd:     req.Cwd,
-        Env:     req.Env,
-        Timeout: timeout,
-        Stdin:   stdin,
-    })
+    var track *fsdiff.Options
+    var before *fsdiff.Snapshot
+    if req.Track != nil {
+        track = &fsdiff.Options{Roots: req.Track.Roots, Dir: rreq.Cwd, Ignore: req.Track.Ignore, Hash: req.Track.Hash, MaxFiles: req.Track.MaxFiles}
+        if track.Dir == "" { track.Dir, _ = os.Getwd() }
+        if len(track.Roots) == 0 { track.Roots = []string{"."} }
+        if before, err = fsdiff.Take(*track); err != nil {
+            return api.ShellRunResponse{}, fmt.Errorf("track: %w", err)
+        }
+    }
+    res, attempts, err := s.runWithRetry(ctx, rreq, retry)
+    counts := map[string]int{}
     out := api.ShellRunResponse{
         RC:         res.RC,
-        StdoutB64:  base64.StdEncoding.EncodeToString(res.Stdout),
-        StderrB64:  base64.StdEncoding.EncodeToString(res.Stderr),
+        Signal:     exitSignal(res.Signal, res.SignalNum),
+        CoreDumped: res.CoreDumped,
+        TimedOut:   res.TimedOut,
         DurationMS: res.Duration.Milliseconds(),
         Cwd:        res.Cwd,
+        Context:    pctx,
+
+        StdoutBytes:     res.StdoutTotal,
+        StderrBytes:     res.StderrTotal,
+        StdoutTruncated: res.StdoutTruncated,
+        StderrTruncated: res.StderrTruncated,
+        LimitExceeded:   res.LimitExceeded,
+        Usage:           processUsage(res.Usage),
+        EnvKeys:         envpolicy.Keys(rreq.Env),
+        Attempts:        attempts,
     }
+    owner := s.runOwner(req.PTYID)
+    stdout, stderr := s.scrubOutput(res.Stdout, counts), s.scrubOutput(res.Stderr, counts)
+    out.StdoutB64, out.StdoutArtifactID = s.spillOutput(stdout, req.SpillBytes, owner)
+    out.StderrB64, out.StderrArtifactID = s.spillOutput(stderr, req.SpillBytes, owner)
+    out.Diagnostics = diagnostics(req.Parsers, stdout, stderr)
+    if res.Screen != "" { out.Screen = string(s.scrubOutput([]byte(res.Screen), counts)) }
+    for _, st := range res.Stages {
+        out.Stages = append(out.Stages, api.PipelineStageResult{
+            Argv: st.Argv, RC: st.RC, Signal: exitSignal(st.Exit.Signal, st.Exit.SignalNum), CoreDumped: st.Exit.CoreDumped,
+            // already counted as part of the combined stderr
+            StderrB64:   base64.StdEncoding.EncodeToString(s.scrubOutput(st.Stderr, map[string]int{})),
+            StderrBytes: st.StderrTotal, StderrTruncated: st.StderrTruncated, Usage: processUsage(st.Usage),
+        })
+    }
+    if track != nil {
+        if after, terr := fsdiff.Take(*track); terr != nil {
+            out.Changes = &api.FSChanges{Error: terr.Error()}
+        } else {
+            out.Changes = fsChanges(fsdiff.Diff(before, after))
+        }
+    }
+    if len(req.Collect) > 0 {
+        out.Collected, out.CollectedTruncated = s.collectFiles(res.Cwd, req.Collect, req.CollectInlineBytes, owner)
+    }
+    if strings.HasPrefix(owner, "run:") && hasArtifacts(out) { s.expireRef(owner, time.Now(), s.runTTL) }
+    if len(counts) > 0 { out.Redactions = counts }
     if err != nil { out.Error = err.Error() }
-    writeJSON(w, http.StatusOK, out)
+    if key != "" {
+        out.CacheKey = key
+        s.storeRun(key, out, time.Duration(req.Cache.TTLMS)*time.Millisecond)
+    }
+    return out, nil
+}
+
+// runRequest turns a shell.run request into a term.RunRequest: it decodes
+// stdin, expands secret references and applies the pty_id context.
+func (s *Server) runRequest(req api.ShellRunRequest) (term.RunRequest, *api.ShellRunContext, error) {
+    var stdin []byte
+    if req.StdinB64 != "" {
+        b, err := base64.StdEncoding.DecodeString(req.StdinB64)
+        if err != nil {
+            return term.RunRequest{}, nil, errors.New("invalid stdin base64")
+        }
+        stdin = b
+    }
+    if req.Rows < 0 || req.Rows > term.MaxTTYSize || req.Cols < 0 || req.Cols > term.MaxTTYSize {
+        return term.RunRequest{}, nil, fmt.Errorf("rows and cols must be between 1 and %d", term.MaxTTYSize)
+    }
+    if req.Screen && (req.Rows > term.MaxScreenSize || req.Cols > term.MaxScreenSize) {
+        return term.RunRequest{}, nil, fmt.Errorf("screen needs rows and cols of at most %d", term.MaxScreenSize)
+    }
+    cwd := req.Cwd
+    explicit, err := s.secrets.ExpandEnv(req.Env)
+    if err != nil {
+        return term.RunRequest{}, nil, err
+    }
+    policy, err := s.envPolicy(req.EnvPolicy)
+    if err != nil {
+        return term.RunRequest{}, nil, err
+    }
+    inherited := envpolicy.Environ()
+    var pctx *api.ShellRunContext
+    if req.PTYID != "" {
+        pc, err := s.pty.ForegroundContext(req.PTYID)
+        if err != nil {
+            return term.RunRequest{}, nil, fmt.Errorf("pty context: %w", err)
+        }
+        if cwd == "" { cwd = pc.Cwd }
+        // the foreground process's environment is the inherited base,
+        // passed through unless the request picks its own mode
+        if req.EnvPolicy == nil || req.EnvPolicy.Mode == "" {
+            policy.Mode = envpolicy.ModeInherit
+        }
+        inherited = pc.Env
+        pctx = &api.ShellRunContext{PTYID: req.PTYID, PID: pc.PID, Comm: pc.Comm, Cwd: pc.Cwd}
+    }
+    env, err := policy.Environ(inherited, explicit)
+    if err != nil {
+        return term.RunRequest{}, nil, err
+    }
+    rreq := term.RunRequest{
+        Argv:           req.Argv,
+        Cwd:            cwd,
+        Env:            env,
+        Timeout:        time.Duration(req.TimeoutMS) * time.Millisecond,
+        Stdin:          stdin,
+        MaxStdoutBytes: req.MaxStdoutBytes,
+        MaxStderrBytes: req.MaxStderrBytes,
+        KeepTail:       req.KeepTail,
+        KillAfterBytes: req.KillAfterBytes,
+        KillGrace:      time.Duration(req.KillGraceMS) * time.Millisecond,
+        TTY:            req.TTY,
+        Rows:           req.Rows,
+        Cols:           req.Cols,
+        Screen:         req.Screen,
+    }
+    if rreq.KillGrace <= 0 { rreq.KillGrace = s.killGrace }
+    for i, st := range req.Pipeline {
+        senv, err := s.secrets.ExpandEnv(st.Env)
+        if err == nil && senv != nil {
+            senv, err = policy.Environ(inherited, senv)
+        }
+        if err != nil {
+            return term.RunRequest{}, nil, fmt.Errorf("pipeline stage %d: %w", i, err)
+        }
+        rreq.Pipeline = append(rreq.Pipeline, term.PipelineStage{Argv: st.Argv, Cwd: st.Cwd, Env: senv})
+    }
+    if rreq.MaxStdoutBytes <= 0 { rreq.MaxStdoutBytes = s.maxOutput }
+    if rreq.MaxStderrBytes <= 0 { rreq.MaxStderrBytes = s.maxOutput }
+    return rreq, pctx, nil
+}
+
+// diagnostics runs the named parsers over each stream separately, so that
+// interleaved stdout and stderr lines cannot split a message.
+func diagnostics(parsers []string, streams ...[]byte) []api.Diagnostic {
+    if len(parsers) == 0 { return nil }
+    out := []api.Diagnostic{}
+    for _, b := range streams {
+        for _, d := range diag.Parse(parsers, b) {
+            if len(out) == diag.MaxDiagnostics { return out }
+            out = append(out, api.Diagnostic{File: d.File, Line: d.Line, Column: d.Column, Severity: d.Severity, Message: d.Message, Tool: d.Tool})
+        }
+    }
+    return out
+}
+
+// exitSignal reports a terminating signal; nil for a normal exit.
+func exitSignal(name string, num int) *api.ExitSignal {
+    if num == 0 { return nil }
+    return &api.ExitSignal{Name: name, Number: num}
+}
+
+func fsChanges(c fsdiff.Changes) *api.FSChanges {
+    conv := func(list []fsdiff.Change) []api.FSChange {
+        out := make([]api.FSChange, 0, len(list))
+        for _, ch := range list {
+            out = append(out, api.FSChange{Path: ch.Path, Size: ch.Size, MtimeMS: ch.ModTime.UnixMilli(), Mode: ch.Mode.String(), SHA256: ch.SHA256})
+        }
+        return out
+    }
+    return &api.FSChanges{Created: conv(c.Created), Modified: conv(c.Modified), Deleted: conv(c.Deleted), Truncated: c.Truncated}
+}
+
+// envPolicy narrows the server default by a request's env_policy.
+func (s *Server) envPolicy(p *api.EnvPolicy) (envpolicy.Policy, error) {
+    if p == nil { return s.env, nil }
+    return s.env.Restrict(envpolicy.Policy{Mode: p.Mode, Allow: p.Allow, Deny: p.Deny, Files: p.Files, Presets: p.Presets}, s.envFileDir)
+}
+
+// processUsage converts term.Usage for responses; nil stays nil.
+func processUsage(u *term.Usage) *api.ProcessUsage {
+    if u == nil { return nil }
+    return &api.ProcessUsage{
+        CPUMS: u.CPU().Milliseconds(), UserCPUMS: u.UserCPU.Milliseconds(), SysCPUMS: u.SysCPU.Milliseconds(),
+        MaxRSSKB: u.MaxRSSKB, MinorFaults: u.MinorFaults, MajorFaults: u.MajorFaults,
+        VolCtxSwitches: u.VolCtxSwitches, InvolCtxSwitches: u.InvolCtxSwitches, Procs: u.Procs,
+    }
+}
+
+// scrubOutput removes secret values and filter matches from process output,
+// adding match counts to counts.
+func (s *Server) scrubOutput(b []byte, counts map[string]int) []byte {
+    n, b := s.secrets.RedactCount(b)
+    if n > 0 { counts["secret"] += n }
+    return s.redact.Apply(b, counts)
+}
+
+// outputScrubber is scrubOutput as a term.Redactor, so job and service
+// output is scrubbed as it is produced and raw values are never kept.
+type outputScrubber struct{ s *Server }
+
+func (o outputScrubber) Redact(b []byte) []byte { return o.s.redact.Redact(o.s.secrets.Redact(b)) }
+
+func (o outputScrubber) PartialSuffix(b []byte) int {
+    return max(o.s.secrets.PartialSuffix(b), o.s.redact.PartialSuffix(b))
+}
+
+var redactedRe = regexp.MustCompile(`\[REDACTED:([A-Za-z0-9_.-]+)\]`)
+
+// countRedactions adds the markers left in output scrubbed at ingest to
+// counts: filter matches under their rule name, secret values as "secret".
+func (s *Server) countRedactions(b []byte, counts map[string]int) {
+    if !bytes.Contains(b, []byte("[REDACTED:")) { return }
+    rules := s.redact.Names()
+    for _, m := range redactedRe.FindAllSubmatch(b, -1) {
+        if slices.Contains(rules, string(m[1])) {
+            counts[string(m[1])]++
+        } else {
+            counts["secret"]++
+        }
+    }
 }
 
 func (s *Server) handlePTYOpen(w http.ResponseWriter, r *http.Request) {
@@ -87,12 +487,35 @@ func (s *Server) handlePTYOpen(w http.ResponseWriter, r *http.Request) {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
     }
-    id, err := s.pty.PTYOpen(req.Argv, req.Rows, req.Cols, req.Cwd, req.Env)
+    explicit, err := s.secrets.ExpandEnv(req.Env)
     if err != nil {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
     }
-    writeJSON(w, http.StatusOK, api.PTYOpenResponse{ID: id})
+    policy, err := s.envPolicy(req.EnvPolicy)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    env, err := policy.Environ(envpolicy.Environ(), explicit)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    id, err := s.pty.PTYOpen(term.OpenRequest{
+        Argv:       req.Argv,
+        Rows:       req.Rows,
+        Cols:       req.Cols,
+        Cwd:        req.Cwd,
+        Env:        env,
+        Labels:     req.Labels,
+        Responders: responderRules(req.Responders),
+    })
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, api.PTYOpenResponse{ID: id, EnvKeys: envpolicy.Keys(env)})
 }
 
 func (s *Server) handlePTYSend(w http.ResponseWriter, r *http.Request) {
@@ -107,7 +530,12 @@ func (s *Server) handlePTYSend(w http.ResponseWriter, r *http.Request) {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid data base64"})
         return
     }
-    n, err := s.pty.PTYSend(req.ID, b)
+    expanded, err := s.secrets.Expand(string(b))
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    n, err := s.pty.PTYSend(req.ID, []byte(expanded))
     if err != nil {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
@@ -128,11 +556,144 @@ func (s *Server) handlePTYRead(w http.ResponseWriter, r *http.Request) {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
     }
+    doRedact := s.redactReads
+    if req.Redact != nil { doRedact = *req.Redact }
+    doRedact = doRedact && !s.redact.Empty()
+    if doRedact && !closed && len(chunks) > 0 {
+        // give a match cut off at the end a moment to complete
+        last := chunks[len(chunks)-1]
+        if wait := redactHoldback - time.Since(last.Ts); wait > 0 && s.redact.PartialSuffix(last.Data) > 0 {
+            time.Sleep(wait)
+            if more, c, err := s.pty.PTYRead(req.ID, req.SinceSeq, req.MaxBytes, time.Millisecond); err == nil && len(more) > 0 {
+                chunks, closed = more, c
+            }
+        }
+    }
     out := api.PTYReadResponse{Closed: closed}
     out.Chunks = make([]api.PTYChunk, 0, len(chunks))
-    for _, c := range chunks {
+    counts := map[string]int{}
+    var redacted [][]byte
+    if doRedact {
+        var prev []byte
+        if req.SinceSeq > 0 {
+            if pc, _, err := s.pty.PTYRead(req.ID, req.SinceSeq-1, 1, time.Millisecond); err == nil && len(pc) > 0 && pc[0].Seq == req.SinceSeq {
+                prev = pc[0].Data
+            }
+        }
+        redacted = s.redactChunks(prev, chunks, counts)
+    }
+    for i, c := range chunks {
+        data := c.Data
+        if doRedact { data = redacted[i] }
         out.Chunks = append(out.Chunks, api.PTYChunk{
-            Seq: c.Seq, Stream: c.Stream, Ts: c.Ts.UnixMilli(), Data: base64.StdEncoding.EncodeToString(c.Data),
+            Seq: c.Seq, Stream: c.Stream, Ts: c.Ts.UnixMilli(), Data: base64.StdEncoding.EncodeToString(data),
+        })
+    }
+    if len(counts) > 0 { out.Redactions = counts }
+    writeJSON(w, http.StatusOK, out)
+}
+
+// redactHoldback is how long pty.read waits for a filter match cut off at
+// the end of the newest chunk to complete, like the ingest scrubber.
+const redactHoldback = 100 * time.Millisecond
+
+// redactChunks applies the read filters across chunk boundaries: a match
+// running from one chunk into the next is replaced where it starts. prev is
+// the chunk just before the window; a partial match at its end was already
+// returned, so only the part of the replacement inside the window is added.
+func (s *Server) redactChunks(prev []byte, chunks []term.Chunk, counts map[string]int) [][]byte {
+    carry := prev[len(prev)-s.redact.PartialSuffix(prev):]
+    seen := s.redact.Apply(carry, nil) // how that tail was returned
+    rules := s.redact.Names()
+    out := make([][]byte, len(chunks))
+    for i, c := range chunks {
+        data := append(append([]byte(nil), carry...), c.Data...)
+        hold := 0
+        if i < len(chunks)-1 { hold = s.redact.PartialSuffix(data) }
+        red := s.redact.Apply(data[:len(data)-hold], nil)
+        if seen != nil {
+            k := 0
+            for k < len(red) && k < len(seen) && red[k] == seen[k] { k++ }
+            red, seen = red[k:], nil
+        }
+        for _, m := range redactedRe.FindAllSubmatch(red, -1) {
+            if slices.Contains(rules, string(m[1])) { counts[string(m[1])]++ }
+        }
+        out[i] = red
+        carry = data[len(data)-hold:]
+    }
+    return out
+}
+
+func (s *Server) handlePTYEvents(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.PTYEventsRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    timeout := time.Duration(req.TimeoutMS) * time.Millisecond
+    events, st, closed, err := s.pty.PTYEvents(req.ID, req.SinceSeq, timeout)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    out := api.PTYEventsResponse{Events: make([]api.PTYEvent, 0, len(events)), Title: st.Title, Cwd: st.Cwd, Closed: closed}
+    for _, e := range events {
+        out.Events = append(out.Events, api.PTYEvent{
+            Seq: e.Seq, ChunkSeq: e.ChunkSeq, Ts: e.Ts.UnixMilli(), Kind: e.Kind, Value: e.Value, ExitCode: e.ExitCode,
+        })
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func responderRules(in []api.PTYResponder) []term.ResponderRule {
+    out := make([]term.ResponderRule, 0, len(in))
+    for _, r := range in {
+        out = append(out, term.ResponderRule{
+            ID: r.ID, Pattern: r.Pattern, Response: []byte(r.Response),
+            Once: r.Once, MaxCount: r.MaxCount, Delay: time.Duration(r.DelayMS) * time.Millisecond,
+        })
+    }
+    return out
+}
+
+func (s *Server) handlePTYResponders(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.PTYRespondersRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    var out api.PTYRespondersResponse
+    switch req.Action {
+    case "", "list":
+    case "add":
+        ids, err := s.pty.AddResponders(req.ID, responderRules(req.Rules))
+        if err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+            return
+        }
+        out.Added = ids
+    case "remove":
+        if err := s.pty.RemoveResponders(req.ID, req.IDs); err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+            return
+        }
+    default:
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown action " + req.Action})
+        return
+    }
+    rules, err := s.pty.Responders(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    out.Rules = make([]api.PTYResponder, 0, len(rules))
+    for _, st := range rules {
+        out.Rules = append(out.Rules, api.PTYResponder{
+            ID: st.ID, Pattern: st.Pattern, Response: string(st.Response), Once: st.Once, MaxCount: st.MaxCount,
+            DelayMS: st.Delay.Milliseconds(), Fired: st.Fired, Exhausted: st.Exhausted,
         })
     }
     writeJSON(w, http.StatusOK, out)
@@ -159,11 +720,89 @@ func (s *Server) handlePTYClose(w http.ResponseWriter, r *http.Request) {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
     }
+    sessionLog, hasLog := s.pty.SessionLog(req.ID)
     if err := s.pty.PTYClose(req.ID); err != nil {
         writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
         return
     }
-    writeJSON(w, http.StatusOK, map[string]string{"status": "closed"})
+    s.artifacts.Release("pty:" + req.ID)
+    out := map[string]string{"status": "closed"}
+    if limit := s.spillBytes(req.SpillBytes); hasLog && limit > 0 {
+        if id, err := s.spillLog(req.ID, sessionLog, limit); err == nil && id != "" { out["log_artifact_id"] = id }
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handlePTYStatus(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.PTYStatusRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    st, err := s.pty.PTYStatus(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    out := api.PTYStatusResponse{ID: st.ID, PID: st.PID, Argv: st.Argv, Running: st.Running, StartedAtMS: st.StartedAt.UnixMilli()}
+    if st.Exit != nil {
+        rc := st.Exit.RC
+        out.RC = &rc
+        out.Signal = exitSignal(st.Exit.Signal, st.Exit.SignalNum)
+        out.CoreDumped = st.Exit.CoreDumped
+        out.EndedAtMS = st.EndedAt.UnixMilli()
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handlePTYUsage(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.PTYUsageRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    u, live, err := s.pty.PTYUsage(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, api.PTYUsageResponse{Usage: *processUsage(&u), Live: live})
+}
+
+func (s *Server) handlePTYHistory(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.PTYHistoryRequest
+    if r.Method == http.MethodPost {
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+            writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+            return
+        }
+    }
+    h := s.pty.History()
+    if h == nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "session history disabled"})
+        return
+    }
+    f := term.HistoryFilter{ID: req.ID, Command: req.Command, Labels: req.Labels, ExitCode: req.ExitCode, Limit: req.Limit}
+    if req.SinceMS > 0 { f.Since = time.UnixMilli(req.SinceMS) }
+    if req.UntilMS > 0 { f.Until = time.UnixMilli(req.UntilMS) }
+    entries, err := h.Query(f)
+    if err != nil {
+        writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+        return
+    }
+    out := api.PTYHistoryResponse{Sessions: make([]api.PTYHistoryEntry, 0, len(entries))}
+    for _, e := range entries {
+        out.Sessions = append(out.Sessions, api.PTYHistoryEntry{
+            ID: e.ID, Argv: e.Argv, Cwd: e.Cwd, Labels: e.Labels,
+            StartedAtMS: e.StartedAt.UnixMilli(), EndedAtMS: e.EndedAt.UnixMilli(),
+            ExitCode: e.ExitCode, Signal: e.Signal, SignalNum: e.SignalNum, CoreDumped: e.Core, BytesIn: e.BytesIn, BytesOut: e.BytesOut,
+            CPUMS: e.CPUMS, MaxRSSKB: e.MaxRSSKB, LogPath: e.LogPath,
+        })
+    }
+    writeJSON(w, http.StatusOK, out)
 }
 
 func (s *Server) handleFSRead(w http.ResponseWriter, r *http.Request) {
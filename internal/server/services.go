@@ -0,0 +1,190 @@
+package server
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "regexp"
+    "time"
+
+    "ai-terminal/api"
+    "ai-terminal/internal/diag"
+    "ai-terminal/internal/term"
+)
+
+func serviceStatus(st term.ServiceStatus) api.ServiceStatus {
+    out := api.ServiceStatus{
+        ID: st.ID, Name: st.Name, Argv: st.Argv, Cwd: st.Cwd, Restart: st.Restart, State: st.State,
+        Ready: st.Ready, PID: st.PID, Restarts: st.Restarts, Error: st.Err,
+    }
+    if !st.StartedAt.IsZero() { out.StartedAtMS = st.StartedAt.UnixMilli() }
+    if !st.ReadyAt.IsZero() { out.ReadyAtMS = st.ReadyAt.UnixMilli() }
+    if !st.NextStart.IsZero() { out.NextStartMS = st.NextStart.UnixMilli() }
+    if st.LastExit != nil {
+        rc := st.LastExit.RC
+        out.LastRC, out.LastSignal = &rc, exitSignal(st.LastExit.Signal, st.LastExit.SignalNum)
+    }
+    return out
+}
+
+// serviceSpec turns a start request into a supervisor spec. Options that
+// only make sense for a single bounded run are rejected.
+func (s *Server) serviceSpec(req api.ServiceStartRequest) (term.ServiceSpec, error) {
+    run := req.Run
+    switch {
+    case len(run.Pipeline) > 0:
+        return term.ServiceSpec{}, errors.New("services do not support pipeline")
+    case run.StdinB64 != "" || run.TimeoutMS != 0 || run.PTYID != "" || run.TTY:
+        return term.ServiceSpec{}, errors.New("services do not support stdin, timeout_ms, pty_id or tty")
+    case len(run.Collect) > 0 || run.Track != nil || run.Cache != nil || len(run.Parsers) > 0 || run.Retry != nil:
+        return term.ServiceSpec{}, errors.New("services do not support collect, track, cache, parsers or retry")
+    }
+    rreq, _, err := s.runRequest(run)
+    if err != nil {
+        return term.ServiceSpec{}, err
+    }
+    spec := term.ServiceSpec{
+        Name:        req.Name,
+        Run:         rreq,
+        Restart:     req.Restart,
+        MaxRestarts: req.MaxRestarts,
+        BackoffMin:  time.Duration(req.BackoffMS) * time.Millisecond,
+        BackoffMax:  time.Duration(req.MaxBackoffMS) * time.Millisecond,
+    }
+    if r := req.Ready; r != nil {
+        p := &term.ReadyProbe{
+            TCP:      r.TCP,
+            Command:  r.Command,
+            Interval: time.Duration(r.IntervalMS) * time.Millisecond,
+            Timeout:  time.Duration(r.TimeoutMS) * time.Millisecond,
+        }
+        if r.LogRegex != "" {
+            if p.LogRegex, err = regexp.Compile(r.LogRegex); err != nil {
+                return term.ServiceSpec{}, err
+            }
+        }
+        spec.Ready = p
+    }
+    return spec, nil
+}
+
+func (s *Server) handleServiceStart(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ServiceStartRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    spec, err := s.serviceSpec(req)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    id, err := s.services.Start(spec)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    st, _ := s.services.Status(id)
+    if req.WaitReadyMS > 0 {
+        st, _ = s.services.WaitReady(id, time.Duration(req.WaitReadyMS)*time.Millisecond)
+    }
+    writeJSON(w, http.StatusOK, serviceStatus(st))
+}
+
+// handleServiceStop terminates the process group and ends supervision.
+func (s *Server) handleServiceStop(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ServiceStopRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    stop := s.services.Stop
+    if req.Remove { stop = s.services.Remove }
+    st, err := stop(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, serviceStatus(st))
+}
+
+func (s *Server) handleServiceRestart(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ServiceIDRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    st, err := s.services.Restart(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, serviceStatus(st))
+}
+
+func (s *Server) handleServiceStatus(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ServiceIDRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    st, err := s.services.Status(req.ID)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    writeJSON(w, http.StatusOK, serviceStatus(st))
+}
+
+// handleServiceLogs reads captured output like /v1/jobs/read; done is set
+// once the service is no longer supervised and all output was returned.
+func (s *Server) handleServiceLogs(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.ServiceLogsRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if err := diag.Validate(req.Parsers); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    timeout := time.Duration(req.TimeoutMS) * time.Millisecond
+    chunks, done, err := s.services.Logs(req.ID, req.SinceSeq, req.MaxBytes, timeout)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    out := api.JobReadResponse{Chunks: make([]api.PTYChunk, 0, len(chunks)), Done: done}
+    counts := map[string]int{}
+    var stdout, stderr []byte
+    for _, c := range chunks {
+        s.countRedactions(c.Data, counts)
+        if c.Stream == "stderr" {
+            stderr = append(stderr, c.Data...)
+        } else {
+            stdout = append(stdout, c.Data...)
+        }
+        out.Chunks = append(out.Chunks, api.PTYChunk{
+            Seq: c.Seq, Stream: c.Stream, Ts: c.Ts.UnixMilli(), Data: base64.StdEncoding.EncodeToString(c.Data),
+        })
+    }
+    out.Diagnostics = diagnostics(req.Parsers, stdout, stderr)
+    if len(counts) > 0 { out.Redactions = counts }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleServiceList(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    list := s.services.List()
+    out := api.ServiceListResponse{Services: make([]api.ServiceStatus, 0, len(list))}
+    for _, st := range list {
+        out.Services = append(out.Services, serviceStatus(st))
+    }
+    writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "syscall"
+    "time"
+
+    "ai-terminal/api"
+)
+
+const (
+    defaultWaitTimeout  = 30 * time.Second
+    maxWaitTimeout      = 10 * time.Minute
+    defaultWaitInterval = 100 * time.Millisecond
+    // waitPTYWindow is how much unmatched PTY output is kept so that a
+    // match may span chunk boundaries.
+    waitPTYWindow = 64 << 10
+)
+
+// waitCheck polls one condition; it reports whether the condition holds,
+// the matched text and, for jobs, the exit status.
+type waitCheck struct {
+    kind  string
+    check func() (bool, string, *int)
+}
+
+// waitChecks validates the conditions of req and builds their checks.
+func (s *Server) waitChecks(req api.WaitRequest, interval time.Duration) ([]waitCheck, error) {
+    if len(req.Conditions) == 0 {
+        return nil, errors.New("conditions must not be empty")
+    }
+    abs := func(p string) string {
+        if filepath.IsAbs(p) || req.Cwd == "" { return p }
+        return filepath.Join(req.Cwd, p)
+    }
+    var checks []waitCheck
+    for i, c := range req.Conditions {
+        set := 0
+        for _, on := range []bool{c.TCP != "", c.Unix != "", c.File != "", c.PID != 0, c.JobID != "", c.PTYID != ""} {
+            if on { set++ }
+        }
+        if set != 1 {
+            return nil, fmt.Errorf("condition %d: set exactly one of tcp, unix, file, pid, job_id or pty_id", i)
+        }
+        if (c.FileRegex != "" && c.File == "") || (c.PTYRegex != "" && c.PTYID == "") {
+            return nil, fmt.Errorf("condition %d: file_regex needs file and pty_regex needs pty_id", i)
+        }
+        var wc waitCheck
+        switch {
+        case c.TCP != "":
+            if _, _, err := net.SplitHostPort(c.TCP); err != nil {
+                return nil, fmt.Errorf("condition %d: %w", i, err)
+            }
+            addr := c.TCP
+            wc = waitCheck{"tcp", func() (bool, string, *int) {
+                conn, err := net.DialTimeout("tcp", addr, min(interval, time.Second))
+                if err != nil { return false, "", nil }
+                conn.Close()
+                return true, "", nil
+            }}
+        case c.Unix != "":
+            path := abs(c.Unix)
+            wc = waitCheck{"unix", func() (bool, string, *int) {
+                fi, err := os.Stat(path)
+                return err == nil && fi.Mode()&os.ModeSocket != 0, "", nil
+            }}
+        case c.File != "":
+            path := abs(c.File)
+            var re *regexp.Regexp
+            if c.FileRegex != "" {
+                var err error
+                if re, err = regexp.Compile(c.FileRegex); err != nil {
+                    return nil, fmt.Errorf("condition %d: %w", i, err)
+                }
+            }
+            wc = waitCheck{"file", func() (bool, string, *int) {
+                if re == nil {
+                    _, err := os.Stat(path)
+                    return err == nil, "", nil
+                }
+                b, err := os.ReadFile(path)
+                if err != nil { return false, "", nil }
+                m := re.Find(b)
+                return m != nil, string(m), nil
+            }}
+        case c.PID != 0:
+            if c.PID < 0 {
+                return nil, fmt.Errorf("condition %d: pid must be positive", i)
+            }
+            pid := c.PID
+            wc = waitCheck{"pid", func() (bool, string, *int) { return processGone(pid), "", nil }}
+        case c.JobID != "":
+            if _, err := s.jobs.Status(c.JobID); err != nil {
+                return nil, fmt.Errorf("condition %d: %w", i, err)
+            }
+            id := c.JobID
+            wc = waitCheck{"job", func() (bool, string, *int) {
+                st, err := s.jobs.Status(id)
+                if err != nil || !st.Done() { return false, "", nil }
+                rc := st.RC
+                return true, "", &rc
+            }}
+        case c.PTYID != "":
+            if c.PTYRegex == "" {
+                return nil, fmt.Errorf("condition %d: pty_id needs pty_regex", i)
+            }
+            re, err := regexp.Compile(c.PTYRegex)
+            if err != nil {
+                return nil, fmt.Errorf("condition %d: %w", i, err)
+            }
+            if _, err := s.pty.PTYStatus(c.PTYID); err != nil {
+                return nil, fmt.Errorf("condition %d: %w", i, err)
+            }
+            wc = waitCheck{"pty", s.ptyMatcher(c.PTYID, c.SinceSeq, re)}
+        }
+        checks = append(checks, wc)
+    }
+    return checks, nil
+}
+
+// ptyMatcher returns a check that reads new PTY output on each call and
+// matches re against it, keeping a tail of unmatched output.
+func (s *Server) ptyMatcher(id string, since uint64, re *regexp.Regexp) func() (bool, string, *int) {
+    var buf []byte
+    return func() (bool, string, *int) {
+        for {
+            chunks, _, err := s.pty.PTYRead(id, since, 0, time.Millisecond)
+            if err != nil || len(chunks) == 0 { break }
+            for _, c := range chunks {
+                buf = append(buf, c.Data...)
+                since = c.Seq
+            }
+        }
+        if m := re.Find(buf); m != nil {
+            return true, string(s.scrubOutput(m, map[string]int{})), nil
+        }
+        if len(buf) > waitPTYWindow {
+            buf = append([]byte(nil), buf[len(buf)-waitPTYWindow:]...)
+        }
+        return false, "", nil
+    }
+}
+
+// processGone reports whether pid no longer runs; a zombie counts as exited.
+func processGone(pid int) bool {
+    if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+        return true
+    }
+    b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+    if err != nil {
+        return false
+    }
+    // the state follows the parenthesized command name, which may contain spaces
+    if i := strings.LastIndexByte(string(b), ')'); i >= 0 && i+2 < len(b) {
+        return b[i+2] == 'Z'
+    }
+    return false
+}
+
+// handleWait polls its conditions until one holds, the timeout expires or
+// the client goes away.
+func (s *Server) handleWait(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return }
+    var req api.WaitRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    timeout := time.Duration(req.TimeoutMS) * time.Millisecond
+    if timeout <= 0 { timeout = defaultWaitTimeout }
+    if timeout > maxWaitTimeout { timeout = maxWaitTimeout }
+    interval := time.Duration(req.IntervalMS) * time.Millisecond
+    if interval <= 0 { interval = defaultWaitInterval }
+    checks, err := s.waitChecks(req, interval)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+
+    start := time.Now()
+    deadline := time.NewTimer(timeout)
+    defer deadline.Stop()
+    tick := time.NewTicker(interval)
+    defer tick.Stop()
+    for {
+        for i, c := range checks {
+            if ok, match, rc := c.check(); ok {
+                writeJSON(w, http.StatusOK, api.WaitResponse{
+                    Fired: true, Index: i, Kind: c.kind, Match: match, RC: rc, ElapsedMS: time.Since(start).Milliseconds(),
+                })
+                return
+            }
+        }
+        select {
+        case <-r.Context().Done():
+            return
+        case <-deadline.C:
+            writeJSON(w, http.StatusOK, api.WaitResponse{TimedOut: true, Index: -1, ElapsedMS: time.Since(start).Milliseconds()})
+            return
+        case <-tick.C:
+        }
+    }
+}
@@ -0,0 +1,113 @@
+package term
+
+import (
+    "sync"
+    "sync/atomic"
+)
+
+// outputLimit fires kill once the combined output of a process exceeds max.
+type outputLimit struct {
+    max   int64
+    total atomic.Int64
+    hit   atomic.Bool
+    once  sync.Once
+    kill  func()
+}
+
+func (l *outputLimit) add(n int) {
+    if l == nil || l.max <= 0 {
+        return
+    }
+    if l.total.Add(int64(n)) > l.max {
+        l.once.Do(func() {
+            l.hit.Store(true)
+            l.kill()
+        })
+    }
+}
+
+// capBuffer retains at most max bytes of a stream (0 = unlimited). With
+// keepTail the budget is split between the first and the last bytes written;
+// otherwise only the head is kept. Writes never fail so the child is not
+// disturbed by a short write.
+type capBuffer struct {
+    max      int64
+    keepTail bool
+    limit    *outputLimit
+
+    head  []byte
+    tail  []byte // ring buffer of the last len(tail) bytes once full
+    tpos  int
+    tfull bool
+    total int64
+}
+
+func newCapBuffer(max int64, keepTail bool, limit *outputLimit) *capBuffer {
+    b := &capBuffer{max: max, keepTail: keepTail, limit: limit}
+    if max > 0 && keepTail {
+        b.tail = make([]byte, 0, max-max/2)
+    }
+    return b
+}
+
+func (b *capBuffer) Write(p []byte) (int, error) {
+    n := len(p)
+    b.total += int64(n)
+    b.limit.add(n)
+    if b.max <= 0 {
+        b.head = append(b.head, p...)
+        return n, nil
+    }
+    headMax := b.max
+    if b.keepTail {
+        headMax = b.max / 2
+    }
+    if room := headMax - int64(len(b.head)); room > 0 {
+        take := int64(len(p))
+        if take > room {
+            take = room
+        }
+        b.head = append(b.head, p[:take]...)
+        p = p[take:]
+    }
+    if !b.keepTail || len(p) == 0 {
+        return n, nil
+    }
+    for len(p) > 0 {
+        if !b.tfull {
+            room := cap(b.tail) - len(b.tail)
+            take := len(p)
+            if take > room {
+                take = room
+            }
+            b.tail = append(b.tail, p[:take]...)
+            p = p[take:]
+            if len(b.tail) == cap(b.tail) {
+                b.tfull = true
+            }
+            continue
+        }
+        c := copy(b.tail[b.tpos:], p)
+        b.tpos = (b.tpos + c) % len(b.tail)
+        p = p[c:]
+    }
+    return n, nil
+}
+
+// Bytes returns the retained head followed by the retained tail.
+func (b *capBuffer) Bytes() []byte {
+    if !b.keepTail || len(b.tail) == 0 {
+        return b.head
+    }
+    out := make([]byte, 0, len(b.head)+len(b.tail))
+    out = append(out, b.head...)
+    out = append(out, b.tail[b.tpos:]...)
+    out = append(out, b.tail[:b.tpos]...)
+    return out
+}
+
+// Total is the number of bytes written, retained or not.
+func (b *capBuffer) Total() int64 { return b.total }
+
+// Truncated reports whether any bytes were dropped.
+func (b *capBuffer) Truncated() bool { return b.total > int64(len(b.head)+len(b.tail)) }
@@ -0,0 +1,35 @@
+package term
+
+import (
+    "os"
+    "syscall"
+
+    "golang.org/x/sys/unix"
+)
+
+// ExitInfo describes how a process terminated.
+type ExitInfo struct {
+    RC         int    // exit status, or 128+signal number when killed by a signal
+    Signal     string // e.g. "SIGSEGV"; empty for a normal exit
+    SignalNum  int
+    CoreDumped bool
+}
+
+// exitInfo decodes the wait status of a finished process. A nil state (the
+// process never ran or was not reaped) reports RC -1.
+func exitInfo(ps *os.ProcessState) ExitInfo {
+    if ps == nil {
+        return ExitInfo{RC: -1}
+    }
+    ws, ok := ps.Sys().(syscall.WaitStatus)
+    if !ok || !ws.Signaled() {
+        return ExitInfo{RC: ps.ExitCode()}
+    }
+    sig := ws.Signal()
+    return ExitInfo{
+        RC:         128 + int(sig),
+        Signal:     unix.SignalName(sig),
+        SignalNum:  int(sig),
+        CoreDumped: ws.CoreDump(),
+    }
+}
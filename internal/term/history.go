@@ -0,0 +1,135 @@
+package term
+
+import (
+    "bufio"
+    "encoding/json"
+    "os"
+    "path"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// HistoryEntry records a finished PTY session.
+type HistoryEntry struct {
+    ID        string            `json:"id"`
+    Argv      []string          `json:"argv"`
+    Cwd       string            `json:"cwd,omitempty"`
+    Labels    map[string]string `json:"labels,omitempty"`
+    StartedAt time.Time         `json:"started_at"`
+    EndedAt   time.Time         `json:"ended_at"`
+    ExitCode  *int              `json:"exit_code,omitempty"`
+    Signal    string            `json:"signal,omitempty"`
+    SignalNum int               `json:"signal_number,omitempty"`
+    Core      bool              `json:"core_dumped,omitempty"`
+    BytesIn   int64             `json:"bytes_in"`
+    BytesOut  int64             `json:"bytes_out"`
+    CPUMS     int64             `json:"cpu_ms,omitempty"`
+    MaxRSSKB  int64             `json:"max_rss_kb,omitempty"`
+    LogPath   string            `json:"log_path,omitempty"`
+}
+
+// HistoryFilter selects entries from the registry; zero fields match everything.
+type HistoryFilter struct {
+    ID       string
+    Command  string            // matches argv[0] or its basename
+    Labels   map[string]string // all must match
+    Since    time.Time         // started at or after
+    Until    time.Time         // started before
+    ExitCode *int
+    Limit    int // newest entries first; 0 means no limit
+}
+
+// History is an append-only JSON-lines registry of finished sessions.
+type History struct {
+    mu   sync.Mutex
+    path string
+}
+
+func NewHistory(path string) *History { return &History{path: path} }
+
+// Path returns the registry file location.
+func (h *History) Path() string { return h.path }
+
+// Append writes one entry to the registry.
+func (h *History) Append(e HistoryEntry) error {
+    b, err := json.Marshal(e)
+    if err != nil {
+        return err
+    }
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    _, err = f.Write(append(b, '\n'))
+    return err
+}
+
+// Query returns matching entries, newest first.
+func (h *History) Query(f HistoryFilter) ([]HistoryEntry, error) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    fh, err := os.Open(h.path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    defer fh.Close()
+    var all []HistoryEntry
+    sc := bufio.NewScanner(fh)
+    sc.Buffer(make([]byte, 64*1024), 4<<20)
+    for sc.Scan() {
+        var e HistoryEntry
+        if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+            continue // skip torn lines
+        }
+        if f.match(e) {
+            all = append(all, e)
+        }
+    }
+    if err := sc.Err(); err != nil {
+        return nil, err
+    }
+    out := make([]HistoryEntry, 0, len(all))
+    for i := len(all) - 1; i >= 0; i-- {
+        out = append(out, all[i])
+        if f.Limit > 0 && len(out) >= f.Limit {
+            break
+        }
+    }
+    return out, nil
+}
+
+func (f HistoryFilter) match(e HistoryEntry) bool {
+    if f.ID != "" && e.ID != f.ID {
+        return false
+    }
+    if f.Command != "" {
+        if len(e.Argv) == 0 || (e.Argv[0] != f.Command && path.Base(e.Argv[0]) != f.Command) {
+            return false
+        }
+    }
+    for k, v := range f.Labels {
+        if e.Labels[k] != v {
+            return false
+        }
+    }
+    if !f.Since.IsZero() && e.StartedAt.Before(f.Since) {
+        return false
+    }
+    if !f.Until.IsZero() && !e.StartedAt.Before(f.Until) {
+        return false
+    }
+    if f.ExitCode != nil && (e.ExitCode == nil || *e.ExitCode != *f.ExitCode) {
+        return false
+    }
+    return true
+}
@@ -0,0 +1,443 @@
+package term
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+)
+
+// Job states.
+const (
+    JobRunning  = "running"
+    JobExited   = "exited"
+    JobTimeout  = "timeout"
+    JobCanceled = "canceled"
+    JobFailed   = "failed" // could not start or wait failed
+)
+
+// maxFinishedJobs bounds how many completed jobs are retained for read/wait.
+const maxFinishedJobs = 256
+
+// JobStatus is a snapshot of a job.
+type JobStatus struct {
+    ID        string
+    Argv      []string
+    Cwd       string
+    State     string
+    RC        int
+    StartedAt time.Time
+    EndedAt   time.Time // zero while running
+    Err       string
+    Usage     *Usage // set once the job has finished
+    Exit      ExitInfo
+    // Output totals and caps as in RunResult; set once the job has finished.
+    StdoutTotal, StderrTotal         int64
+    StdoutTruncated, StderrTruncated bool
+    LimitExceeded                    bool
+    // Artifacts maps "stdout"/"stderr" to the IDs returned by the spool
+    // handler; set once the job has finished.
+    Artifacts map[string]string
+}
+
+// Done reports whether the job has finished.
+func (st JobStatus) Done() bool { return st.State != JobRunning }
+
+// Job is an asynchronously running non-PTY process with chunked output.
+type Job struct {
+    id     string
+    cancel context.CancelFunc
+
+    mu       sync.Mutex
+    status   JobStatus
+    chunks   []Chunk
+    nextSeq  uint64
+    canceled bool
+    doneCh   chan struct{}
+}
+
+// JobManager runs RunRequests in the background.
+type JobManager struct {
+    mu   sync.Mutex
+    jobs map[string]*Job
+
+    spoolDir  string
+    spoolDone func(st JobStatus, files map[string]string) map[string]string
+    forget    func(id string)
+    scrub     Redactor
+}
+
+func NewJobManager() *JobManager {
+    return &JobManager{jobs: make(map[string]*Job)}
+}
+
+// SetSpool lets jobs with SpoolBytes set also write their stdout and
+// stderr, within the request's output caps, to files under dir, since the
+// chunk buffer only keeps the most recent output. Once a job finishes, done
+// receives the paths of streams larger than SpoolBytes; it owns the files
+// and may return artifact IDs to record in the job's status.
+func (m *JobManager) SetSpool(dir string, done func(st JobStatus, files map[string]string) map[string]string) {
+    m.mu.Lock()
+    m.spoolDir, m.spoolDone = dir, done
+    m.mu.Unlock()
+}
+
+// SetRedactor sets the scrubber applied to the output of jobs started
+// afterwards, before it is buffered or spooled.
+func (m *JobManager) SetRedactor(r Redactor) {
+    m.mu.Lock()
+    m.scrub = r
+    m.mu.Unlock()
+}
+
+// SetOnForget registers f to be called with the ID of every pruned job.
+func (m *JobManager) SetOnForget(f func(id string)) {
+    m.mu.Lock()
+    m.forget = f
+    m.mu.Unlock()
+}
+
+// jobStream appends writes to the job as chunks on one stream, scrubbed
+// first. Like capBuffer it passes on at most max bytes (0 = unlimited): the
+// head as it is written and, with keepTail, the last bytes once the job ends.
+type jobStream struct {
+    j        *Job
+    stream   string
+    spool    *os.File // optional copy of the stream as passed on
+    limit    *outputLimit
+    max      int64
+    keepTail bool
+    hold     holdback // guarded by j.mu
+
+    total int64
+    tail  []byte // recent bytes beyond the head; guarded by j.mu
+}
+
+func newJobStream(j *Job, stream string, scrub Redactor) *jobStream {
+    w := &jobStream{j: j, stream: stream}
+    w.hold = holdback{mu: &j.mu, r: scrub, emit: w.pass}
+    return w
+}
+
+func (w *jobStream) Write(p []byte) (int, error) {
+    w.limit.add(len(p))
+    w.j.mu.Lock()
+    defer w.j.mu.Unlock()
+    w.hold.write(p)
+    return len(p), nil
+}
+
+// pass applies the output cap to scrubbed bytes. Caller holds j.mu.
+func (w *jobStream) pass(p []byte) {
+    seen := w.total
+    w.total += int64(len(p))
+    if w.max > 0 {
+        headMax := w.max
+        if w.keepTail {
+            headMax = w.max / 2
+        }
+        take := min(int64(len(p)), max(0, headMax-seen))
+        if w.keepTail {
+            w.keep(p[take:])
+        }
+        p = p[:take]
+    }
+    if len(p) > 0 {
+        w.emit(p)
+    }
+}
+
+// keep remembers the last max-max/2 bytes beyond the head. Caller holds j.mu.
+func (w *jobStream) keep(p []byte) {
+    tailMax := int(w.max - w.max/2)
+    w.tail = append(w.tail, p...)
+    if len(w.tail) > 2*tailMax {
+        w.tail = append([]byte(nil), w.tail[len(w.tail)-tailMax:]...)
+    }
+}
+
+// emit records p as a chunk and spools it. Caller holds j.mu.
+func (w *jobStream) emit(p []byte) {
+    data := make([]byte, len(p))
+    copy(data, p)
+    w.j.chunks = append(w.j.chunks, Chunk{Seq: w.j.nextSeq, Stream: w.stream, Data: data, Ts: time.Now()})
+    w.j.nextSeq++
+    w.j.enforceCap()
+    if w.spool != nil {
+        _, _ = w.spool.Write(p)
+    }
+}
+
+// finish passes on held-back and kept tail bytes once the process is done.
+// Caller holds j.mu.
+func (w *jobStream) finish() {
+    w.hold.drain()
+    if tailMax := int(w.max - w.max/2); len(w.tail) > tailMax {
+        w.tail = w.tail[len(w.tail)-tailMax:]
+    }
+    if len(w.tail) > 0 {
+        w.emit(w.tail)
+        w.tail = nil
+    }
+}
+
+func (w *jobStream) truncated() bool { return w.max > 0 && w.total > w.max }
+
+// enforceCap drops the oldest chunks beyond capSize. Caller holds j.mu.
+func (j *Job) enforceCap() {
+    total := 0
+    for i := len(j.chunks) - 1; i >= 0; i-- {
+        total += len(j.chunks[i].Data)
+        if total > capSize() {
+            j.chunks = append([]Chunk(nil), j.chunks[i+1:]...)
+            break
+        }
+    }
+}
+
+// Start launches req in the background with the same semantics as ShellRun.
+func (m *JobManager) Start(req RunRequest) (string, error) {
+    if len(req.Pipeline) > 0 {
+        return "", errors.New("pipelines are not supported for jobs")
+    }
+    if len(req.Argv) == 0 || req.Argv[0] == "" {
+        return "", errors.New("argv must not be empty")
+    }
+    var ctx context.Context
+    var cancel context.CancelFunc
+    if req.Timeout > 0 {
+        ctx, cancel = context.WithTimeout(context.Background(), req.Timeout)
+    } else {
+        ctx, cancel = context.WithCancel(context.Background())
+    }
+    cmd, cwd := newCommand(ctx, req)
+    j := &Job{
+        id:      randID(),
+        cancel:  cancel,
+        nextSeq: 1,
+        doneCh:  make(chan struct{}),
+    }
+    j.status = JobStatus{ID: j.id, Argv: append([]string(nil), req.Argv...), Cwd: cwd, State: JobRunning, StartedAt: time.Now()}
+    m.mu.Lock()
+    spoolDir, spoolDone, scrub := m.spoolDir, m.spoolDone, m.scrub
+    m.mu.Unlock()
+    spools := map[string]*os.File{}
+    if req.SpoolBytes > 0 && spoolDir != "" && spoolDone != nil && os.MkdirAll(spoolDir, 0o755) == nil {
+        for _, stream := range []string{"stdout", "stderr"} {
+            if f, err := os.Create(filepath.Join(spoolDir, j.id+"."+stream)); err == nil {
+                spools[stream] = f
+            }
+        }
+    }
+    // closeSpools returns the spooled streams larger than SpoolBytes and
+    // removes the rest.
+    closeSpools := func() map[string]string {
+        files := map[string]string{}
+        for stream, f := range spools {
+            fi, err := f.Stat()
+            _ = f.Close()
+            if err == nil && fi.Size() > req.SpoolBytes {
+                files[stream] = f.Name()
+            } else {
+                _ = os.Remove(f.Name())
+            }
+        }
+        return files
+    }
+    limit := &outputLimit{max: req.KillAfterBytes, kill: cancel}
+    stdout, stderr := newJobStream(j, "stdout", scrub), newJobStream(j, "stderr", scrub)
+    stdout.spool, stdout.limit, stdout.max, stdout.keepTail = spools["stdout"], limit, req.MaxStdoutBytes, req.KeepTail
+    stderr.spool, stderr.limit, stderr.max, stderr.keepTail = spools["stderr"], limit, req.MaxStderrBytes, req.KeepTail
+    cmd.Stdout, cmd.Stderr = stdout, stderr
+    if err := cmd.Start(); err != nil {
+        cancel()
+        for _, name := range closeSpools() {
+            _ = os.Remove(name)
+        }
+        return "", err
+    }
+    m.mu.Lock()
+    m.jobs[j.id] = j
+    m.pruneLocked()
+    m.mu.Unlock()
+
+    go func() {
+        runErr := cmd.Wait()
+        killGroup(ctx, cmd)
+        rc, err := exitStatus(ctx, req.Timeout, runErr)
+        j.mu.Lock()
+        st, canceled := j.status, j.canceled
+        j.mu.Unlock()
+        st.RC = rc
+        if cmd.ProcessState != nil {
+            st.Exit = exitInfo(cmd.ProcessState)
+        }
+        st.EndedAt = time.Now()
+        st.Usage = usageFromState(cmd.ProcessState)
+        switch {
+        case canceled:
+            st.State = JobCanceled
+        case limit.hit.Load():
+            st.State, st.LimitExceeded = JobFailed, true
+            err = fmt.Errorf("output limit exceeded (%d bytes): %w", req.KillAfterBytes, runErr)
+        case errors.Is(ctx.Err(), context.DeadlineExceeded):
+            st.State = JobTimeout
+        case err != nil:
+            st.State = JobFailed
+        default:
+            st.State = JobExited
+        }
+        if err != nil {
+            st.Err = err.Error()
+        }
+        j.mu.Lock()
+        // writers are done once Wait has returned
+        stdout.finish()
+        stderr.finish()
+        st.StdoutTotal, st.StdoutTruncated = stdout.total, stdout.truncated()
+        st.StderrTotal, st.StderrTruncated = stderr.total, stderr.truncated()
+        files := closeSpools()
+        j.mu.Unlock()
+        if len(files) > 0 {
+            st.Artifacts = spoolDone(st, files)
+        }
+        j.mu.Lock()
+        j.status = st
+        j.mu.Unlock()
+        cancel()
+        close(j.doneCh)
+    }()
+    return j.id, nil
+}
+
+// pruneLocked forgets the oldest finished jobs beyond maxFinishedJobs. Caller holds m.mu.
+func (m *JobManager) pruneLocked() {
+    var finished []*Job
+    for _, j := range m.jobs {
+        if j.Status().Done() {
+            finished = append(finished, j)
+        }
+    }
+    if len(finished) <= maxFinishedJobs {
+        return
+    }
+    sort.Slice(finished, func(a, b int) bool {
+        return finished[a].Status().EndedAt.Before(finished[b].Status().EndedAt)
+    })
+    for _, j := range finished[:len(finished)-maxFinishedJobs] {
+        delete(m.jobs, j.id)
+        if m.forget != nil {
+            m.forget(j.id)
+        }
+    }
+}
+
+func (m *JobManager) get(id string) *Job {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.jobs[id]
+}
+
+// Status returns a snapshot of the job.
+func (j *Job) Status() JobStatus {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    return j.status
+}
+
+// Read returns chunks with seq > sinceSeq, up to maxBytes or until timeout,
+// and whether the job has finished with all output delivered.
+func (m *JobManager) Read(id string, sinceSeq uint64, maxBytes int, timeout time.Duration) ([]Chunk, bool, error) {
+    j := m.get(id)
+    if j == nil {
+        return nil, false, errors.New("no such job")
+    }
+    deadline := time.Now().Add(timeout)
+    for {
+        j.mu.Lock()
+        var out []Chunk
+        bytes := 0
+        for _, c := range j.chunks {
+            if c.Seq <= sinceSeq { continue }
+            out = append(out, c)
+            bytes += len(c.Data)
+            if maxBytes > 0 && bytes >= maxBytes {
+                break
+            }
+        }
+        done := j.status.Done()
+        if done && len(out) > 0 && out[len(out)-1].Seq != j.nextSeq-1 {
+            // more output remains beyond maxBytes
+            done = false
+        }
+        j.mu.Unlock()
+        if len(out) > 0 || done || time.Now().After(deadline) {
+            return out, done, nil
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
+// Status returns a snapshot of job id without waiting.
+func (m *JobManager) Status(id string) (JobStatus, error) {
+    j := m.get(id)
+    if j == nil {
+        return JobStatus{}, errors.New("no such job")
+    }
+    return j.Status(), nil
+}
+
+// Wait blocks until the job finishes or timeout elapses (0 waits forever).
+func (m *JobManager) Wait(id string, timeout time.Duration) (JobStatus, error) {
+    j := m.get(id)
+    if j == nil {
+        return JobStatus{}, errors.New("no such job")
+    }
+    if timeout > 0 {
+        select {
+        case <-j.doneCh:
+        case <-time.After(timeout):
+        }
+    } else {
+        <-j.doneCh
+    }
+    return j.Status(), nil
+}
+
+// Cancel kills a running job; finished jobs are left untouched.
+func (m *JobManager) Cancel(id string) (JobStatus, error) {
+    j := m.get(id)
+    if j == nil {
+        return JobStatus{}, errors.New("no such job")
+    }
+    j.mu.Lock()
+    running := !j.status.Done()
+    if running {
+        j.canceled = true
+    }
+    j.mu.Unlock()
+    if running {
+        j.cancel()
+        select {
+        case <-j.doneCh:
+        case <-time.After(5 * time.Second):
+        }
+    }
+    return j.Status(), nil
+}
+
+// List returns all known jobs, oldest first.
+func (m *JobManager) List() []JobStatus {
+    m.mu.Lock()
+    out := make([]JobStatus, 0, len(m.jobs))
+    for _, j := range m.jobs {
+        out = append(out, j.Status())
+    }
+    m.mu.Unlock()
+    sort.Slice(out, func(a, b int) bool { return out[a].StartedAt.Before(out[b].StartedAt) })
+    return out
+}
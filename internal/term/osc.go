@@ -0,0 +1,140 @@
+package term
+
+import (
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Event kinds extracted from PTY output.
+const (
+    EventTitle           = "title"            // OSC 0/2
+    EventCwd             = "cwd"              // OSC 7
+    EventPromptStart     = "prompt_start"     // OSC 133;A
+    EventCommandStart    = "command_start"    // OSC 133;B
+    EventCommandExecuted = "command_executed" // OSC 133;C
+    EventCommandFinished = "command_finished" // OSC 133;D[;rc]
+    EventBell            = "bell"             // BEL outside an OSC
+)
+
+// Event is a structured terminal notification correlated with the chunk it arrived in.
+type Event struct {
+    Seq      uint64
+    ChunkSeq uint64
+    Ts       time.Time
+    Kind     string
+    Value    string // title text, cwd path, etc.
+    ExitCode *int   // command_finished only, when reported
+}
+
+// maxEvents bounds the per-session event log (oldest evicted).
+const maxEvents = 4096
+
+// maxOSCLen bounds a single OSC payload; longer sequences are dropped.
+const maxOSCLen = 4096
+
+const (
+    oscNormal = iota
+    oscEsc
+    oscBody
+    oscBodyEsc
+)
+
+// oscParser extracts OSC sequences and BEL from a byte stream. It keeps state
+// across calls so sequences split between reads are still recognised.
+type oscParser struct {
+    state    int
+    buf      []byte
+    overflow bool
+}
+
+// feed scans data and calls emit for each recognised event.
+func (p *oscParser) feed(data []byte, emit func(kind, value string, rc *int)) {
+    for _, b := range data {
+        switch p.state {
+        case oscNormal:
+            switch b {
+            case 0x1b:
+                p.state = oscEsc
+            case 0x07:
+                emit(EventBell, "", nil)
+            }
+        case oscEsc:
+            switch b {
+            case ']':
+                p.state = oscBody
+                p.buf = p.buf[:0]
+                p.overflow = false
+            case 0x1b:
+                // stay
+            default:
+                p.state = oscNormal
+            }
+        case oscBody:
+            switch b {
+            case 0x07:
+                p.finish(emit)
+            case 0x1b:
+                p.state = oscBodyEsc
+            default:
+                if len(p.buf) < maxOSCLen {
+                    p.buf = append(p.buf, b)
+                } else {
+                    p.overflow = true
+                }
+            }
+        case oscBodyEsc:
+            if b == '\\' {
+                p.finish(emit)
+            } else if b == ']' {
+                // aborted OSC immediately followed by a new one
+                p.state = oscBody
+                p.buf = p.buf[:0]
+                p.overflow = false
+            } else {
+                p.state = oscNormal
+            }
+        }
+    }
+}
+
+func (p *oscParser) finish(emit func(kind, value string, rc *int)) {
+    p.state = oscNormal
+    if p.overflow {
+        return
+    }
+    code, rest, _ := strings.Cut(string(p.buf), ";")
+    switch code {
+    case "0", "2":
+        emit(EventTitle, rest, nil)
+    case "7":
+        emit(EventCwd, cwdFromOSC7(rest), nil)
+    case "133":
+        mark, params, _ := strings.Cut(rest, ";")
+        switch mark {
+        case "A":
+            emit(EventPromptStart, "", nil)
+        case "B":
+            emit(EventCommandStart, "", nil)
+        case "C":
+            emit(EventCommandExecuted, "", nil)
+        case "D":
+            var rc *int
+            first, _, _ := strings.Cut(params, ";")
+            if n, err := strconv.Atoi(first); err == nil {
+                rc = &n
+            }
+            emit(EventCommandFinished, "", rc)
+        }
+    }
+}
+
+// cwdFromOSC7 turns file://host/path into a path; anything else is returned as-is.
+func cwdFromOSC7(s string) string {
+    u, err := url.Parse(s)
+    if err != nil || u.Scheme != "file" {
+        return s
+    }
+    return u.Path
+}
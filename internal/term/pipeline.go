@@ -0,0 +1,197 @@
+package term
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "syscall"
+    "time"
+)
+
+// PipelineStage is one command of a pipeline. An empty Cwd or nil Env
+// inherits the value from the RunRequest.
+type PipelineStage struct {
+    Argv []string
+    Cwd  string
+    Env  map[string]string
+}
+
+// StageResult reports how one pipeline stage finished.
+type StageResult struct {
+    Argv            []string
+    RC              int
+    Exit            ExitInfo
+    Stderr          []byte
+    StderrTotal     int64
+    StderrTruncated bool
+    Usage           *Usage
+}
+
+// runPipeline connects the stages of req.Pipeline with OS pipes, like a shell
+// would, and runs them in one process group. Stdin feeds the first stage and
+// Stdout captures the last; each stage keeps its own stderr. RC follows
+// pipefail: the status of the rightmost stage that failed, or 0.
+func runPipeline(parentCtx context.Context, req RunRequest) (RunResult, error) {
+    var res RunResult
+    for i, st := range req.Pipeline {
+        if len(st.Argv) == 0 || st.Argv[0] == "" {
+            return res, fmt.Errorf("pipeline stage %d: argv must not be empty", i)
+        }
+    }
+
+    ctx, cancel := context.WithCancel(parentCtx)
+    defer cancel()
+    if req.Timeout > 0 {
+        var tcancel context.CancelFunc
+        ctx, tcancel = context.WithTimeout(ctx, req.Timeout)
+        defer tcancel()
+    }
+
+    limit := &outputLimit{max: req.KillAfterBytes, kill: cancel}
+    stdoutBuf := newCapBuffer(req.MaxStdoutBytes, req.KeepTail, limit)
+    n := len(req.Pipeline)
+    cmds := make([]*exec.Cmd, 0, n)
+    stderrs := make([]*capBuffer, n)
+
+    start := time.Now()
+    pgid := 0
+    var prevRead *os.File
+    var startErr error
+    for i, st := range req.Pipeline {
+        sreq := req
+        sreq.Argv = st.Argv
+        if st.Cwd != "" {
+            sreq.Cwd = st.Cwd
+        }
+        if st.Env != nil {
+            sreq.Env = st.Env
+        }
+        if i > 0 {
+            sreq.Stdin = nil
+        }
+        cmd, cwd := newCommand(ctx, sreq)
+        if i == 0 {
+            res.Cwd = cwd
+        } else {
+            // join the first stage's process group so the pipeline is torn down as a unit
+            cmd.Stdin = prevRead
+            cmd.SysProcAttr.Pgid = pgid
+            cmd.Cancel = func() error { return termGroup(pgid) }
+        }
+        var pw, next *os.File
+        if i < n-1 {
+            r, w, err := os.Pipe()
+            if err != nil {
+                startErr = err
+                break
+            }
+            next, pw = r, w
+            cmd.Stdout = w
+        } else {
+            cmd.Stdout = stdoutBuf
+        }
+        stderrs[i] = newCapBuffer(req.MaxStderrBytes, req.KeepTail, limit)
+        cmd.Stderr = stderrs[i]
+
+        err := cmd.Start()
+        // the children hold their own copies of the pipe ends
+        if prevRead != nil {
+            prevRead.Close()
+        }
+        if pw != nil {
+            pw.Close()
+        }
+        prevRead = next
+        if err != nil {
+            startErr = fmt.Errorf("pipeline stage %d: %w", i, err)
+            break
+        }
+        if i == 0 {
+            pgid = cmd.Process.Pid
+        }
+        cmds = append(cmds, cmd)
+    }
+    if prevRead != nil {
+        prevRead.Close()
+    }
+    if startErr != nil {
+        cancel()
+    }
+
+    errs := make([]error, len(cmds))
+    for i, cmd := range cmds {
+        errs[i] = cmd.Wait()
+    }
+    res.Duration = time.Since(start)
+    if pgid != 0 {
+        _ = syscall.Kill(-pgid, syscall.SIGKILL)
+    }
+
+    res.Stdout = stdoutBuf.Bytes()
+    res.StdoutTotal, res.StdoutTruncated = stdoutBuf.Total(), stdoutBuf.Truncated()
+    res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+    var firstErr error
+    failed := -1
+    for i, cmd := range cmds {
+        sr := StageResult{
+            Argv:            req.Pipeline[i].Argv,
+            Exit:            exitInfo(cmd.ProcessState),
+            Stderr:          stderrs[i].Bytes(),
+            StderrTotal:     stderrs[i].Total(),
+            StderrTruncated: stderrs[i].Truncated(),
+            Usage:           usageFromState(cmd.ProcessState),
+        }
+        rc, err := exitStatus(ctx, req.Timeout, errs[i])
+        sr.RC = rc
+        if err != nil && firstErr == nil {
+            firstErr = fmt.Errorf("pipeline stage %d: %w", i, err)
+        }
+        if rc != 0 {
+            failed = i
+        }
+        res.Stages = append(res.Stages, sr)
+        res.Stderr = append(res.Stderr, sr.Stderr...)
+        res.StderrTotal += sr.StderrTotal
+        res.StderrTruncated = res.StderrTruncated || sr.StderrTruncated
+        res.Usage = addUsage(res.Usage, sr.Usage)
+    }
+    if failed >= 0 {
+        sr := res.Stages[failed]
+        res.RC = sr.RC
+        res.Signal, res.SignalNum, res.CoreDumped = sr.Exit.Signal, sr.Exit.SignalNum, sr.Exit.CoreDumped
+    }
+
+    switch {
+    case startErr != nil:
+        res.RC = 127
+        return res, startErr
+    case limit.hit.Load():
+        res.LimitExceeded = true
+        return res, fmt.Errorf("output limit exceeded (%d bytes)", req.KillAfterBytes)
+    }
+    return res, firstErr
+}
+
+// addUsage accumulates b into a: times, faults and switches add up while
+// MaxRSSKB keeps the larger peak.
+func addUsage(a, b *Usage) *Usage {
+    if b == nil {
+        return a
+    }
+    if a == nil {
+        c := *b
+        return &c
+    }
+    a.UserCPU += b.UserCPU
+    a.SysCPU += b.SysCPU
+    if b.MaxRSSKB > a.MaxRSSKB {
+        a.MaxRSSKB = b.MaxRSSKB
+    }
+    a.MinorFaults += b.MinorFaults
+    a.MajorFaults += b.MajorFaults
+    a.VolCtxSwitches += b.VolCtxSwitches
+    a.InvolCtxSwitches += b.InvolCtxSwitches
+    return a
+}
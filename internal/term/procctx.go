@@ -0,0 +1,83 @@
+package term
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// ProcContext is the working directory and environment of a live process.
+type ProcContext struct {
+    PID  int
+    Comm string
+    Cwd  string
+    Env  map[string]string
+}
+
+// ReadProcContext resolves cwd and environment of pid from /proc.
+func ReadProcContext(pid int) (ProcContext, error) {
+    pc := ProcContext{PID: pid}
+    base := "/proc/" + strconv.Itoa(pid)
+    cwd, err := os.Readlink(base + "/cwd")
+    if err != nil {
+        return pc, err
+    }
+    pc.Cwd = cwd
+    raw, err := os.ReadFile(base + "/environ")
+    if err != nil {
+        return pc, err
+    }
+    pc.Env = map[string]string{}
+    for _, kv := range bytes.Split(raw, []byte{0}) {
+        if k, v, ok := strings.Cut(string(kv), "="); ok && k != "" {
+            pc.Env[k] = v
+        }
+    }
+    if comm, err := os.ReadFile(base + "/comm"); err == nil {
+        pc.Comm = strings.TrimSpace(string(comm))
+    }
+    return pc, nil
+}
+
+// foregroundPID returns the foreground process group of the terminal that
+// pid is attached to (field tpgid of /proc/<pid>/stat).
+func foregroundPID(pid int) (int, error) {
+    raw, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+    if err != nil {
+        return 0, err
+    }
+    // comm may contain spaces and parens; fields resume after the last ')'
+    i := bytes.LastIndexByte(raw, ')')
+    if i < 0 {
+        return 0, errors.New("malformed stat")
+    }
+    fields := strings.Fields(string(raw[i+1:]))
+    // state ppid pgrp session tty_nr tpgid
+    if len(fields) < 6 {
+        return 0, errors.New("malformed stat")
+    }
+    tpgid, err := strconv.Atoi(fields[5])
+    if err != nil || tpgid <= 0 {
+        return 0, fmt.Errorf("no foreground process group for pid %d", pid)
+    }
+    return tpgid, nil
+}
+
+// ForegroundContext returns the cwd and environment of the foreground process
+// in the session's terminal, falling back to the session leader.
+func (m *PTYManager) ForegroundContext(id string) (ProcContext, error) {
+    s := m.get(id)
+    if s == nil {
+        return ProcContext{}, errors.New("no such session")
+    }
+    leader := s.cmd.Process.Pid
+    if fg, err := foregroundPID(leader); err == nil {
+        if pc, err := ReadProcContext(fg); err == nil {
+            return pc, nil
+        }
+    }
+    return ReadProcContext(leader)
+}
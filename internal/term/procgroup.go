@@ -0,0 +1,120 @@
+package term
+
+import (
+    "context"
+    "errors"
+    "os"
+    "os/exec"
+    "strconv"
+    "syscall"
+    "time"
+)
+
+// DefaultKillGrace is how long a process tree gets between SIGTERM and SIGKILL.
+const DefaultKillGrace = 2 * time.Second
+
+// useProcessGroup starts cmd in a process group of its own. Canceling the
+// command's context delivers SIGTERM to the whole group; WaitDelay bounds
+// how long Wait keeps waiting for descendants holding the output pipes.
+// Call killGroup after Wait to SIGKILL whatever a canceled command left.
+func useProcessGroup(cmd *exec.Cmd, grace time.Duration) {
+    if grace <= 0 {
+        grace = DefaultKillGrace
+    }
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+    cmd.Cancel = func() error { return termGroup(cmd.Process.Pid) }
+    cmd.WaitDelay = grace
+}
+
+// termGroup sends SIGTERM to process group pgid; an empty group reports
+// os.ErrProcessDone as exec.Cmd.Cancel expects.
+func termGroup(pgid int) error {
+    err := syscall.Kill(-pgid, syscall.SIGTERM)
+    if errors.Is(err, syscall.ESRCH) {
+        return os.ErrProcessDone
+    }
+    return err
+}
+
+// killGroup SIGKILLs what is left of the process group led by cmd once ctx
+// has ended it (timeout, cancel or output limit). A command that exits on
+// its own keeps whatever it deliberately put in the background.
+func killGroup(ctx context.Context, cmd *exec.Cmd) {
+    if cmd.Process == nil || ctx.Err() == nil {
+        return
+    }
+    // the leader has been reaped; a live process with its pid means the
+    // group emptied and the id now belongs to someone else
+    if _, err := readProcStat(cmd.Process.Pid); err == nil {
+        return
+    }
+    _ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// sessionGroups lists the process groups in session sid, scanning /proc.
+func sessionGroups(sid int) []int {
+    ents, err := os.ReadDir("/proc")
+    if err != nil {
+        return nil
+    }
+    seen := map[int]bool{}
+    var out []int
+    for _, e := range ents {
+        pid, err := strconv.Atoi(e.Name())
+        if err != nil {
+            continue
+        }
+        st, err := readProcStat(pid)
+        if err != nil || st.session != sid || st.state == 'Z' || seen[st.pgrp] {
+            continue
+        }
+        seen[st.pgrp] = true
+        out = append(out, st.pgrp)
+    }
+    return out
+}
+
+// signalSession delivers sig to every process group in session sid and
+// reports whether any were found. Only groups seen alive in the scan are
+// signalled, so a group id that has since been freed is left alone.
+func signalSession(sid int, sig syscall.Signal) bool {
+    groups := sessionGroups(sid)
+    for _, pg := range groups {
+        _ = syscall.Kill(-pg, sig)
+    }
+    return len(groups) > 0
+}
+
+// terminateSession hangs up and terminates every process in the session led
+// by leader, escalating to SIGKILL for anything still alive after grace.
+// leaderDone is closed once the leader has been reaped; from then on only
+// groups found in the session are signalled, never the leader's pid, which
+// may already belong to another process.
+func terminateSession(leader *os.Process, grace time.Duration, leaderDone <-chan struct{}) {
+    if grace <= 0 {
+        grace = DefaultKillGrace
+    }
+    sid := leader.Pid
+    signalLeader := func(sig syscall.Signal) {
+        select {
+        case <-leaderDone:
+        default:
+            _ = leader.Signal(sig)
+        }
+    }
+    signalLeader(syscall.SIGHUP)
+    signalSession(sid, syscall.SIGTERM)
+    deadline := time.Now().Add(grace)
+    for time.Now().Before(deadline) {
+        select {
+        case <-leaderDone:
+            if len(sessionGroups(sid)) == 0 {
+                return
+            }
+        default:
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+    signalSession(sid, syscall.SIGKILL)
+    signalLeader(syscall.SIGKILL)
+}
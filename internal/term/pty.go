@@ -22,11 +22,27 @@ type Chunk struct {
     Ts     time.Time
 }
 
+// OpenRequest describes a PTY session to start.
+type OpenRequest struct {
+    Argv   []string
+    Rows   int
+    Cols   int
+    Cwd    string
+    Env    map[string]string
+    Labels map[string]string // free-form tags recorded in session history
+    // Responders answer prompts automatically; each firing is recorded as an event.
+    Responders []ResponderRule
+}
+
 // PTYSession holds state for a running PTY process.
 type PTYSession struct {
     id      string
     cmd     *exec.Cmd
     pty     *os.File
+    argv    []string
+    cwd     string
+    labels  map[string]string
+    started time.Time
 
     mu       sync.Mutex
     chunks   []Chunk
@@ -34,11 +50,47 @@ type PTYSession struct {
     closed   bool
     closedCh chan struct{}
     exitRC   *int
+    exit     ExitInfo // valid once exitedAt is set
+    exitedAt time.Time
+    usage    *Usage // final usage, set when the process is reaped
+    doneCh   chan struct{} // closed once the process has been reaped
+    bytesIn  int64
+    bytesOut int64
+
+    // terminal events (OSC title/cwd/marks, BEL)
+    osc       oscParser
+    events    []Event
+    nextEvent uint64
+    title     string
+    termCwd   string
+
+    // auto-responders
+    responders []*responder
+    respBuf    []byte
+    nextRespID int
+    respQueue  []queuedResponse // fired responses, written in order by one writer
+    respBusy   bool             // the writer goroutine is running
 
     cond *sync.Cond
 
     // logging
-    logf *os.File
+    log *sessionLog
+
+    // log filtering with hold-back of partial matches
+    logFilter Redactor
+    logMu     sync.Mutex
+    logPend   []byte
+    logGen    uint64
+    logSeq    uint64 // seq of the chunk the held-back bytes belong to
+    logTimer  *time.Timer
+
+    // secret scrubbing with hold-back of partial matches
+    scrub     Redactor
+    expand    Expander // responder responses
+    pendMu    sync.Mutex
+    pending   []byte
+    pendGen   uint64
+    pendTimer *time.Timer
 }
 
 // PTYManager manages multiple PTY sessions.
@@ -48,6 +100,12 @@ type PTYManager struct {
     // Configuration
     maxBytes int // cap total buffered bytes per session (evict oldest)
     baseDir  string // base directory for session logs
+    logRot   LogRotation
+    history  *History
+    scrub    Redactor
+    logFilt  Redactor
+    expand   Expander
+    grace    time.Duration // SIGTERM to SIGKILL delay on close
 }
 
 func NewPTYManager() *PTYManager {
@@ -55,21 +113,84 @@ func NewPTYManager() *PTYManager {
         sessions: make(map[string]*PTYSession),
         maxBytes: 1 << 20, // 1 MiB
         baseDir:  "/tmp/aiterm/sessions",
+        logRot:   DefaultLogRotation(),
+        grace:    DefaultKillGrace,
     }
 }
 
+// SetKillGrace sets how long PTYClose waits between SIGTERM and SIGKILL.
+func (m *PTYManager) SetKillGrace(d time.Duration) {
+    m.mu.Lock()
+    m.grace = d
+    m.mu.Unlock()
+}
+
+// SetLogRotation configures segment rotation for session logs opened afterwards.
+func (m *PTYManager) SetLogRotation(r LogRotation) {
+    m.mu.Lock()
+    m.logRot = r
+    m.mu.Unlock()
+}
+
+// SetRedactor sets the scrubber applied to output of sessions opened afterwards.
+func (m *PTYManager) SetRedactor(r Redactor) {
+    m.mu.Lock()
+    m.scrub = r
+    m.mu.Unlock()
+}
+
+// SetExpander sets the expansion applied to auto-responder responses.
+func (m *PTYManager) SetExpander(e Expander) {
+    m.mu.Lock()
+    m.expand = e
+    m.mu.Unlock()
+}
+
+// SetLogFilter sets a rewrite applied to output before it reaches session logs.
+func (m *PTYManager) SetLogFilter(f Redactor) {
+    m.mu.Lock()
+    m.logFilt = f
+    m.mu.Unlock()
+}
+
+// SetHistory sets the registry that records sessions when they are closed.
+func (m *PTYManager) SetHistory(h *History) {
+    m.mu.Lock()
+    m.history = h
+    m.mu.Unlock()
+}
+
+// History returns the session history registry, or nil if disabled.
+func (m *PTYManager) History() *History {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.history
+}
+
 // PTYOpen starts a new PTY session with the given argv and dimensions.
-func (m *PTYManager) PTYOpen(argv []string, rows, cols int, cwd string, env map[string]string) (string, error) {
+func (m *PTYManager) PTYOpen(req OpenRequest) (string, error) {
+    argv, rows, cols := req.Argv, req.Rows, req.Cols
     if len(argv) == 0 {
         return "", errors.New("argv must not be empty")
     }
+    m.mu.Lock()
+    expand := m.expand
+    m.mu.Unlock()
+    var respID int
+    responders, err := compileResponders(req.Responders, &respID, nil, expand)
+    if err != nil {
+        return "", err
+    }
     cmd := exec.Command(argv[0], argv[1:]...)
+    cwd := req.Cwd
     if cwd != "" {
         cmd.Dir = cwd
+    } else if wd, err := os.Getwd(); err == nil {
+        cwd = wd
     }
     // Build a minimal env
     var envv []string
-    for k, v := range env {
+    for k, v := range req.Env {
         envv = append(envv, fmt.Sprintf("%s=%s", k, v))
     }
     cmd.Env = envv
@@ -89,21 +210,35 @@ func (m *PTYManager) PTYOpen(argv []string, rows, cols int, cwd string, env map[
     _ = ptylib.Setsize(pty, &ptylib.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
 
     s := &PTYSession{
-        id:       randID(),
-        cmd:      cmd,
-        pty:      pty,
-        chunks:   make([]Chunk, 0, 128),
-        nextSeq:  1,
-        closedCh: make(chan struct{}),
+        id:         randID(),
+        cmd:        cmd,
+        pty:        pty,
+        argv:       append([]string(nil), argv...),
+        cwd:        cwd,
+        labels:     req.Labels,
+        started:    time.Now(),
+        chunks:     make([]Chunk, 0, 128),
+        nextSeq:    1,
+        nextEvent:  1,
+        responders: responders,
+        nextRespID: respID,
+        closedCh:   make(chan struct{}),
+        doneCh:     make(chan struct{}),
     }
     s.cond = sync.NewCond(&s.mu)
+    m.mu.Lock()
+    s.scrub = m.scrub
+    s.logFilter = m.logFilt
+    s.expand = expand
+    m.mu.Unlock()
 
-    // Prepare log file path
+    // Prepare seq-indexed session log
     if m.baseDir != "" {
-        _ = os.MkdirAll(m.baseDir, 0o755)
-        logPath := m.baseDir + "/" + s.id + ".log"
-        if f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644); err == nil {
-            s.logf = f
+        m.mu.Lock()
+        rot := m.logRot
+        m.mu.Unlock()
+        if l, err := openSessionLog(m.baseDir, s.id, rot); err == nil {
+            s.log = l
         }
     }
 
@@ -121,21 +256,17 @@ func (s *PTYSession) reader() {
     for {
         n, err := s.pty.Read(buf)
         if n > 0 {
-            s.mu.Lock()
             data := make([]byte, n)
             copy(data, buf[:n])
-            s.chunks = append(s.chunks, Chunk{Seq: s.nextSeq, Stream: "stdout", Data: data, Ts: time.Now()})
-            s.nextSeq++
-            // enforce cap
-            s.enforceCap()
-            s.cond.Broadcast()
-            s.mu.Unlock()
-            // async log write (best-effort)
-            if s.logf != nil {
-                _, _ = s.logf.Write(data)
+            if s.scrub != nil {
+                s.scrubAndIngest(data)
+            } else {
+                s.ingest(data)
             }
         }
         if err != nil {
+            s.drainPending()
+            s.drainLog()
             if err == io.EOF {
                 s.mu.Lock()
                 s.closed = true
@@ -148,13 +279,39 @@ func (s *PTYSession) reader() {
     }
 }
 
+// ingest appends output as a new chunk and feeds events, responders and the log.
+// Only the reader (or the scrub flush, serialised by pendMu) calls it.
+func (s *PTYSession) ingest(data []byte) {
+    s.mu.Lock()
+    c := Chunk{Seq: s.nextSeq, Stream: "stdout", Data: data, Ts: time.Now()}
+    s.chunks = append(s.chunks, c)
+    s.nextSeq++
+    s.bytesOut += int64(len(data))
+    s.osc.feed(data, func(kind, value string, rc *int) {
+        s.addEvent(c.Seq, kind, value, rc)
+    })
+    s.matchResponders(c.Seq, data)
+    // enforce cap
+    s.enforceCap()
+    s.cond.Broadcast()
+    s.mu.Unlock()
+    // log write with seq index (best-effort)
+    if s.log != nil {
+        s.logChunk(c)
+    }
+}
+
 func (s *PTYSession) waiter() {
     _ = s.cmd.Wait()
     s.mu.Lock()
+    s.exit = exitInfo(s.cmd.ProcessState)
     if s.exitRC == nil {
-        rc := exitCodeFromWait(s.cmd.ProcessState)
+        rc := s.exit.RC
         s.exitRC = &rc
     }
+    s.usage = usageFromState(s.cmd.ProcessState)
+    s.exitedAt = time.Now()
+    close(s.doneCh)
     s.closed = true
     select {
     case <-s.closedCh:
@@ -180,21 +337,76 @@ func (s *PTYSession) enforceCap() {
 
 func capSize() int { return 1 << 20 }
 
+// addEvent records a terminal event. Caller holds s.mu.
+func (s *PTYSession) addEvent(chunkSeq uint64, kind, value string, rc *int) {
+    switch kind {
+    case EventTitle:
+        s.title = value
+    case EventCwd:
+        s.termCwd = value
+    }
+    s.events = append(s.events, Event{Seq: s.nextEvent, ChunkSeq: chunkSeq, Ts: time.Now(), Kind: kind, Value: value, ExitCode: rc})
+    s.nextEvent++
+    if len(s.events) > maxEvents {
+        s.events = append([]Event(nil), s.events[len(s.events)-maxEvents:]...)
+    }
+}
+
+// TermState is the latest terminal state reported through OSC sequences.
+type TermState struct {
+    Title string
+    Cwd   string
+}
+
+// PTYEvents returns events with seq > sinceSeq, waiting up to timeout for new ones.
+func (m *PTYManager) PTYEvents(id string, sinceSeq uint64, timeout time.Duration) ([]Event, TermState, bool, error) {
+    s := m.get(id)
+    if s == nil {
+        return nil, TermState{}, false, errors.New("no such session")
+    }
+    deadline := time.Now().Add(timeout)
+    for {
+        s.mu.Lock()
+        var out []Event
+        for _, e := range s.events {
+            if e.Seq > sinceSeq {
+                out = append(out, e)
+            }
+        }
+        st := TermState{Title: s.title, Cwd: s.termCwd}
+        closed := s.closed
+        s.mu.Unlock()
+        if len(out) > 0 || closed || timeout <= 0 || time.Now().After(deadline) {
+            return out, st, closed, nil
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
 // PTYSend writes data to the session.
 func (m *PTYManager) PTYSend(id string, data []byte) (int, error) {
     s := m.get(id)
     if s == nil {
         return 0, errors.New("no such session")
     }
-    return s.pty.Write(data)
+    n, err := s.pty.Write(data)
+    s.mu.Lock()
+    s.bytesIn += int64(n)
+    s.mu.Unlock()
+    return n, err
 }
 
 // PTYRead returns chunks with seq > sinceSeq, up to maxBytes or until timeout.
+// Chunks already evicted from memory are served from the session log on disk.
 func (m *PTYManager) PTYRead(id string, sinceSeq uint64, maxBytes int, timeout time.Duration) ([]Chunk, bool, error) {
     s := m.get(id)
     if s == nil {
         return nil, false, errors.New("no such session")
     }
+    if out := s.readHistory(sinceSeq, maxBytes); len(out) > 0 {
+        // more data follows in memory, so the session is never reported closed here
+        return out, false, nil
+    }
     deadline := time.Now().Add(timeout)
     for {
         s.mu.Lock()
@@ -226,6 +438,28 @@ func (m *PTYManager) PTYRead(id string, sinceSeq uint64, maxBytes int, timeout t
     }
 }
 
+// readHistory serves seqs older than the in-memory buffer from disk.
+// It returns nil when the request can be satisfied from memory.
+func (s *PTYSession) readHistory(sinceSeq uint64, maxBytes int) []Chunk {
+    if s.log == nil {
+        return nil
+    }
+    s.mu.Lock()
+    oldest := s.nextSeq
+    if len(s.chunks) > 0 {
+        oldest = s.chunks[0].Seq
+    }
+    s.mu.Unlock()
+    if sinceSeq+1 >= oldest {
+        return nil
+    }
+    out, err := s.log.read(sinceSeq, oldest, maxBytes)
+    if err != nil {
+        return nil
+    }
+    return out
+}
+
 // PTYResize updates window size.
 func (m *PTYManager) PTYResize(id string, rows, cols int) error {
     s := m.get(id)
@@ -235,24 +469,123 @@ func (m *PTYManager) PTYResize(id string, rows, cols int) error {
     return ptylib.Setsize(s.pty, &ptylib.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
 }
 
-// PTYClose sends SIGTERM then closes the PTY.
+// PTYClose hangs up and terminates every process in the session's terminal
+// (SIGHUP and SIGTERM, then SIGKILL after the grace period) and closes the PTY.
 func (m *PTYManager) PTYClose(id string) error {
     s := m.get(id)
     if s == nil { return nil }
-    _ = s.cmd.Process.Signal(os.Interrupt)
-    select {
-    case <-s.closedCh:
-    case <-time.After(300 * time.Millisecond):
-        _ = s.cmd.Process.Kill()
-    }
+    m.mu.Lock()
+    grace := m.grace
+    m.mu.Unlock()
+    // the PTY leader runs in its own session, so its pid is the session id
+    terminateSession(s.cmd.Process, grace, s.doneCh)
     _ = s.pty.Close()
-    if s.logf != nil { _ = s.logf.Close() }
+    if s.log != nil {
+        s.drainLog()
+        s.log.close()
+    }
     m.mu.Lock()
     delete(m.sessions, id)
+    h := m.history
     m.mu.Unlock()
+    if h != nil {
+        // give the waiter a moment to reap so the exit status is recorded
+        select {
+        case <-s.doneCh:
+        case <-time.After(time.Second):
+        }
+        _ = h.Append(m.historyEntry(s))
+    }
     return nil
 }
 
+func (m *PTYManager) historyEntry(s *PTYSession) HistoryEntry {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    e := HistoryEntry{
+        ID:        s.id,
+        Argv:      s.argv,
+        Cwd:       s.cwd,
+        Labels:    s.labels,
+        StartedAt: s.started,
+        EndedAt:   s.exitedAt,
+        ExitCode:  s.exitRC,
+        Signal:    s.exit.Signal,
+        SignalNum: s.exit.SignalNum,
+        Core:      s.exit.CoreDumped,
+        BytesIn:   s.bytesIn,
+        BytesOut:  s.bytesOut,
+    }
+    if s.usage != nil {
+        e.CPUMS = s.usage.CPU().Milliseconds()
+        e.MaxRSSKB = s.usage.MaxRSSKB
+    }
+    if e.EndedAt.IsZero() {
+        e.EndedAt = time.Now()
+    }
+    if s.log != nil {
+        e.LogPath = s.log.logPath()
+    }
+    return e
+}
+
+// PTYUsage reports resource usage of the session's process tree. While the
+// process runs it is sampled from /proc (live=true); afterwards it is the
+// final rusage collected when the process was reaped.
+func (m *PTYManager) PTYUsage(id string) (Usage, bool, error) {
+    s := m.get(id)
+    if s == nil {
+        return Usage{}, false, errors.New("no such session")
+    }
+    s.mu.Lock()
+    final, exited := s.usage, !s.exitedAt.IsZero()
+    s.mu.Unlock()
+    if exited {
+        if final == nil {
+            return Usage{}, false, errors.New("usage unavailable")
+        }
+        return *final, false, nil
+    }
+    u, err := TreeUsage(s.cmd.Process.Pid)
+    if err != nil {
+        // raced with exit; the waiter is about to record the final usage
+        select {
+        case <-s.doneCh:
+            return m.PTYUsage(id)
+        case <-time.After(time.Second):
+            return Usage{}, false, err
+        }
+    }
+    return u, true, nil
+}
+
+// PTYStatus is a snapshot of a session's process.
+type PTYStatus struct {
+    ID        string
+    PID       int
+    Argv      []string
+    Running   bool
+    Exit      *ExitInfo // nil while running
+    StartedAt time.Time
+    EndedAt   time.Time // zero while running
+}
+
+// PTYStatus reports whether the session's process is running and how it exited.
+func (m *PTYManager) PTYStatus(id string) (PTYStatus, error) {
+    s := m.get(id)
+    if s == nil {
+        return PTYStatus{}, errors.New("no such session")
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    st := PTYStatus{ID: s.id, PID: s.cmd.Process.Pid, Argv: s.argv, Running: s.exitedAt.IsZero(), StartedAt: s.started, EndedAt: s.exitedAt}
+    if !st.Running {
+        ex := s.exit
+        st.Exit = &ex
+    }
+    return st, nil
+}
+
 func (m *PTYManager) get(id string) *PTYSession {
     m.mu.Lock()
     defer m.mu.Unlock()
@@ -268,23 +601,19 @@ func randID() string {
     return string(b)
 }
 
-// exitCodeFromWait returns a code similar to shell semantics.
-func exitCodeFromWait(ps *os.ProcessState) int {
-    if ps == nil { return -1 }
-    if ws, ok := ps.Sys().(interface{ ExitStatus() int; Signaled() bool; Signal() os.Signal }); ok {
-        if ws.Signaled() {
-            // 128 + signal number is typical convention
-            // Unfortunately ws.Signal() may not expose number portably; fallback -1
-            return -1
-        }
-        return ws.ExitStatus()
-    }
-    return -1
-}
-
 // Helper to ensure we import term and avoid unused error if not yet used elsewhere
 var _ = term.IsTerminal
 
+// SessionLog returns a session's on-disk log, which stays readable after
+// PTYClose; its WriteTo copies every retained segment in order.
+func (m *PTYManager) SessionLog(id string) (io.WriterTo, bool) {
+    m.mu.Lock()
+    s := m.sessions[id]
+    m.mu.Unlock()
+    if s == nil || s.log == nil { return nil, false }
+    return s.log, true
+}
+
 // LogPath returns the log file path for a session if available.
 func (m *PTYManager) LogPath(id string) (string, bool) {
     m.mu.Lock()
@@ -0,0 +1,244 @@
+package term
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "time"
+)
+
+// EventResponder is recorded each time an auto-responder fires; Value is the rule ID.
+const EventResponder = "responder"
+
+// responderWindow bounds how much recent output rules are matched against.
+const responderWindow = 8 << 10
+
+// ResponderRule answers a prompt in PTY output with a canned response.
+type ResponderRule struct {
+    ID       string // assigned if empty
+    Pattern  string // regexp matched against recent output
+    Response []byte
+    Once     bool          // shorthand for MaxCount 1
+    MaxCount int           // 0 means unlimited
+    Delay    time.Duration // wait before writing the response
+}
+
+// ResponderStatus reports a rule and how often it has fired.
+type ResponderStatus struct {
+    ResponderRule
+    Fired     int
+    Exhausted bool
+}
+
+// Expander resolves references such as {{secret:NAME}} in a response; it
+// is the same expansion pty.send applies to its input.
+type Expander interface {
+    Expand(in string) (string, error)
+}
+
+type responder struct {
+    rule  ResponderRule
+    re    *regexp.Regexp
+    fired int
+}
+
+func (r *responder) exhausted() bool {
+    max := r.rule.MaxCount
+    if r.rule.Once {
+        max = 1
+    }
+    return max > 0 && r.fired >= max
+}
+
+// compileResponders validates rules, assigning IDs from *nextID where
+// missing. IDs must be unique among the rules and those in existing, and
+// responses must expand with exp (when set).
+func compileResponders(rules []ResponderRule, nextID *int, existing []*responder, exp Expander) ([]*responder, error) {
+    taken := make(map[string]bool, len(existing)+len(rules))
+    for _, r := range existing {
+        taken[r.rule.ID] = true
+    }
+    for _, rule := range rules {
+        if rule.ID == "" {
+            continue
+        }
+        if taken[rule.ID] {
+            return nil, fmt.Errorf("responder id %q already in use", rule.ID)
+        }
+        taken[rule.ID] = true
+    }
+    out := make([]*responder, 0, len(rules))
+    for _, rule := range rules {
+        if rule.Pattern == "" {
+            return nil, errors.New("responder pattern must not be empty")
+        }
+        re, err := regexp.Compile(rule.Pattern)
+        if err != nil {
+            return nil, fmt.Errorf("responder %q: %w", rule.Pattern, err)
+        }
+        if exp != nil {
+            if _, err := exp.Expand(string(rule.Response)); err != nil {
+                return nil, fmt.Errorf("responder %q: %w", rule.Pattern, err)
+            }
+        }
+        if rule.ID == "" {
+            // skip numbers a caller already claimed
+            for rule.ID == "" || taken[rule.ID] {
+                *nextID++
+                rule.ID = fmt.Sprintf("r%d", *nextID)
+            }
+            taken[rule.ID] = true
+        }
+        out = append(out, &responder{rule: rule, re: re})
+    }
+    return out, nil
+}
+
+// matchResponders scans the output window for prompts. Caller holds s.mu.
+// Each match consumes the window up to its end so a prompt answers once.
+func (s *PTYSession) matchResponders(chunkSeq uint64, data []byte) {
+    if len(s.responders) == 0 {
+        return
+    }
+    s.respBuf = append(s.respBuf, data...)
+    if len(s.respBuf) > responderWindow {
+        s.respBuf = append([]byte(nil), s.respBuf[len(s.respBuf)-responderWindow:]...)
+    }
+    for {
+        var hit *responder
+        end := -1
+        start := -1
+        for _, r := range s.responders {
+            if r.exhausted() {
+                continue
+            }
+            if loc := r.re.FindIndex(s.respBuf); loc != nil && (hit == nil || loc[0] < start) {
+                hit, start, end = r, loc[0], loc[1]
+            }
+        }
+        if hit == nil {
+            return
+        }
+        s.respBuf = append([]byte(nil), s.respBuf[end:]...)
+        hit.fired++
+        s.respQueue = append(s.respQueue, queuedResponse{chunkSeq, hit.rule})
+        if !s.respBusy {
+            s.respBusy = true
+            go s.writeResponses()
+        }
+    }
+}
+
+// queuedResponse is a fired rule waiting to be written.
+type queuedResponse struct {
+    chunkSeq uint64
+    rule     ResponderRule
+}
+
+// writeResponses writes queued responses in the order their prompts
+// matched, so a short delay never overtakes an earlier answer. It exits
+// once the queue is empty.
+func (s *PTYSession) writeResponses() {
+    for {
+        s.mu.Lock()
+        if len(s.respQueue) == 0 {
+            s.respBusy = false
+            s.mu.Unlock()
+            return
+        }
+        q := s.respQueue[0]
+        s.respQueue = s.respQueue[1:]
+        s.mu.Unlock()
+        s.respond(q.chunkSeq, q.rule)
+    }
+}
+
+// respond writes a rule's response, expanding references when it fires so
+// the rule itself only ever holds the placeholder.
+func (s *PTYSession) respond(chunkSeq uint64, rule ResponderRule) {
+    if rule.Delay > 0 {
+        time.Sleep(rule.Delay)
+    }
+    resp := rule.Response
+    var err error
+    if s.expand != nil {
+        var x string
+        if x, err = s.expand.Expand(string(resp)); err == nil {
+            resp = []byte(x)
+        }
+    }
+    if err == nil {
+        _, err = s.pty.Write(resp)
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err != nil {
+        s.addEvent(chunkSeq, EventResponder, rule.ID+": "+err.Error(), nil)
+        return
+    }
+    s.bytesIn += int64(len(resp))
+    s.addEvent(chunkSeq, EventResponder, rule.ID, nil)
+}
+
+// AddResponders installs rules on a running session and returns their IDs.
+func (m *PTYManager) AddResponders(id string, rules []ResponderRule) ([]string, error) {
+    s := m.get(id)
+    if s == nil {
+        return nil, errors.New("no such session")
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    rs, err := compileResponders(rules, &s.nextRespID, s.responders, s.expand)
+    if err != nil {
+        return nil, err
+    }
+    ids := make([]string, 0, len(rs))
+    for _, r := range rs {
+        ids = append(ids, r.rule.ID)
+    }
+    s.responders = append(s.responders, rs...)
+    // a prompt may already be waiting in the window
+    s.matchResponders(s.nextSeq-1, nil)
+    return ids, nil
+}
+
+// RemoveResponders drops rules by ID; with no IDs all rules are removed.
+func (m *PTYManager) RemoveResponders(id string, ruleIDs []string) error {
+    s := m.get(id)
+    if s == nil {
+        return errors.New("no such session")
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if len(ruleIDs) == 0 {
+        s.responders = nil
+        return nil
+    }
+    drop := make(map[string]bool, len(ruleIDs))
+    for _, rid := range ruleIDs {
+        drop[rid] = true
+    }
+    kept := s.responders[:0]
+    for _, r := range s.responders {
+        if !drop[r.rule.ID] {
+            kept = append(kept, r)
+        }
+    }
+    s.responders = kept
+    return nil
+}
+
+// Responders lists the session's rules with their fire counts.
+func (m *PTYManager) Responders(id string) ([]ResponderStatus, error) {
+    s := m.get(id)
+    if s == nil {
+        return nil, errors.New("no such session")
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := make([]ResponderStatus, 0, len(s.responders))
+    for _, r := range s.responders {
+        out = append(out, ResponderStatus{ResponderRule: r.rule, Fired: r.fired, Exhausted: r.exhausted()})
+    }
+    return out, nil
+}
@@ -0,0 +1,317 @@
+package term
+
+import (
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// screen renders terminal output onto a rows x cols grid. It implements
+// the subset of VT100/xterm that command-line tools use to redraw text:
+// cursor movement, erasing, line insertion and deletion, scrolling and the
+// alternate screen. Colours and other attributes are dropped.
+type screen struct {
+    rows, cols int
+    cells      [][]rune
+    r, c       int
+    wrap       bool // the next printable character starts a new line
+    savedR     int
+    savedC     int
+    main       [][]rune // primary screen while the alternate one is shown
+
+    state   int
+    params  []byte
+    pending []byte // incomplete UTF-8 sequence
+}
+
+const (
+    scrGround = iota
+    scrEsc
+    scrEscSkip // ESC followed by a charset designator; skip one byte
+    scrCSI
+    scrOSC
+    scrOSCEsc
+)
+
+func newScreen(rows, cols int) *screen {
+    s := &screen{rows: rows, cols: cols}
+    s.cells = s.blank()
+    return s
+}
+
+func (s *screen) blank() [][]rune {
+    g := make([][]rune, s.rows)
+    for i := range g {
+        g[i] = s.blankLine()
+    }
+    return g
+}
+
+func (s *screen) blankLine() []rune {
+    l := make([]rune, s.cols)
+    for i := range l {
+        l[i] = ' '
+    }
+    return l
+}
+
+// Write feeds terminal output; it never fails.
+func (s *screen) Write(p []byte) (int, error) {
+    for _, b := range p {
+        s.feed(b)
+    }
+    return len(p), nil
+}
+
+func (s *screen) feed(b byte) {
+    switch s.state {
+    case scrEsc:
+        s.esc(b)
+        return
+    case scrEscSkip:
+        s.state = scrGround
+        return
+    case scrCSI:
+        switch {
+        case b >= 0x40 && b <= 0x7e:
+            s.csi(b)
+            s.state = scrGround
+        case b >= 0x30 && b <= 0x3f:
+            s.params = append(s.params, b)
+        }
+        return
+    case scrOSC:
+        switch b {
+        case 0x07:
+            s.state = scrGround
+        case 0x1b:
+            s.state = scrOSCEsc
+        }
+        return
+    case scrOSCEsc:
+        s.state = scrGround // ESC \ ends the string
+        return
+    }
+    if len(s.pending) > 0 || b >= 0x80 {
+        s.pending = append(s.pending, b)
+        if !utf8.FullRune(s.pending) {
+            return
+        }
+        r, _ := utf8.DecodeRune(s.pending)
+        s.pending = s.pending[:0]
+        s.put(r)
+        return
+    }
+    switch b {
+    case 0x1b:
+        s.state = scrEsc
+    case '\r':
+        s.c, s.wrap = 0, false
+    case '\n', 0x0b, 0x0c:
+        s.lineFeed()
+    case '\b':
+        if s.c > 0 { s.c-- }
+        s.wrap = false
+    case '\t':
+        s.c = min(s.cols-1, (s.c/8+1)*8)
+    default:
+        if b >= 0x20 && b < 0x7f {
+            s.put(rune(b))
+        }
+    }
+}
+
+func (s *screen) put(r rune) {
+    if s.wrap {
+        s.c, s.wrap = 0, false
+        s.lineFeed()
+    }
+    s.cells[s.r][s.c] = r
+    if s.c == s.cols-1 {
+        s.wrap = true
+    } else {
+        s.c++
+    }
+}
+
+func (s *screen) lineFeed() {
+    s.wrap = false
+    if s.r == s.rows-1 {
+        s.scrollUp(0, 1)
+    } else {
+        s.r++
+    }
+}
+
+// scrollUp removes n lines at row top, shifting the rest up.
+func (s *screen) scrollUp(top, n int) {
+    n = min(n, s.rows-top)
+    copy(s.cells[top:], s.cells[top+n:])
+    for i := s.rows - n; i < s.rows; i++ {
+        s.cells[i] = s.blankLine()
+    }
+}
+
+// scrollDown inserts n blank lines at row top, shifting the rest down.
+func (s *screen) scrollDown(top, n int) {
+    n = min(n, s.rows-top)
+    copy(s.cells[top+n:], s.cells[top:s.rows-n])
+    for i := top; i < top+n; i++ {
+        s.cells[i] = s.blankLine()
+    }
+}
+
+func (s *screen) esc(b byte) {
+    s.state = scrGround
+    switch b {
+    case '[':
+        s.state, s.params = scrCSI, s.params[:0]
+    case ']':
+        s.state = scrOSC
+    case '(', ')', '*', '+', '#':
+        s.state = scrEscSkip
+    case 'D':
+        s.lineFeed()
+    case 'E':
+        s.c = 0
+        s.lineFeed()
+    case 'M':
+        if s.r == 0 {
+            s.scrollDown(0, 1)
+        } else {
+            s.r--
+        }
+    case '7':
+        s.savedR, s.savedC = s.r, s.c
+    case '8':
+        s.r, s.c, s.wrap = s.savedR, s.savedC, false
+    case 'c':
+        s.cells, s.r, s.c, s.wrap = s.blank(), 0, 0, false
+    }
+}
+
+func (s *screen) csi(final byte) {
+    private := len(s.params) > 0 && s.params[0] == '?'
+    raw := strings.TrimLeft(string(s.params), "?<=>")
+    var args []int
+    for _, f := range strings.Split(raw, ";") {
+        n, _ := strconv.Atoi(f)
+        args = append(args, n)
+    }
+    arg := func(i, def int) int {
+        if i < len(args) && args[i] > 0 {
+            return args[i]
+        }
+        return def
+    }
+    clampR := func(r int) int { return max(0, min(s.rows-1, r)) }
+    clampC := func(c int) int { return max(0, min(s.cols-1, c)) }
+    if private {
+        if final == 'h' || final == 'l' {
+            for _, a := range args {
+                if a == 47 || a == 1047 || a == 1049 {
+                    s.altScreen(final == 'h')
+                }
+            }
+        }
+        return
+    }
+    s.wrap = false
+    switch final {
+    case 'A':
+        s.r = clampR(s.r - arg(0, 1))
+    case 'B', 'e':
+        s.r = clampR(s.r + arg(0, 1))
+    case 'C', 'a':
+        s.c = clampC(s.c + arg(0, 1))
+    case 'D':
+        s.c = clampC(s.c - arg(0, 1))
+    case 'E':
+        s.r, s.c = clampR(s.r+arg(0, 1)), 0
+    case 'F':
+        s.r, s.c = clampR(s.r-arg(0, 1)), 0
+    case 'G', '`':
+        s.c = clampC(arg(0, 1) - 1)
+    case 'd':
+        s.r = clampR(arg(0, 1) - 1)
+    case 'H', 'f':
+        s.r, s.c = clampR(arg(0, 1)-1), clampC(arg(1, 1)-1)
+    case 'J':
+        switch arg(0, 0) {
+        case 0:
+            s.eraseLine(s.r, s.c, s.cols)
+            for r := s.r + 1; r < s.rows; r++ {
+                s.cells[r] = s.blankLine()
+            }
+        case 1:
+            for r := 0; r < s.r; r++ {
+                s.cells[r] = s.blankLine()
+            }
+            s.eraseLine(s.r, 0, s.c+1)
+        default:
+            s.cells = s.blank()
+        }
+    case 'K':
+        switch arg(0, 0) {
+        case 0:
+            s.eraseLine(s.r, s.c, s.cols)
+        case 1:
+            s.eraseLine(s.r, 0, s.c+1)
+        default:
+            s.eraseLine(s.r, 0, s.cols)
+        }
+    case 'X':
+        s.eraseLine(s.r, s.c, min(s.cols, s.c+arg(0, 1)))
+    case 'L':
+        s.scrollDown(s.r, arg(0, 1))
+    case 'M':
+        s.scrollUp(s.r, arg(0, 1))
+    case 'S':
+        s.scrollUp(0, arg(0, 1))
+    case 'T':
+        s.scrollDown(0, arg(0, 1))
+    case 'P':
+        line, n := s.cells[s.r], min(arg(0, 1), s.cols-s.c)
+        copy(line[s.c:], line[s.c+n:])
+        s.eraseLine(s.r, s.cols-n, s.cols)
+    case '@':
+        line, n := s.cells[s.r], min(arg(0, 1), s.cols-s.c)
+        copy(line[s.c+n:], line[s.c:s.cols-n])
+        s.eraseLine(s.r, s.c, s.c+n)
+    case 's':
+        s.savedR, s.savedC = s.r, s.c
+    case 'u':
+        s.r, s.c = s.savedR, s.savedC
+    }
+}
+
+func (s *screen) eraseLine(r, from, to int) {
+    for c := max(0, from); c < min(s.cols, to); c++ {
+        s.cells[r][c] = ' '
+    }
+}
+
+// altScreen switches to (on) or back from the alternate screen.
+func (s *screen) altScreen(on bool) {
+    switch {
+    case on && s.main == nil:
+        s.main, s.cells = s.cells, s.blank()
+        s.savedR, s.savedC = s.r, s.c
+    case !on && s.main != nil:
+        s.cells, s.main = s.main, nil
+        s.r, s.c = s.savedR, s.savedC
+    }
+}
+
+// Text returns the visible screen with trailing spaces and trailing blank
+// lines removed.
+func (s *screen) Text() string {
+    lines := make([]string, s.rows)
+    for i, l := range s.cells {
+        lines[i] = strings.TrimRight(string(l), " ")
+    }
+    for len(lines) > 0 && lines[len(lines)-1] == "" {
+        lines = lines[:len(lines)-1]
+    }
+    return strings.Join(lines, "\n")
+}
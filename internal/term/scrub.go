@@ -0,0 +1,189 @@
+package term
+
+import (
+    "sync"
+    "time"
+)
+
+// scrubHoldback is how long a possible partial secret at the end of a read
+// is held back waiting for the rest before it is emitted anyway.
+const scrubHoldback = 100 * time.Millisecond
+
+// Redactor removes sensitive values from PTY output before it is buffered or
+// logged; the session log filter is one too.
+type Redactor interface {
+    Redact(data []byte) []byte
+    // PartialSuffix reports how many trailing bytes could start a value that
+    // continues in the next read; those bytes are held back until then.
+    PartialSuffix(data []byte) int
+}
+
+// scrubAndIngest redacts data, holding back a trailing partial match so a
+// value split across reads is still caught.
+func (s *PTYSession) scrubAndIngest(data []byte) {
+    s.pendMu.Lock()
+    defer s.pendMu.Unlock()
+    if s.pendTimer != nil {
+        s.pendTimer.Stop()
+        s.pendTimer = nil
+    }
+    data = s.scrub.Redact(append(s.pending, data...))
+    hold := s.scrub.PartialSuffix(data)
+    s.pending = append([]byte(nil), data[len(data)-hold:]...)
+    s.pendGen++
+    if len(data) > hold {
+        s.ingest(data[:len(data)-hold])
+    }
+    if hold > 0 {
+        gen := s.pendGen
+        s.pendTimer = time.AfterFunc(scrubHoldback, func() { s.flushPending(gen) })
+    }
+}
+
+// flushPending emits held-back bytes if no newer read has superseded gen.
+func (s *PTYSession) flushPending(gen uint64) {
+    s.pendMu.Lock()
+    defer s.pendMu.Unlock()
+    if gen != s.pendGen {
+        return
+    }
+    s.emitPending()
+}
+
+// drainPending emits any held-back bytes; used when the PTY reaches EOF.
+func (s *PTYSession) drainPending() {
+    s.pendMu.Lock()
+    defer s.pendMu.Unlock()
+    if s.pendTimer != nil {
+        s.pendTimer.Stop()
+        s.pendTimer = nil
+    }
+    s.emitPending()
+}
+
+// emitPending ingests held-back bytes. Caller holds s.pendMu.
+func (s *PTYSession) emitPending() {
+    if len(s.pending) == 0 {
+        return
+    }
+    data := s.pending
+    s.pending = nil
+    s.ingest(data)
+}
+
+// logChunk writes c to the session log through the log filter, holding back
+// a trailing partial match like scrubAndIngest. Held-back bytes are logged
+// with the next chunk, or under c's seq once scrubHoldback passes.
+func (s *PTYSession) logChunk(c Chunk) {
+    if s.logFilter == nil {
+        s.log.append(c)
+        return
+    }
+    s.logMu.Lock()
+    defer s.logMu.Unlock()
+    if s.logTimer != nil {
+        s.logTimer.Stop()
+        s.logTimer = nil
+    }
+    data := append(s.logPend, c.Data...)
+    hold := s.logFilter.PartialSuffix(data)
+    s.logPend = append([]byte(nil), data[len(data)-hold:]...)
+    s.logGen++
+    s.logSeq = c.Seq
+    if len(data) > hold {
+        c.Data = s.logFilter.Redact(data[:len(data)-hold])
+        s.log.append(c)
+    }
+    if hold > 0 {
+        gen := s.logGen
+        s.logTimer = time.AfterFunc(scrubHoldback, func() { s.flushLog(gen) })
+    }
+}
+
+// flushLog logs held-back bytes if no newer chunk superseded gen.
+func (s *PTYSession) flushLog(gen uint64) {
+    s.logMu.Lock()
+    defer s.logMu.Unlock()
+    if gen != s.logGen {
+        return
+    }
+    s.emitLog()
+}
+
+// drainLog logs any held-back bytes; used when output ends.
+func (s *PTYSession) drainLog() {
+    s.logMu.Lock()
+    defer s.logMu.Unlock()
+    if s.logTimer != nil {
+        s.logTimer.Stop()
+        s.logTimer = nil
+    }
+    s.emitLog()
+}
+
+// emitLog appends held-back bytes to the log under the seq of the last
+// chunk. Caller holds s.logMu.
+func (s *PTYSession) emitLog() {
+    if len(s.logPend) == 0 {
+        return
+    }
+    data := s.logPend
+    s.logPend = nil
+    s.log.append(Chunk{Seq: s.logSeq, Stream: "stdout", Data: s.logFilter.Redact(data), Ts: time.Now()})
+}
+
+// holdback scrubs a stream written in pieces for jobs and services the way
+// scrubAndIngest does for PTYs: a trailing partial match waits for the next
+// write, or for scrubHoldback, before it is passed on.
+type holdback struct {
+    mu      *sync.Mutex // guards the fields; held whenever emit is called
+    r       Redactor    // nil passes writes through unchanged
+    emit    func(p []byte)
+    pending []byte
+    gen     uint64
+    timer   *time.Timer
+}
+
+// write scrubs p and emits all of it but a trailing partial match. Caller holds h.mu.
+func (h *holdback) write(p []byte) {
+    if h.r == nil {
+        h.emit(p)
+        return
+    }
+    if h.timer != nil {
+        h.timer.Stop()
+        h.timer = nil
+    }
+    data := h.r.Redact(append(h.pending, p...))
+    hold := h.r.PartialSuffix(data)
+    h.pending = append([]byte(nil), data[len(data)-hold:]...)
+    h.gen++
+    if len(data) > hold {
+        h.emit(data[:len(data)-hold])
+    }
+    if hold > 0 {
+        gen := h.gen
+        h.timer = time.AfterFunc(scrubHoldback, func() {
+            h.mu.Lock()
+            defer h.mu.Unlock()
+            if gen == h.gen {
+                h.drain()
+            }
+        })
+    }
+}
+
+// drain emits any held-back bytes; used once the writer is done. Caller holds h.mu.
+func (h *holdback) drain() {
+    if h.timer != nil {
+        h.timer.Stop()
+        h.timer = nil
+    }
+    if len(h.pending) == 0 {
+        return
+    }
+    data := h.pending
+    h.pending = nil
+    h.gen++
+    h.emit(data)
+}
@@ -0,0 +1,559 @@
+package term
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "regexp"
+    "sort"
+    "sync"
+    "time"
+)
+
+// Restart policies.
+const (
+    RestartNever     = "never"
+    RestartOnFailure = "on-failure"
+    RestartAlways    = "always"
+)
+
+// Service states.
+const (
+    ServiceStarting = "starting" // running, readiness probe not yet passed
+    ServiceRunning  = "running"  // running and ready
+    ServiceBackoff  = "backoff"  // waiting to restart
+    ServiceStopped  = "stopped"  // stopped on request
+    ServiceExited   = "exited"   // last instance exited 0 and is not restarted
+    ServiceFailed   = "failed"   // last instance failed and is not restarted
+)
+
+// Defaults for ServiceSpec fields left zero.
+const (
+    DefaultBackoffMin    = 500 * time.Millisecond
+    DefaultBackoffMax    = 30 * time.Second
+    DefaultProbeInterval = 200 * time.Millisecond
+    DefaultProbeTimeout  = 30 * time.Second
+)
+
+// serviceStableAfter is how long an instance must run for the backoff to
+// reset to BackoffMin.
+const serviceStableAfter = 10 * time.Second
+
+// ReadyProbe decides when a service instance is ready. Every configured
+// check must pass; with none set the instance is ready once started.
+type ReadyProbe struct {
+    TCP      string         // address that must accept connections, e.g. "127.0.0.1:8080"
+    LogRegex *regexp.Regexp // must match the instance's output
+    Command  []string       // must exit 0; runs with the service's cwd and env
+    Interval time.Duration
+    Timeout  time.Duration // an instance not ready by then is killed and counts as failed
+}
+
+// ServiceSpec describes a supervised process. Run supplies Argv, Cwd, Env
+// and KillGrace; other RunRequest fields are ignored.
+type ServiceSpec struct {
+    Name        string
+    Run         RunRequest
+    Restart     string // RestartNever (default), RestartOnFailure or RestartAlways
+    MaxRestarts int    // automatic restarts before giving up; 0 = unlimited
+    BackoffMin  time.Duration
+    BackoffMax  time.Duration
+    Ready       *ReadyProbe
+}
+
+// ServiceStatus is a snapshot of a service.
+type ServiceStatus struct {
+    ID        string
+    Name      string
+    Argv      []string
+    Cwd       string
+    Restart   string
+    State     string
+    PID       int       // current instance; 0 when none is running
+    Ready     bool      // current instance passed its probe
+    Restarts  int       // instances started after the first
+    StartedAt time.Time // current or last instance
+    ReadyAt   time.Time
+    NextStart time.Time // set while in ServiceBackoff
+    LastExit  *ExitInfo // last finished instance
+    Err       string
+}
+
+// Done reports whether the service is no longer supervised.
+func (st ServiceStatus) Done() bool {
+    return st.State == ServiceStopped || st.State == ServiceExited || st.State == ServiceFailed
+}
+
+// Service is one supervised process and its captured output. Output of
+// every instance goes to one chunk log, capped like a job's.
+type Service struct {
+    id      string
+    spec    ServiceSpec
+    created time.Time
+    scrub   Redactor
+
+    mu       sync.Mutex
+    status   ServiceStatus
+    chunks   []Chunk
+    nextSeq  uint64
+    cancel   context.CancelFunc // ends supervision
+    done     chan struct{}      // closed when supervision ends
+    stopping bool
+    kick     context.CancelFunc // ends the current instance or backoff
+    kicked   bool               // kick came from Restart
+}
+
+// ServiceManager supervises services.
+type ServiceManager struct {
+    mu       sync.Mutex
+    services map[string]*Service
+    scrub    Redactor
+}
+
+func NewServiceManager() *ServiceManager {
+    return &ServiceManager{services: make(map[string]*Service)}
+}
+
+// SetRedactor sets the scrubber applied to the output of services started
+// afterwards, before it is buffered.
+func (m *ServiceManager) SetRedactor(r Redactor) {
+    m.mu.Lock()
+    m.scrub = r
+    m.mu.Unlock()
+}
+
+// serviceStream appends writes to the service log as scrubbed chunks of one
+// stream.
+type serviceStream struct {
+    s      *Service
+    stream string
+    hold   holdback // guarded by s.mu
+}
+
+func newServiceStream(s *Service, stream string) *serviceStream {
+    w := &serviceStream{s: s, stream: stream}
+    w.hold = holdback{mu: &s.mu, r: s.scrub, emit: w.append}
+    return w
+}
+
+func (w *serviceStream) Write(p []byte) (int, error) {
+    w.s.mu.Lock()
+    w.hold.write(p)
+    w.s.mu.Unlock()
+    return len(p), nil
+}
+
+// append records p as a chunk. Caller holds s.mu.
+func (w *serviceStream) append(p []byte) {
+    data := make([]byte, len(p))
+    copy(data, p)
+    w.s.chunks = append(w.s.chunks, Chunk{Seq: w.s.nextSeq, Stream: w.stream, Data: data, Ts: time.Now()})
+    w.s.nextSeq++
+    w.s.enforceCap()
+}
+
+// enforceCap drops the oldest chunks beyond capSize. Caller holds s.mu.
+func (s *Service) enforceCap() {
+    total := 0
+    for i := len(s.chunks) - 1; i >= 0; i-- {
+        total += len(s.chunks[i].Data)
+        if total > capSize() {
+            s.chunks = append([]Chunk(nil), s.chunks[i+1:]...)
+            return
+        }
+    }
+}
+
+// Start validates spec, fills defaults and begins supervising it.
+func (m *ServiceManager) Start(spec ServiceSpec) (string, error) {
+    if len(spec.Run.Argv) == 0 || spec.Run.Argv[0] == "" {
+        return "", errors.New("argv must not be empty")
+    }
+    switch spec.Restart {
+    case "":
+        spec.Restart = RestartNever
+    case RestartNever, RestartOnFailure, RestartAlways:
+    default:
+        return "", fmt.Errorf("unknown restart policy %q", spec.Restart)
+    }
+    if spec.MaxRestarts < 0 {
+        return "", errors.New("max_restarts must not be negative")
+    }
+    if spec.BackoffMin <= 0 { spec.BackoffMin = DefaultBackoffMin }
+    if spec.BackoffMax <= 0 { spec.BackoffMax = DefaultBackoffMax }
+    if spec.BackoffMax < spec.BackoffMin { spec.BackoffMax = spec.BackoffMin }
+    if p := spec.Ready; p != nil {
+        if p.Interval <= 0 { p.Interval = DefaultProbeInterval }
+        if p.Timeout <= 0 { p.Timeout = DefaultProbeTimeout }
+    }
+    m.mu.Lock()
+    scrub := m.scrub
+    m.mu.Unlock()
+    s := &Service{id: randID(), spec: spec, created: time.Now(), scrub: scrub, nextSeq: 1}
+    s.status = ServiceStatus{ID: s.id, Name: spec.Name, Argv: append([]string(nil), spec.Run.Argv...), Restart: spec.Restart, State: ServiceStarting}
+    m.mu.Lock()
+    m.services[s.id] = s
+    m.mu.Unlock()
+    s.mu.Lock()
+    s.launch()
+    s.mu.Unlock()
+    return s.id, nil
+}
+
+// launch starts a supervisor goroutine. Caller holds s.mu, so checking that
+// the last supervisor is done and replacing it is one step.
+func (s *Service) launch() {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    s.cancel, s.done, s.stopping = cancel, done, false
+    go s.supervise(ctx, done)
+}
+
+// supervise runs instances until the policy, MaxRestarts or Stop ends it.
+func (s *Service) supervise(ctx context.Context, done chan struct{}) {
+    defer close(done)
+    backoff := s.spec.BackoffMin
+    restarts := 0
+    for {
+        ictx, kick := context.WithCancel(ctx)
+        s.mu.Lock()
+        if s.stopping {
+            s.status.State = ServiceStopped
+            s.mu.Unlock()
+            kick()
+            return
+        }
+        s.kick, s.kicked = kick, false
+        startSeq := s.nextSeq
+        s.mu.Unlock()
+
+        started := time.Now()
+        failed, startErr := s.runInstance(ictx, startSeq)
+        kick()
+
+        s.mu.Lock()
+        stopping, kicked := s.stopping, s.kicked
+        s.mu.Unlock()
+        if stopping {
+            s.setState(ServiceStopped)
+            return
+        }
+        if kicked {
+            backoff = s.spec.BackoffMin
+            s.bump()
+            continue
+        }
+        restart := s.spec.Restart == RestartAlways || (s.spec.Restart == RestartOnFailure && failed)
+        if !restart || (s.spec.MaxRestarts > 0 && restarts >= s.spec.MaxRestarts) {
+            if failed || startErr != nil {
+                s.setState(ServiceFailed)
+            } else {
+                s.setState(ServiceExited)
+            }
+            return
+        }
+        if time.Since(started) >= serviceStableAfter { backoff = s.spec.BackoffMin }
+        if !s.sleep(ctx, backoff) {
+            s.setState(ServiceStopped)
+            return
+        }
+        s.mu.Lock()
+        kicked = s.kicked
+        s.kicked = false
+        s.mu.Unlock()
+        // a Restart that cut the backoff short is not an automatic restart
+        if kicked {
+            backoff = s.spec.BackoffMin
+        } else {
+            backoff = min(backoff*2, s.spec.BackoffMax)
+            restarts++
+        }
+        s.bump()
+    }
+}
+
+func (s *Service) setState(state string) {
+    s.mu.Lock()
+    s.status.State = state
+    s.mu.Unlock()
+}
+
+// bump counts a restart and marks the next instance as starting.
+func (s *Service) bump() {
+    s.mu.Lock()
+    s.status.Restarts++
+    s.status.State = ServiceStarting
+    s.mu.Unlock()
+}
+
+// sleep waits out a backoff period. It returns false once the service is
+// being stopped; Restart cuts the wait short.
+func (s *Service) sleep(ctx context.Context, d time.Duration) bool {
+    wctx, kick := context.WithCancel(ctx)
+    defer kick()
+    s.mu.Lock()
+    s.status.State, s.status.NextStart = ServiceBackoff, time.Now().Add(d)
+    s.kick = kick
+    s.mu.Unlock()
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-t.C:
+    case <-wctx.Done():
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.status.NextStart = time.Time{}
+    return !s.stopping
+}
+
+// runInstance starts one process and waits for it. It reports whether the
+// instance failed (non-zero exit, signal, failed probe) and any start error.
+func (s *Service) runInstance(ctx context.Context, startSeq uint64) (bool, error) {
+    cmd, cwd := newCommand(ctx, s.spec.Run)
+    stdout, stderr := newServiceStream(s, "stdout"), newServiceStream(s, "stderr")
+    cmd.Stdout, cmd.Stderr = stdout, stderr
+    err := cmd.Start()
+    s.mu.Lock()
+    s.status.Cwd, s.status.StartedAt, s.status.ReadyAt = cwd, time.Now(), time.Time{}
+    s.status.Ready, s.status.Err = false, ""
+    if err != nil {
+        s.status.LastExit, s.status.Err, s.status.PID = &ExitInfo{RC: 127}, err.Error(), 0
+        s.mu.Unlock()
+        return true, err
+    }
+    s.status.State, s.status.PID = ServiceStarting, cmd.Process.Pid
+    s.mu.Unlock()
+
+    pctx, stopProbe := context.WithCancel(ctx)
+    probeFailed := make(chan bool, 1)
+    go func() { probeFailed <- s.probe(pctx, startSeq) }()
+    _ = cmd.Wait()
+    killGroup(ctx, cmd)
+    s.mu.Lock()
+    stdout.hold.drain()
+    stderr.hold.drain()
+    s.mu.Unlock()
+    stopProbe()
+    failedProbe := <-probeFailed
+
+    ex := exitInfo(cmd.ProcessState)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.status.LastExit, s.status.PID, s.status.Ready = &ex, 0, false
+    return failedProbe || ex.RC != 0 || ex.Signal != "", nil
+}
+
+// probe polls the readiness checks of the instance started at startSeq
+// and reports whether it timed out, in which case the instance is ended.
+func (s *Service) probe(ctx context.Context, startSeq uint64) bool {
+    p := s.spec.Ready
+    if p == nil {
+        s.markReady(ctx)
+        return false
+    }
+    deadline := time.Now().Add(p.Timeout)
+    for {
+        if s.probeOnce(ctx, p, startSeq) {
+            s.markReady(ctx)
+            return false
+        }
+        if time.Now().After(deadline) {
+            s.mu.Lock()
+            s.status.Err = fmt.Sprintf("readiness probe timed out after %s", p.Timeout)
+            s.kick()
+            s.mu.Unlock()
+            return true
+        }
+        select {
+        case <-ctx.Done():
+            return false
+        case <-time.After(p.Interval):
+        }
+    }
+}
+
+func (s *Service) probeOnce(ctx context.Context, p *ReadyProbe, startSeq uint64) bool {
+    if p.TCP != "" {
+        c, err := (&net.Dialer{Timeout: p.Interval}).DialContext(ctx, "tcp", p.TCP)
+        if err != nil { return false }
+        c.Close()
+    }
+    if p.LogRegex != nil && !p.LogRegex.Match(s.output(startSeq)) {
+        return false
+    }
+    if len(p.Command) > 0 {
+        cctx, cancel := context.WithTimeout(ctx, p.Timeout)
+        defer cancel()
+        cmd, _ := newCommand(cctx, RunRequest{Argv: p.Command, Cwd: s.spec.Run.Cwd, Env: s.spec.Run.Env})
+        err := cmd.Run()
+        killGroup(cctx, cmd)
+        if err != nil { return false }
+    }
+    return ctx.Err() == nil
+}
+
+func (s *Service) markReady(ctx context.Context) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if ctx.Err() == nil {
+        s.status.State, s.status.Ready, s.status.ReadyAt = ServiceRunning, true, time.Now()
+    }
+}
+
+// output concatenates retained chunks with seq >= since.
+func (s *Service) output(since uint64) []byte {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var b bytes.Buffer
+    for _, c := range s.chunks {
+        if c.Seq >= since { b.Write(c.Data) }
+    }
+    return b.Bytes()
+}
+
+func (s *Service) snapshot() ServiceStatus {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.status
+}
+
+func (m *ServiceManager) get(id string) (*Service, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    s := m.services[id]
+    if s == nil {
+        return nil, errors.New("no such service")
+    }
+    return s, nil
+}
+
+// Status returns a snapshot of service id.
+func (m *ServiceManager) Status(id string) (ServiceStatus, error) {
+    s, err := m.get(id)
+    if err != nil {
+        return ServiceStatus{}, err
+    }
+    return s.snapshot(), nil
+}
+
+// WaitReady blocks until the service is ready, is no longer supervised, or
+// timeout elapses, and returns its status at that point.
+func (m *ServiceManager) WaitReady(id string, timeout time.Duration) (ServiceStatus, error) {
+    s, err := m.get(id)
+    if err != nil {
+        return ServiceStatus{}, err
+    }
+    deadline := time.Now().Add(timeout)
+    for {
+        st := s.snapshot()
+        if st.Ready || st.Done() || time.Now().After(deadline) {
+            return st, nil
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+// Stop ends supervision: the process group gets SIGTERM, then SIGKILL
+// after the kill grace. Status and logs are kept.
+func (m *ServiceManager) Stop(id string) (ServiceStatus, error) {
+    s, err := m.get(id)
+    if err != nil {
+        return ServiceStatus{}, err
+    }
+    s.mu.Lock()
+    s.stopping = true
+    cancel, done := s.cancel, s.done
+    s.mu.Unlock()
+    cancel()
+    <-done
+    return s.snapshot(), nil
+}
+
+// Remove stops service id and forgets it.
+func (m *ServiceManager) Remove(id string) (ServiceStatus, error) {
+    st, err := m.Stop(id)
+    if err != nil {
+        return st, err
+    }
+    m.mu.Lock()
+    delete(m.services, id)
+    m.mu.Unlock()
+    return st, nil
+}
+
+// Restart replaces the current instance (or cuts a backoff short) with a
+// new one right away. A service no longer supervised is started again
+// under the same ID.
+func (m *ServiceManager) Restart(id string) (ServiceStatus, error) {
+    s, err := m.get(id)
+    if err != nil {
+        return ServiceStatus{}, err
+    }
+    s.mu.Lock()
+    select {
+    case <-s.done:
+        s.status.Restarts++
+        s.status.State = ServiceStarting
+        s.launch()
+    default:
+        if s.kick != nil && !s.stopping {
+            s.kicked = true
+            s.kick()
+        }
+    }
+    s.mu.Unlock()
+    return s.snapshot(), nil
+}
+
+// Logs returns chunks with seq > sinceSeq, up to maxBytes or until timeout,
+// and whether the service is no longer supervised with all output delivered.
+func (m *ServiceManager) Logs(id string, sinceSeq uint64, maxBytes int, timeout time.Duration) ([]Chunk, bool, error) {
+    s, err := m.get(id)
+    if err != nil {
+        return nil, false, err
+    }
+    deadline := time.Now().Add(timeout)
+    for {
+        s.mu.Lock()
+        var out []Chunk
+        bytes := 0
+        for _, c := range s.chunks {
+            if c.Seq <= sinceSeq { continue }
+            out = append(out, c)
+            bytes += len(c.Data)
+            if maxBytes > 0 && bytes >= maxBytes {
+                break
+            }
+        }
+        done := false
+        select {
+        case <-s.done:
+            done = len(out) == 0 || out[len(out)-1].Seq == s.nextSeq-1
+        default:
+        }
+        s.mu.Unlock()
+        if len(out) > 0 || done || time.Now().After(deadline) {
+            return out, done, nil
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
+// List returns all services, oldest first.
+func (m *ServiceManager) List() []ServiceStatus {
+    m.mu.Lock()
+    list := make([]*Service, 0, len(m.services))
+    for _, s := range m.services {
+        list = append(list, s)
+    }
+    m.mu.Unlock()
+    sort.Slice(list, func(a, b int) bool { return list[a].created.Before(list[b].created) })
+    out := make([]ServiceStatus, 0, len(list))
+    for _, s := range list {
+        out = append(out, s.snapshot())
+    }
+    return out
+}
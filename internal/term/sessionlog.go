@@ -0,0 +1,347 @@
+package term
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// LogRotation controls how PTY session logs are segmented on disk.
+type LogRotation struct {
+    SegmentBytes int64 // rotate the active segment once it grows past this size; 0 disables rotation
+    MaxSegments  int   // rotated segments kept per session; 0 keeps all
+    Compress     bool  // gzip rotated segments
+}
+
+// DefaultLogRotation keeps roughly 64 MiB of history per session.
+func DefaultLogRotation() LogRotation {
+    return LogRotation{SegmentBytes: 8 << 20, MaxSegments: 8}
+}
+
+// indexEntry locates one chunk inside a log segment.
+type indexEntry struct {
+    Seq uint64
+    Off int64
+    Len int
+    Ts  int64 // unix ms
+}
+
+// sessionLog appends chunk data to <id>.log and a seq index to <id>.idx.
+// Rotated segments become <id>.log.<gen> (optionally .gz) and <id>.idx.<gen>.
+type sessionLog struct {
+    mu     sync.Mutex
+    dir    string
+    id     string
+    rot    LogRotation
+    logf   *os.File
+    idxf   *os.File
+    idxw   *bufio.Writer
+    size   int64
+    gen    int                   // generation assigned to the next rotated segment
+    segs   []int                 // rotated generations still on disk, oldest first
+    gzips  map[int]chan struct{} // generations being compressed; closed when done
+    closed bool
+    // the most recently inflated .gz segment, so that following a rotated
+    // log with since_seq does not inflate the same segment on every read
+    inflated     string
+    inflatedData *bytes.Reader
+}
+
+func openSessionLog(dir, id string, rot LogRotation) (*sessionLog, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, err
+    }
+    l := &sessionLog{dir: dir, id: id, rot: rot, gen: 1, gzips: map[int]chan struct{}{}}
+    if err := l.openActive(); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
+
+func (l *sessionLog) logPath() string { return filepath.Join(l.dir, l.id+".log") }
+func (l *sessionLog) idxPath() string { return filepath.Join(l.dir, l.id+".idx") }
+
+func (l *sessionLog) segLogPath(gen int) string { return l.logPath() + "." + strconv.Itoa(gen) }
+func (l *sessionLog) segIdxPath(gen int) string { return l.idxPath() + "." + strconv.Itoa(gen) }
+
+func (l *sessionLog) openActive() error {
+    f, err := os.OpenFile(l.logPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+    if err != nil {
+        return err
+    }
+    idx, err := os.OpenFile(l.idxPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+    if err != nil {
+        _ = f.Close()
+        return err
+    }
+    l.logf, l.idxf, l.idxw, l.size = f, idx, bufio.NewWriter(idx), 0
+    return nil
+}
+
+// append writes a chunk and its index record, rotating first if needed.
+func (l *sessionLog) append(c Chunk) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.closed {
+        return
+    }
+    if l.rot.SegmentBytes > 0 && l.size > 0 && l.size+int64(len(c.Data)) > l.rot.SegmentBytes {
+        if err := l.rotate(); err != nil {
+            return
+        }
+    }
+    n, _ := l.logf.Write(c.Data)
+    if n > 0 {
+        fmt.Fprintf(l.idxw, "%d %d %d %d\n", c.Seq, l.size, n, c.Ts.UnixMilli())
+        _ = l.idxw.Flush()
+        l.size += int64(n)
+    }
+}
+
+// rotate moves the active segment aside and starts a fresh one. Caller holds l.mu.
+func (l *sessionLog) rotate() error {
+    _ = l.idxw.Flush()
+    _ = l.logf.Close()
+    _ = l.idxf.Close()
+    gen := l.gen
+    l.gen++
+    if err := os.Rename(l.logPath(), l.segLogPath(gen)); err != nil {
+        return err
+    }
+    if err := os.Rename(l.idxPath(), l.segIdxPath(gen)); err != nil {
+        return err
+    }
+    l.segs = append(l.segs, gen)
+    if l.rot.Compress {
+        done := make(chan struct{})
+        l.gzips[gen] = done
+        go func() {
+            gzipFile(l.segLogPath(gen))
+            close(done)
+            l.mu.Lock()
+            delete(l.gzips, gen)
+            l.mu.Unlock()
+        }()
+    }
+    for l.rot.MaxSegments > 0 && len(l.segs) > l.rot.MaxSegments {
+        old := l.segs[0]
+        l.segs = l.segs[1:]
+        // let a pending compression finish so it cannot recreate the file
+        if done, ok := l.gzips[old]; ok {
+            <-done
+        }
+        if l.inflated == l.segLogPath(old) {
+            l.inflated, l.inflatedData = "", nil
+        }
+        _ = os.Remove(l.segLogPath(old))
+        _ = os.Remove(l.segLogPath(old) + ".gz")
+        _ = os.Remove(l.segIdxPath(old))
+    }
+    return l.openActive()
+}
+
+func (l *sessionLog) close() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.closed {
+        return
+    }
+    l.closed = true
+    _ = l.idxw.Flush()
+    _ = l.logf.Close()
+    _ = l.idxf.Close()
+    for _, done := range l.gzips {
+        <-done
+    }
+}
+
+// read returns chunks with sinceSeq < seq < untilSeq from disk, oldest first,
+// stopping once maxBytes (if > 0) is reached.
+func (l *sessionLog) read(sinceSeq, untilSeq uint64, maxBytes int) ([]Chunk, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if !l.closed {
+        _ = l.idxw.Flush()
+    }
+    type segment struct{ log, idx string }
+    segs := make([]segment, 0, len(l.segs)+1)
+    for _, g := range l.segs {
+        segs = append(segs, segment{l.segLogPath(g), l.segIdxPath(g)})
+    }
+    segs = append(segs, segment{l.logPath(), l.idxPath()})
+
+    var out []Chunk
+    total := 0
+    for _, sg := range segs {
+        entries, err := readIndex(sg.idx)
+        if err != nil {
+            continue
+        }
+        var want []indexEntry
+        for _, e := range entries {
+            if e.Seq > sinceSeq && e.Seq < untilSeq {
+                want = append(want, e)
+            }
+        }
+        if len(want) == 0 {
+            continue
+        }
+        r, done, err := l.openSegment(sg.log)
+        if err != nil {
+            continue
+        }
+        for _, e := range want {
+            n := len(out)
+            if maxBytes > 0 && total >= maxBytes && (n == 0 || out[n-1].Seq != e.Seq) {
+                done()
+                return out, nil
+            }
+            data := make([]byte, e.Len)
+            if _, err := r.ReadAt(data, e.Off); err != nil && !errors.Is(err, io.EOF) {
+                break
+            }
+            // a filtered log may record one chunk in several pieces
+            if n > 0 && out[n-1].Seq == e.Seq {
+                out[n-1].Data = append(out[n-1].Data, data...)
+            } else {
+                out = append(out, Chunk{Seq: e.Seq, Stream: "stdout", Data: data, Ts: time.UnixMilli(e.Ts)})
+            }
+            total += e.Len
+        }
+        done()
+    }
+    return out, nil
+}
+
+func readIndex(path string) ([]indexEntry, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    var out []indexEntry
+    sc := bufio.NewScanner(f)
+    for sc.Scan() {
+        fields := strings.Fields(sc.Text())
+        if len(fields) != 4 {
+            continue
+        }
+        seq, err1 := strconv.ParseUint(fields[0], 10, 64)
+        off, err2 := strconv.ParseInt(fields[1], 10, 64)
+        n, err3 := strconv.Atoi(fields[2])
+        ts, err4 := strconv.ParseInt(fields[3], 10, 64)
+        if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+            continue
+        }
+        out = append(out, indexEntry{Seq: seq, Off: off, Len: n, Ts: ts})
+    }
+    return out, sc.Err()
+}
+
+// segmentReader streams a segment, inflating it if it has been gzipped.
+func segmentReader(path string) (io.ReadCloser, error) {
+    if f, err := os.Open(path); err == nil {
+        return f, nil
+    }
+    f, err := os.Open(path + ".gz")
+    if err != nil {
+        return nil, err
+    }
+    zr, err := gzip.NewReader(f)
+    if err != nil {
+        _ = f.Close()
+        return nil, err
+    }
+    return struct {
+        io.Reader
+        io.Closer
+    }{zr, f}, nil
+}
+
+// openSegment returns random access to a segment and a func releasing it.
+// Plain segments are read in place; a gzipped one is inflated once and kept
+// until another is needed or it is pruned. Caller holds l.mu.
+func (l *sessionLog) openSegment(path string) (io.ReaderAt, func(), error) {
+    if f, err := os.Open(path); err == nil {
+        return f, func() { _ = f.Close() }, nil
+    }
+    if l.inflated != path {
+        r, err := segmentReader(path)
+        if err != nil {
+            return nil, nil, err
+        }
+        b, err := io.ReadAll(r)
+        r.Close()
+        if err != nil {
+            return nil, nil, err
+        }
+        l.inflated, l.inflatedData = path, bytes.NewReader(b)
+    }
+    return l.inflatedData, func() {}, nil
+}
+
+// WriteTo writes every segment still on disk, oldest first, to w. It also
+// works once the log is closed, until its files are removed.
+func (l *sessionLog) WriteTo(w io.Writer) (int64, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    paths := make([]string, 0, len(l.segs)+1)
+    for _, g := range l.segs {
+        paths = append(paths, l.segLogPath(g))
+    }
+    paths = append(paths, l.logPath())
+    var total int64
+    for _, p := range paths {
+        r, err := segmentReader(p)
+        if err != nil {
+            continue // pruned or never written
+        }
+        n, err := io.Copy(w, r)
+        r.Close()
+        total += n
+        if err != nil {
+            return total, err
+        }
+    }
+    return total, nil
+}
+
+// gzipFile compresses path to path.gz and removes the original.
+func gzipFile(path string) {
+    in, err := os.Open(path)
+    if err != nil {
+        return
+    }
+    defer in.Close()
+    tmp := path + ".gz.tmp"
+    out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+    if err != nil {
+        return
+    }
+    zw := gzip.NewWriter(out)
+    if _, err := io.Copy(zw, in); err != nil {
+        _ = out.Close()
+        _ = os.Remove(tmp)
+        return
+    }
+    if err := zw.Close(); err != nil {
+        _ = out.Close()
+        _ = os.Remove(tmp)
+        return
+    }
+    _ = out.Close()
+    if err := os.Rename(tmp, path+".gz"); err != nil {
+        _ = os.Remove(tmp)
+        return
+    }
+    _ = os.Remove(path)
+}
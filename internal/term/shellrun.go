@@ -17,6 +17,32 @@ type RunRequest struct {
     Env     map[string]string // exact environment. If nil, defaults to empty (env -i)
     Timeout time.Duration     // 0 means no timeout
     Stdin   []byte
+
+    // Output caps. MaxStdoutBytes/MaxStderrBytes bound what is retained per
+    // stream (0 = unlimited); KeepTail splits that budget between head and
+    // tail. KillAfterBytes kills the process once combined output exceeds it.
+    MaxStdoutBytes int64
+    MaxStderrBytes int64
+    KeepTail       bool
+    KillAfterBytes int64
+
+    // Pipeline runs these stages connected by pipes instead of Argv; Stdin
+    // feeds the first stage and Cwd/Env are defaults for every stage.
+    Pipeline []PipelineStage
+
+    // KillGrace is the delay between SIGTERM and SIGKILL when the process
+    // group is torn down on timeout or cancellation (0 = DefaultKillGrace).
+    KillGrace time.Duration
+
+    // TTY runs Argv on a pseudo-terminal of Rows x Cols instead of pipes.
+    // Stdout then holds the combined terminal output; Screen also renders it.
+    TTY        bool
+    Rows, Cols int
+    Screen     bool
+
+    // SpoolBytes makes a job spool its output (see JobManager.SetSpool)
+    // and hand over streams larger than this; 0 disables spooling.
+    SpoolBytes int64
 }
 
 // RunResult provides structured results from a completed process.
@@ -26,33 +52,102 @@ type RunResult struct {
     Stderr   []byte
     Duration time.Duration
     Cwd      string
+
+    StdoutTotal     int64 // bytes written by the process, retained or not
+    StderrTotal     int64
+    StdoutTruncated bool
+    StderrTruncated bool
+    LimitExceeded   bool // killed for exceeding KillAfterBytes
+
+    Usage *Usage // rusage of the process and its reaped descendants; nil if it never ran
+
+    // Termination details; RC is 128+SignalNum when a signal killed the process.
+    Signal     string
+    SignalNum  int
+    CoreDumped bool
+    TimedOut   bool
+
+    Stages []StageResult // per-stage results of a pipeline run
+
+    Screen string // rendered final screen of a TTY run, when requested
 }
 
 // ShellRun executes a process without a PTY, capturing stdout/stderr and exit code deterministically.
 func ShellRun(parentCtx context.Context, req RunRequest) (RunResult, error) {
     var res RunResult
 
+    if len(req.Pipeline) > 0 {
+        if len(req.Argv) > 0 {
+            return res, errors.New("argv and pipeline are mutually exclusive")
+        }
+        if req.TTY {
+            return res, errors.New("tty is not supported with pipeline")
+        }
+        return runPipeline(parentCtx, req)
+    }
     if len(req.Argv) == 0 || req.Argv[0] == "" {
         return res, errors.New("argv must not be empty")
     }
+    if req.TTY {
+        return runTTY(parentCtx, req)
+    }
 
-    // Context with optional timeout
-    ctx := parentCtx
-    var cancel context.CancelFunc
+    // Context with optional timeout; cancel also enforces KillAfterBytes
+    ctx, cancel := context.WithCancel(parentCtx)
+    defer cancel()
     if req.Timeout > 0 {
-        ctx, cancel = context.WithTimeout(parentCtx, req.Timeout)
-        defer cancel()
+        var tcancel context.CancelFunc
+        ctx, tcancel = context.WithTimeout(ctx, req.Timeout)
+        defer tcancel()
+    }
+
+    cmd, cwd := newCommand(ctx, req)
+    res.Cwd = cwd
+
+    limit := &outputLimit{max: req.KillAfterBytes, kill: cancel}
+    stdoutBuf := newCapBuffer(req.MaxStdoutBytes, req.KeepTail, limit)
+    stderrBuf := newCapBuffer(req.MaxStderrBytes, req.KeepTail, limit)
+    cmd.Stdout = stdoutBuf
+    cmd.Stderr = stderrBuf
+
+    start := time.Now()
+    runErr := cmd.Run()
+    res.Duration = time.Since(start)
+    killGroup(ctx, cmd)
+    res.Stdout = stdoutBuf.Bytes()
+    res.Stderr = stderrBuf.Bytes()
+    res.StdoutTotal, res.StderrTotal = stdoutBuf.Total(), stderrBuf.Total()
+    res.StdoutTruncated, res.StderrTruncated = stdoutBuf.Truncated(), stderrBuf.Truncated()
+    res.Usage = usageFromState(cmd.ProcessState)
+    if cmd.ProcessState != nil {
+        ex := exitInfo(cmd.ProcessState)
+        res.Signal, res.SignalNum, res.CoreDumped = ex.Signal, ex.SignalNum, ex.CoreDumped
     }
+    res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
 
+    rc, err := exitStatus(ctx, req.Timeout, runErr)
+    res.RC = rc
+    if limit.hit.Load() {
+        res.LimitExceeded = true
+        return res, fmt.Errorf("output limit exceeded (%d bytes): %w", req.KillAfterBytes, runErr)
+    }
+    return res, err
+}
+
+// newCommand builds the exec.Cmd for req: argv, cwd, isolated env and stdin.
+// It returns the effective working directory for reporting.
+func newCommand(ctx context.Context, req RunRequest) (*exec.Cmd, string) {
     cmd := exec.CommandContext(ctx, req.Argv[0], req.Argv[1:]...)
+    useProcessGroup(cmd, req.KillGrace)
 
+    var cwd string
     if req.Cwd != "" {
         cmd.Dir = req.Cwd
-        res.Cwd = req.Cwd
+        cwd = req.Cwd
     } else {
         // Capture the current working directory for the result
         if wd, err := os.Getwd(); err == nil {
-            res.Cwd = wd
+            cwd = wd
         }
     }
 
@@ -67,49 +162,44 @@ func ShellRun(parentCtx context.Context, req RunRequest) (RunResult, error) {
         cmd.Env = []string{}
     }
 
-    var stdoutBuf, stderrBuf bytes.Buffer
-    cmd.Stdout = &stdoutBuf
-    cmd.Stderr = &stderrBuf
     if req.Stdin != nil {
         cmd.Stdin = bytes.NewReader(req.Stdin)
     }
+    return cmd, cwd
+}
 
-    start := time.Now()
-    runErr := cmd.Run()
-    res.Duration = time.Since(start)
-    res.Stdout = stdoutBuf.Bytes()
-    res.Stderr = stderrBuf.Bytes()
-
+// exitStatus maps the result of cmd.Run/Wait to an rc and a surfaced error.
+func exitStatus(ctx context.Context, timeout time.Duration, runErr error) (int, error) {
     // Exit code handling
     if runErr == nil {
-        res.RC = 0
-        return res, nil
+        return 0, nil
     }
     // If context deadline exceeded, surface a typed error but still return captured output.
     if errors.Is(ctx.Err(), context.DeadlineExceeded) {
         // Try to get exit code if available (process may have been killed)
+        rc := 124 // common timeout code
         if ee, ok := runErr.(*exec.ExitError); ok {
-            res.RC = exitCodeFromError(ee)
-        } else {
-            res.RC = 124 // common timeout code
+            rc = exitCodeFromError(ee)
+        }
+        if timeout <= 0 {
+            // the caller's deadline, not the request's own timeout
+            return rc, fmt.Errorf("deadline exceeded: %w", runErr)
         }
-        return res, fmt.Errorf("timeout after %s: %w", req.Timeout, runErr)
+        return rc, fmt.Errorf("timeout after %s: %w", timeout, runErr)
+    }
+    // The process succeeded but descendants held its pipes past WaitDelay
+    if errors.Is(runErr, exec.ErrWaitDelay) {
+        return 0, nil
     }
     // Normal non-zero exit
     if ee, ok := runErr.(*exec.ExitError); ok {
-        res.RC = exitCodeFromError(ee)
-        return res, nil
+        return exitCodeFromError(ee), nil
     }
     // Other errors (e.g., binary not found)
-    res.RC = 127
-    return res, runErr
+    return 127, runErr
 }
 
 func exitCodeFromError(ee *exec.ExitError) int {
-    // On Unix, extract WaitStatus
-    if status, ok := ee.Sys().(interface{ ExitStatus() int }); ok {
-        return status.ExitStatus()
-    }
-    return 1
+    return exitInfo(ee.ProcessState).RC
 }
 
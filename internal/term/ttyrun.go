@@ -0,0 +1,138 @@
+package term
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "syscall"
+    "time"
+
+    ptylib "github.com/creack/pty"
+)
+
+// Terminal size of TTY runs: defaults and limits.
+const (
+    DefaultTTYRows = 24
+    DefaultTTYCols = 80
+    // MaxTTYSize bounds rows and cols of a TTY run (the winsize fields are
+    // 16-bit); MaxScreenSize bounds them when the screen is rendered.
+    MaxTTYSize    = 65535
+    MaxScreenSize = 1000
+)
+
+// ttyDrain bounds how long output is read after the process exits; a
+// descendant still holding the terminal would otherwise block forever.
+const ttyDrain = 500 * time.Millisecond
+
+// ttyOutput collects terminal output for the buffer and the screen.
+type ttyOutput struct {
+    mu     sync.Mutex
+    buf    *capBuffer
+    screen *screen
+    closed bool // set once results are taken; later output is dropped
+}
+
+func (o *ttyOutput) Write(p []byte) (int, error) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    if o.closed { return len(p), nil }
+    if o.screen != nil { o.screen.Write(p) }
+    return o.buf.Write(p)
+}
+
+// runTTY is ShellRun on a pseudo-terminal. The process leads a new session
+// with the terminal as its controlling tty, so its process group is torn
+// down like a piped run's. Stdin is typed into the terminal followed by an
+// end-of-file (Ctrl-D); the terminal echoes it as usual.
+func runTTY(parentCtx context.Context, req RunRequest) (RunResult, error) {
+    var res RunResult
+    rows, cols := req.Rows, req.Cols
+    if rows <= 0 { rows = DefaultTTYRows }
+    if cols <= 0 { cols = DefaultTTYCols }
+    if rows > MaxTTYSize || cols > MaxTTYSize {
+        return res, fmt.Errorf("tty size %dx%d exceeds %d", rows, cols, MaxTTYSize)
+    }
+    if req.Screen && (rows > MaxScreenSize || cols > MaxScreenSize) {
+        return res, fmt.Errorf("screen size %dx%d exceeds %d", rows, cols, MaxScreenSize)
+    }
+
+    ctx, cancel := context.WithCancel(parentCtx)
+    defer cancel()
+    if req.Timeout > 0 {
+        var tcancel context.CancelFunc
+        ctx, tcancel = context.WithTimeout(ctx, req.Timeout)
+        defer tcancel()
+    }
+
+    cmd, cwd := newCommand(ctx, req)
+    res.Cwd = cwd
+    cmd.Stdin = nil
+    // a session leader already leads its own process group
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+    if _, ok := req.Env["TERM"]; !ok {
+        cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+    }
+
+    limit := &outputLimit{max: req.KillAfterBytes, kill: cancel}
+    out := &ttyOutput{buf: newCapBuffer(req.MaxStdoutBytes, req.KeepTail, limit)}
+    if req.Screen { out.screen = newScreen(rows, cols) }
+
+    start := time.Now()
+    ptmx, err := ptylib.StartWithAttrs(cmd, &ptylib.Winsize{Rows: uint16(rows), Cols: uint16(cols)}, cmd.SysProcAttr)
+    if err != nil {
+        res.RC, err = exitStatus(ctx, req.Timeout, err)
+        return res, err
+    }
+    copied := make(chan struct{})
+    go func() {
+        defer close(copied)
+        buf := make([]byte, 32<<10)
+        for {
+            n, err := ptmx.Read(buf)
+            if n > 0 { out.Write(buf[:n]) }
+            if err != nil {
+                return // EIO once every holder of the terminal has exited
+            }
+        }
+    }()
+    if len(req.Stdin) > 0 {
+        go func() {
+            in := append([]byte(nil), req.Stdin...)
+            if in[len(in)-1] != '\n' {
+                in = append(in, 0x04) // the first Ctrl-D only ends the partial line
+            }
+            _, _ = ptmx.Write(append(in, 0x04))
+        }()
+    }
+
+    runErr := cmd.Wait()
+    res.Duration = time.Since(start)
+    killGroup(ctx, cmd)
+    select {
+    case <-copied:
+    case <-time.After(ttyDrain):
+    }
+    ptmx.Close()
+
+    out.mu.Lock()
+    out.closed = true
+    res.Stdout = out.buf.Bytes()
+    res.StdoutTotal, res.StdoutTruncated = out.buf.Total(), out.buf.Truncated()
+    if out.screen != nil { res.Screen = out.screen.Text() }
+    out.mu.Unlock()
+    res.Usage = usageFromState(cmd.ProcessState)
+    if cmd.ProcessState != nil {
+        ex := exitInfo(cmd.ProcessState)
+        res.Signal, res.SignalNum, res.CoreDumped = ex.Signal, ex.SignalNum, ex.CoreDumped
+    }
+    res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+
+    rc, err := exitStatus(ctx, req.Timeout, runErr)
+    res.RC = rc
+    if limit.hit.Load() {
+        res.LimitExceeded = true
+        return res, fmt.Errorf("output limit exceeded (%d bytes): %w", req.KillAfterBytes, runErr)
+    }
+    return res, err
+}
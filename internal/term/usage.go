@@ -0,0 +1,174 @@
+package term
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "os"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+)
+
+// Usage is the resource consumption of a process and its descendants.
+type Usage struct {
+    UserCPU          time.Duration
+    SysCPU           time.Duration
+    MaxRSSKB         int64 // peak resident set of the largest process
+    MinorFaults      int64
+    MajorFaults      int64
+    VolCtxSwitches   int64
+    InvolCtxSwitches int64
+    Procs            int // live processes counted; 0 for final usage
+}
+
+// CPU is user plus system time.
+func (u Usage) CPU() time.Duration { return u.UserCPU + u.SysCPU }
+
+// usageFromState converts the rusage reported by wait4. On Linux it covers
+// the process and every descendant it reaped.
+func usageFromState(ps *os.ProcessState) *Usage {
+    if ps == nil {
+        return nil
+    }
+    ru, ok := ps.SysUsage().(*syscall.Rusage)
+    if !ok || ru == nil {
+        return nil
+    }
+    return &Usage{
+        UserCPU:          time.Duration(ru.Utime.Nano()),
+        SysCPU:           time.Duration(ru.Stime.Nano()),
+        MaxRSSKB:         ru.Maxrss,
+        MinorFaults:      ru.Minflt,
+        MajorFaults:      ru.Majflt,
+        VolCtxSwitches:   ru.Nvcsw,
+        InvolCtxSwitches: ru.Nivcsw,
+    }
+}
+
+// clockTick is USER_HZ, the unit of CPU times in /proc/<pid>/stat. It is 100
+// on every Linux architecture Go supports.
+const clockTick = 100
+
+// procStat holds the fields of /proc/<pid>/stat used for usage accounting
+// and process-group bookkeeping.
+type procStat struct {
+    state            byte
+    ppid             int
+    pgrp, session    int
+    minflt, majflt   int64
+    cminflt, cmajflt int64
+    utime, stime     int64
+    cutime, cstime   int64
+}
+
+func readProcStat(pid int) (procStat, error) {
+    var st procStat
+    raw, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+    if err != nil {
+        return st, err
+    }
+    i := bytes.LastIndexByte(raw, ')')
+    if i < 0 {
+        return st, errors.New("malformed stat")
+    }
+    // fields after comm start at "state" (field 3 in proc(5))
+    f := strings.Fields(string(raw[i+1:]))
+    if len(f) < 15 {
+        return st, errors.New("malformed stat")
+    }
+    num := func(k int) int64 { n, _ := strconv.ParseInt(f[k], 10, 64); return n }
+    st.state = f[0][0]
+    st.ppid = int(num(1))
+    st.pgrp, st.session = int(num(2)), int(num(3))
+    st.minflt, st.cminflt = num(7), num(8)
+    st.majflt, st.cmajflt = num(9), num(10)
+    st.utime, st.stime = num(11), num(12)
+    st.cutime, st.cstime = num(13), num(14)
+    return st, nil
+}
+
+// readProcStatus returns VmHWM (kB) and context switch counts from /proc/<pid>/status.
+func readProcStatus(pid int) (hwm, vol, invol int64) {
+    f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/status")
+    if err != nil {
+        return 0, 0, 0
+    }
+    defer f.Close()
+    sc := bufio.NewScanner(f)
+    for sc.Scan() {
+        k, v, ok := strings.Cut(sc.Text(), ":")
+        if !ok {
+            continue
+        }
+        fields := strings.Fields(v)
+        if len(fields) == 0 {
+            continue
+        }
+        n, _ := strconv.ParseInt(fields[0], 10, 64)
+        switch k {
+        case "VmHWM":
+            hwm = n
+        case "voluntary_ctxt_switches":
+            vol = n
+        case "nonvoluntary_ctxt_switches":
+            invol = n
+        }
+    }
+    return hwm, vol, invol
+}
+
+// descendants returns root and every live process below it.
+func descendants(root int) []int {
+    ents, err := os.ReadDir("/proc")
+    if err != nil {
+        return []int{root}
+    }
+    children := map[int][]int{}
+    for _, e := range ents {
+        pid, err := strconv.Atoi(e.Name())
+        if err != nil {
+            continue
+        }
+        if st, err := readProcStat(pid); err == nil {
+            children[st.ppid] = append(children[st.ppid], pid)
+        }
+    }
+    out := []int{root}
+    for i := 0; i < len(out); i++ {
+        out = append(out, children[out[i]]...)
+    }
+    return out
+}
+
+// TreeUsage sums usage over the live process tree rooted at pid, including
+// children those processes have already reaped. Context switches cover live
+// processes only since /proc keeps no cumulative counters for them.
+func TreeUsage(pid int) (Usage, error) {
+    var u Usage
+    var ticksUser, ticksSys int64
+    for _, p := range descendants(pid) {
+        st, err := readProcStat(p)
+        if err != nil {
+            if p == pid {
+                return u, err
+            }
+            continue // exited while we were scanning
+        }
+        u.Procs++
+        ticksUser += st.utime + st.cutime
+        ticksSys += st.stime + st.cstime
+        u.MinorFaults += st.minflt + st.cminflt
+        u.MajorFaults += st.majflt + st.cmajflt
+        hwm, vol, invol := readProcStatus(p)
+        if hwm > u.MaxRSSKB {
+            u.MaxRSSKB = hwm
+        }
+        u.VolCtxSwitches += vol
+        u.InvolCtxSwitches += invol
+    }
+    u.UserCPU = time.Duration(ticksUser) * time.Second / clockTick
+    u.SysCPU = time.Duration(ticksSys) * time.Second / clockTick
+    return u, nil
+}
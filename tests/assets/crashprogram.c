@@ -0,0 +1,18 @@
+#include <signal.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+/* crashprogram MODE: segv, abort, or an exit status */
+int main(int argc, char **argv) {
+    const char *mode = argc > 1 ? argv[1] : "";
+    if (strcmp(mode, "segv") == 0) {
+        volatile int *p = NULL;
+        *p = 1;
+    }
+    if (strcmp(mode, "abort") == 0) {
+        abort();
+    }
+    puts("alive");
+    return atoi(mode);
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+)
+
+type batchResp struct {
+    Results []struct {
+        RC      int    `json:"rc"`
+        Stdout  string `json:"stdout"`
+        Error   string `json:"error"`
+        Skipped bool   `json:"skipped"`
+    } `json:"results"`
+    Failed     int   `json:"failed"`
+    Skipped    int   `json:"skipped"`
+    DurationMS int64 `json:"duration_ms"`
+}
+
+func shellBatch(t *testing.T, base string, req interface{}) batchResp {
+    t.Helper()
+    b, err := httpPost(base+"/v1/shell/batch", mustJSON(req))
+    if err != nil { t.Fatal(err) }
+    var out batchResp
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatalf("decode %s: %v", b, err) }
+    return out
+}
+
+func TestShellBatch(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    // concurrency and ordering: six 300ms commands, three at a time
+    var cmds []map[string]interface{}
+    for i := 0; i < 6; i++ {
+        cmds = append(cmds, map[string]interface{}{"argv": []string{"/bin/sh", "-c", fmt.Sprintf("sleep 0.3; echo %d", i)}})
+    }
+    start := time.Now()
+    out := shellBatch(t, base, map[string]interface{}{"commands": cmds, "max_parallel": 3})
+    elapsed := time.Since(start)
+    if len(out.Results) != 6 || out.Failed != 0 || out.Skipped != 0 { t.Fatalf("batch: %+v", out) }
+    for i, r := range out.Results {
+        got, _ := base64.StdEncoding.DecodeString(r.Stdout)
+        if r.RC != 0 || string(got) != fmt.Sprintf("%d\n", i) { t.Fatalf("result %d out of order: %+v stdout=%q", i, r, got) }
+    }
+    if elapsed < 550*time.Millisecond || elapsed > 1500*time.Millisecond { t.Fatalf("expected two waves of three, took %s", elapsed) }
+
+    // stop_on_failure skips commands that have not started
+    out = shellBatch(t, base, map[string]interface{}{
+        "commands": []map[string]interface{}{
+            {"argv": []string{"/bin/true"}},
+            {"argv": []string{"/bin/false"}},
+            {"argv": []string{"/bin/echo", "never"}},
+        },
+        "max_parallel":    1,
+        "stop_on_failure": true,
+    })
+    if out.Results[0].RC != 0 || out.Results[1].RC != 1 || !out.Results[2].Skipped || out.Failed != 1 || out.Skipped != 1 {
+        t.Fatalf("stop_on_failure: %+v", out)
+    }
+
+    // the deadline kills running commands and skips the rest
+    start = time.Now()
+    out = shellBatch(t, base, map[string]interface{}{
+        "commands": []map[string]interface{}{
+            {"argv": []string{"/bin/sleep", "5"}},
+            {"argv": []string{"/bin/echo", "late"}},
+        },
+        "max_parallel": 1,
+        "deadline_ms":  300,
+    })
+    if time.Since(start) > 3*time.Second { t.Fatalf("deadline not enforced: %s", time.Since(start)) }
+    if !strings.Contains(out.Results[0].Error, "deadline") || !out.Results[1].Skipped { t.Fatalf("deadline: %+v", out) }
+}
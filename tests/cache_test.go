@@ -0,0 +1,83 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+type cachedRunResp struct {
+    RC       int    `json:"rc"`
+    Stdout   string `json:"stdout"`
+    Cached   bool   `json:"cached"`
+    CacheKey string `json:"cache_key"`
+    Error    string `json:"error"`
+}
+
+func TestShellRunCache(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    dir := t.TempDir()
+    in := filepath.Join(dir, "in.txt")
+    if err := os.WriteFile(in, []byte("v1\n"), 0o644); err != nil { t.Fatal(err) }
+    run := func(env map[string]string) cachedRunResp {
+        t.Helper()
+        var out cachedRunResp
+        shellRun(t, base, map[string]interface{}{
+            "argv":  []string{"/bin/sh", "-c", "echo $$; cat in.txt"},
+            "cwd":   dir,
+            "env":   env,
+            "cache": map[string]interface{}{"inputs": []string{"in.txt"}},
+        }, &out)
+        if out.RC != 0 || out.CacheKey == "" { t.Fatalf("run: %+v", out) }
+        return out
+    }
+
+    first := run(nil)
+    second := run(nil)
+    if first.Cached || !second.Cached || second.Stdout != first.Stdout || second.CacheKey != first.CacheKey { t.Fatalf("memoize: %+v %+v", first, second) }
+    if other := run(map[string]string{"X": "1"}); other.Cached { t.Fatalf("env change hit the cache: %+v", other) }
+    if err := os.WriteFile(in, []byte("v2\n"), 0o644); err != nil { t.Fatal(err) }
+    changed := run(nil)
+    got, _ := base64.StdEncoding.DecodeString(changed.Stdout)
+    if changed.Cached || changed.CacheKey == first.CacheKey || !strings.Contains(string(got), "v2") { t.Fatalf("input change: %+v", changed) }
+
+    b, err := httpPost(base+"/v1/cache/stats", []byte("{}"))
+    if err != nil { t.Fatal(err) }
+    var st struct {
+        Entries int   `json:"entries"`
+        Hits    int64 `json:"hits"`
+    }
+    if err := json.Unmarshal(b, &st); err != nil { t.Fatal(err) }
+    if st.Entries != 3 || st.Hits != 1 { t.Fatalf("stats: %s", b) }
+
+    b, err = httpPost(base+"/v1/cache/purge", mustJSON(map[string]string{"key": changed.CacheKey}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), `"purged":1`) { t.Fatalf("purge: %s", b) }
+    if again := run(nil); again.Cached { t.Fatalf("purged entry served: %+v", again) }
+
+    // declared inputs must exist
+    b, err = httpPost(base+"/v1/shell/run", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "cwd": dir, "cache": map[string]interface{}{"inputs": []string{"missing"}}}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "cache input") { t.Fatalf("missing input: %s", b) }
+}
+
+func TestShellRunCacheDisabled(t *testing.T) {
+    base, stop := startServer(t, "-cache-entries", "0")
+    defer stop()
+
+    b, err := httpPost(base+"/v1/shell/run", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "cache": map[string]interface{}{}}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "cache is disabled") { t.Fatalf("cache request: %s", b) }
+
+    b, err = httpPost(base+"/v1/cache/stats", []byte("{}"))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), `"entries":0`) { t.Fatalf("stats: %s", b) }
+    b, err = httpPost(base+"/v1/cache/purge", []byte("{}"))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "cache is disabled") { t.Fatalf("purge: %s", b) }
+}
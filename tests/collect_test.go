@@ -0,0 +1,87 @@
+package tests
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "strings"
+    "testing"
+    "time"
+)
+
+type collectedFile struct {
+    Path       string `json:"path"`
+    Size       int64  `json:"size"`
+    Mode       string `json:"mode"`
+    SHA256     string `json:"sha256"`
+    Data       string `json:"data"`
+    ArtifactID string `json:"artifact_id"`
+}
+
+func TestShellRunCollectsFiles(t *testing.T) {
+    base, stop := startServer(t, "-artifact-dir", t.TempDir(), "-run-artifact-ttl", "2s")
+    defer stop()
+
+    dir := t.TempDir()
+    script := "mkdir -p out/sub; echo small > out/a.txt; head -c 4096 /dev/zero > out/sub/big.bin; " +
+        "echo skip > out/b.log; echo x > out/run.sh; chmod 755 out/run.sh"
+    var out struct {
+        RC        int             `json:"rc"`
+        Collected []collectedFile `json:"collected"`
+        Error     string          `json:"error"`
+    }
+    shellRun(t, base, map[string]interface{}{
+        "argv":                 []string{"/bin/sh", "-c", script},
+        "cwd":                  dir,
+        "collect":              []string{"out/**/*.txt", "out/**/*.bin", "out/*.sh"},
+        "collect_inline_bytes": 1024,
+    }, &out)
+    if out.RC != 0 || len(out.Collected) != 3 { t.Fatalf("run: %+v", out) }
+    byPath := map[string]collectedFile{}
+    for _, f := range out.Collected { byPath[f.Path] = f }
+
+    small := byPath["out/a.txt"]
+    data, _ := base64.StdEncoding.DecodeString(small.Data)
+    sum := sha256.Sum256([]byte("small\n"))
+    if string(data) != "small\n" || small.ArtifactID != "" || small.SHA256 != hex.EncodeToString(sum[:]) { t.Fatalf("inline: %+v", small) }
+    if m := byPath["out/run.sh"].Mode; m != "-rwxr-xr-x" { t.Fatalf("mode=%q", m) }
+
+    big := byPath["out/sub/big.bin"]
+    if big.Data != "" || big.ArtifactID == "" || big.Size != 4096 { t.Fatalf("artifact: %+v", big) }
+    b, err := httpPost(base+"/v1/artifacts/get", mustJSON(map[string]string{"id": big.ArtifactID}))
+    if err != nil { t.Fatal(err) }
+    sum = sha256.Sum256(b)
+    if len(b) != 4096 || hex.EncodeToString(sum[:]) != big.SHA256 { t.Fatalf("download: %d bytes, sha %x", len(b), sum) }
+    // pinned to the run so GC leaves it alone until -run-artifact-ttl passes
+    if info, _ := artifactStat(t, base, big.ArtifactID); len(info.Refs) != 1 || !strings.HasPrefix(info.Refs[0], "run:") { t.Fatalf("collected ref: %+v", info) }
+    defer func() {
+        time.Sleep(2500 * time.Millisecond)
+        if info, _ := artifactStat(t, base, big.ArtifactID); len(info.Refs) != 0 { t.Fatalf("run pin not released: %+v", info) }
+    }()
+
+    // a pattern without "**" does not descend below its depth; a search
+    // that visits too many entries stops and reports truncation
+    var wide struct {
+        RC                 int             `json:"rc"`
+        Collected          []collectedFile `json:"collected"`
+        CollectedTruncated bool            `json:"collected_truncated"`
+    }
+    shellRun(t, base, map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", "mkdir -p many && cd many && seq 1 100001 | xargs touch"}, "cwd": dir,
+        "collect": []string{"*.none", "out/*.txt"},
+    }, &wide)
+    if wide.RC != 0 || wide.CollectedTruncated || len(wide.Collected) != 1 { t.Fatalf("shallow: %+v", wide) }
+    wide.Collected = nil
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/true"}, "cwd": dir, "collect": []string{"**/*.none"}}, &wide)
+    if !wide.CollectedTruncated || len(wide.Collected) != 0 { t.Fatalf("wide: %+v", wide) }
+
+    // bad patterns are rejected before anything runs
+    b, err = httpPost(base+"/v1/shell/run", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "collect": []string{"/etc/*"}}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "relative") { t.Fatalf("abs pattern: %s", b) }
+    for _, g := range []string{"../*", "out/../../x", "**/../.."} {
+        b, err = httpPost(base+"/v1/shell/run", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "collect": []string{g}}))
+        if err != nil { t.Fatal(err) }
+        if !strings.Contains(string(b), "inside cwd") { t.Fatalf("%s: %s", g, b) }
+    }
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+    "encoding/json"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+type diagnostic struct {
+    File     string `json:"file"`
+    Line     int    `json:"line"`
+    Column   int    `json:"column"`
+    Severity string `json:"severity"`
+    Message  string `json:"message"`
+    Tool     string `json:"tool"`
+}
+
+func TestShellRunDiagnostics(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+    assets := filepath.Join(modRoot(t), "tests", "assets", "diag")
+
+    parse := func(parser, file string) []diagnostic {
+        t.Helper()
+        var out struct {
+            Diagnostics []diagnostic `json:"diagnostics"`
+            Error       string       `json:"error"`
+        }
+        // compiler output arrives on stderr, test reports on stdout
+        shellRun(t, base, map[string]interface{}{
+            "argv":    []string{"/bin/sh", "-c", "cat " + file + " >&2; cat " + file},
+            "cwd":     assets,
+            "parsers": []string{parser},
+        }, &out)
+        if out.Error != "" { t.Fatalf("%s: %s", parser, out.Error) }
+        if len(out.Diagnostics)%2 != 0 { t.Fatalf("%s: streams disagree: %+v", parser, out.Diagnostics) }
+        return out.Diagnostics[:len(out.Diagnostics)/2]
+    }
+
+    want := map[string][]diagnostic{
+        "gcc": {
+            {File: "util.h", Line: 3, Column: 6, Severity: "warning", Message: "unused variable 'x' [-Wunused-variable]", Tool: "gcc"},
+            {File: "main.c", Line: 10, Column: 5, Severity: "error", Message: "use of undeclared identifier 'foo'", Tool: "gcc"},
+            {File: "main.c", Line: 12, Severity: "error", Message: "missing.h: No such file or directory", Tool: "gcc"},
+        },
+        "go": {
+            {File: "./main.go", Line: 7, Column: 2, Severity: "error", Message: "undefined: fmt.Printl", Tool: "go"},
+            {File: "./util.go", Line: 3, Column: 8, Severity: "error", Message: `"os" imported and not used`, Tool: "go"},
+        },
+        "gotest": {
+            {File: "add_test.go", Line: 9, Severity: "error", Message: "TestAdd: got 3, want 4", Tool: "gotest"},
+            {File: "broken/b.go", Line: 4, Column: 1, Severity: "error", Message: "syntax error: unexpected }", Tool: "gotest"},
+        },
+        "junit": {
+            {File: "tests/test_calc.py", Line: 12, Severity: "error", Message: "calc.AddTest.test_add: assert 3 == 4", Tool: "junit"},
+            {Severity: "error", Message: "calc.DivTest.test_div: ZeroDivisionError", Tool: "junit"},
+        },
+        "python": {
+            {File: "/app/lib/calc.py", Line: 7, Severity: "error", Message: "ZeroDivisionError: division by zero", Tool: "python"},
+        },
+    }
+    files := map[string]string{"gcc": "gcc.txt", "go": "go.txt", "gotest": "gotest.json", "junit": "junit.xml", "python": "python.txt"}
+    for parser, w := range want {
+        if got := parse(parser, files[parser]); !reflect.DeepEqual(got, w) { t.Errorf("%s:\n got %+v\nwant %+v", parser, got, w) }
+    }
+
+    // a line longer than the parsers accept is skipped, not the end of the scan
+    var long struct {
+        Diagnostics []diagnostic `json:"diagnostics"`
+    }
+    shellRun(t, base, map[string]interface{}{
+        "argv":    []string{"/bin/sh", "-c", "head -c 2000000 /dev/zero | tr '\\0' x >&2; echo >&2; cat gcc.txt >&2"},
+        "cwd":     assets,
+        "parsers": []string{"gcc"},
+    }, &long)
+    if !reflect.DeepEqual(long.Diagnostics, want["gcc"]) { t.Errorf("after a long line: %+v", long.Diagnostics) }
+
+    b, err := httpPost(base+"/v1/shell/run", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "parsers": []string{"cobol"}}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "unknown parser") { t.Fatalf("unknown parser: %s", b) }
+}
+
+func TestJobReadDiagnostics(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    b, err := httpPost(base+"/v1/jobs/start", mustJSON(map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", "cat python.txt >&2"},
+        "cwd":  filepath.Join(modRoot(t), "tests", "assets", "diag"),
+    }))
+    if err != nil { t.Fatal(err) }
+    var started struct{ ID string `json:"id"` }
+    if err := json.Unmarshal(b, &started); err != nil { t.Fatal(err) }
+    _, _ = httpPost(base+"/v1/jobs/wait", mustJSON(map[string]interface{}{"id": started.ID, "timeout_ms": int64(5 * time.Second / time.Millisecond)}))
+    b, err = httpPost(base+"/v1/jobs/read", mustJSON(map[string]interface{}{"id": started.ID, "parsers": []string{"python"}}))
+    if err != nil { t.Fatal(err) }
+    var out struct {
+        Done        bool         `json:"done"`
+        Diagnostics []diagnostic `json:"diagnostics"`
+    }
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatal(err) }
+    if !out.Done || len(out.Diagnostics) != 1 || out.Diagnostics[0].Line != 7 { t.Fatalf("job read: %s", b) }
+
+    // a read past all output still parses the whole job, as does jobs/wait
+    b, err = httpPost(base+"/v1/jobs/read", mustJSON(map[string]interface{}{"id": started.ID, "since_seq": 1 << 20, "parsers": []string{"python"}}))
+    if err != nil { t.Fatal(err) }
+    out.Diagnostics = nil
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatal(err) }
+    if len(out.Diagnostics) != 1 || out.Diagnostics[0].Line != 7 { t.Fatalf("job read past end: %s", b) }
+    b, err = httpPost(base+"/v1/jobs/wait", mustJSON(map[string]interface{}{"id": started.ID, "parsers": []string{"python"}}))
+    if err != nil { t.Fatal(err) }
+    out.Diagnostics = nil
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatal(err) }
+    if len(out.Diagnostics) != 1 || out.Diagnostics[0].Line != 7 { t.Fatalf("job wait: %s", b) }
+}
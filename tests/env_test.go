@@ -0,0 +1,70 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestEnvPolicy(t *testing.T) {
+    t.Setenv("AITERM_T_KEEP", "kept")
+    t.Setenv("AITERM_T_API_SECRET", "hidden")
+    t.Setenv("AITERM_OTHER", "other")
+    envFile := filepath.Join(t.TempDir(), "base.env")
+    if err := os.WriteFile(envFile, []byte("# base\nexport FROM_FILE=\"file value\"\nLANG=en_US.UTF-8\n"), 0o644); err != nil { t.Fatal(err) }
+
+    fileDir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(fileDir, "req.env"), []byte("FROM_REQ=1\nREQ_SECRET=x\n"), 0o644); err != nil { t.Fatal(err) }
+
+    base, stop := startServer(t, "-env-mode", "allowlist", "-env-allow", "PATH,AITERM_T_*", "-env-deny", "*_SECRET", "-env-file", envFile, "-env-preset", "deterministic", "-env-file-dir", fileDir)
+    defer stop()
+
+    type envResp struct {
+        RC      int      `json:"rc"`
+        Stdout  string   `json:"stdout"`
+        EnvKeys []string `json:"env_keys"`
+        Error   string   `json:"error"`
+    }
+    var out envResp
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/usr/bin/env"}, "env": map[string]string{"TZ": "Europe/Paris"}}, &out)
+    want := []string{"AITERM_T_KEEP", "FROM_FILE", "LANG", "LC_ALL", "NO_COLOR", "PATH", "TZ"}
+    if !reflect.DeepEqual(out.EnvKeys, want) { t.Fatalf("env_keys=%v want %v (%s)", out.EnvKeys, want, out.Error) }
+    got, _ := base64.StdEncoding.DecodeString(out.Stdout)
+    for _, kv := range []string{"AITERM_T_KEEP=kept", "FROM_FILE=file value", "LANG=C.UTF-8", "TZ=Europe/Paris", "NO_COLOR=1"} {
+        if !strings.Contains(string(got), kv+"\n") { t.Fatalf("missing %s in env:\n%s", kv, got) }
+    }
+
+    // a request policy narrows the server default field by field
+    out = envResp{}
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/usr/bin/env"}, "env_policy": map[string]interface{}{"mode": "empty", "files": []string{}, "presets": []string{"utc"}}}, &out)
+    if !reflect.DeepEqual(out.EnvKeys, []string{"TZ"}) { t.Fatalf("empty mode env_keys=%v (%s)", out.EnvKeys, out.Error) }
+
+    out = envResp{}
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/usr/bin/env"}, "env_policy": map[string]interface{}{"mode": "bogus"}}, &out)
+    if !strings.Contains(out.Error, "unknown env mode") { t.Fatalf("bad mode accepted: %+v", out) }
+
+    // ...but cannot widen it: deny lists add up, allow lists intersect
+    out = envResp{}
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/usr/bin/env"}, "env_policy": map[string]interface{}{"allow": []string{"AITERM_*"}, "deny": []string{}, "files": []string{"req.env"}, "presets": []string{}}}, &out)
+    if !reflect.DeepEqual(out.EnvKeys, []string{"AITERM_T_KEEP", "FROM_REQ"}) { t.Fatalf("narrowed env_keys=%v (%s)", out.EnvKeys, out.Error) }
+    for _, p := range []map[string]interface{}{{"mode": "inherit"}, {"files": []string{envFile}}, {"files": []string{"../" + filepath.Base(filepath.Dir(envFile)) + "/base.env"}}} {
+        out = envResp{}
+        shellRun(t, base, map[string]interface{}{"argv": []string{"/usr/bin/env"}, "env_policy": p}, &out)
+        if out.Error == "" { t.Fatalf("policy %v widened the server's: %v", p, out.EnvKeys) }
+    }
+
+    // pty.open echoes its effective keys too
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(map[string]interface{}{"argv": []string{"/bin/cat"}, "env": map[string]string{"TERM": "dumb"}}))
+    if err != nil { t.Fatal(err) }
+    var po struct {
+        ID      string   `json:"id"`
+        EnvKeys []string `json:"env_keys"`
+    }
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+    if !reflect.DeepEqual(po.EnvKeys, append(want[:6:6], "TERM", "TZ")) { t.Fatalf("pty env_keys=%v", po.EnvKeys) }
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+    "encoding/json"
+    "os/exec"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+type exitResp struct {
+    RC     int `json:"rc"`
+    Signal *struct {
+        Name   string `json:"name"`
+        Number int    `json:"number"`
+    } `json:"signal"`
+    CoreDumped bool   `json:"core_dumped"`
+    TimedOut   bool   `json:"timed_out"`
+    Error      string `json:"error"`
+}
+
+func TestShellRunSignalExitCodes(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    run := func(req map[string]interface{}) exitResp {
+        var out exitResp
+        shellRun(t, base, req, &out)
+        return out
+    }
+    if out := run(map[string]interface{}{"argv": []string{"/bin/sh", "-c", "exit 3"}}); out.RC != 3 || out.Signal != nil || out.TimedOut {
+        t.Fatalf("plain exit: %+v", out)
+    }
+    out := run(map[string]interface{}{"argv": []string{"/bin/sh", "-c", "kill -KILL $$"}})
+    if out.RC != 137 || out.Signal == nil || out.Signal.Name != "SIGKILL" || out.Signal.Number != 9 { t.Fatalf("SIGKILL: %+v", out) }
+    out = run(map[string]interface{}{"argv": []string{"/bin/sleep", "5"}, "timeout_ms": 200})
+    if !out.TimedOut || out.RC != 143 || out.Signal == nil || out.Signal.Name != "SIGTERM" { t.Fatalf("timeout: %+v", out) }
+
+    // crash triage for the debug targets
+    if _, err := exec.LookPath("gcc"); err != nil { t.Skip("gcc not found") }
+    bin := filepath.Join(t.TempDir(), "crashprogram")
+    if b, err := exec.Command("gcc", "-g", "-O0", "-o", bin, filepath.Join(modRoot(t), "tests", "assets", "crashprogram.c")).CombinedOutput(); err != nil {
+        t.Fatalf("gcc build failed: %v\n%s", err, b)
+    }
+    out = run(map[string]interface{}{"argv": []string{bin, "segv"}})
+    if out.RC != 139 || out.Signal == nil || out.Signal.Name != "SIGSEGV" || out.Signal.Number != 11 { t.Fatalf("segv: %+v", out) }
+    out = run(map[string]interface{}{"argv": []string{bin, "abort"}})
+    if out.RC != 134 || out.Signal == nil || out.Signal.Name != "SIGABRT" || out.Signal.Number != 6 { t.Fatalf("abort: %+v", out) }
+    out = run(map[string]interface{}{"argv": []string{bin, "7"}})
+    if out.RC != 7 || out.Signal != nil { t.Fatalf("exit 7: %+v", out) }
+}
+
+func TestPTYStatusReportsSignal(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    oreq := ptyOpenReq{Argv: []string{"/bin/sh", "-c", "read x; kill -ABRT $$"}, Rows: 24, Cols: 80}
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    type statusResp struct {
+        Running bool `json:"running"`
+        RC      *int `json:"rc"`
+        Signal  *struct {
+            Name   string `json:"name"`
+            Number int    `json:"number"`
+        } `json:"signal"`
+    }
+    status := func() statusResp {
+        b, err := httpPost(base+"/v1/pty/status", mustJSON(map[string]string{"id": po.ID}))
+        if err != nil { t.Fatal(err) }
+        var st statusResp
+        if err := json.Unmarshal(b, &st); err != nil { t.Fatalf("decode %s: %v", b, err) }
+        return st
+    }
+    if st := status(); !st.Running || st.RC != nil { t.Fatalf("expected running: %+v", st) }
+
+    _, _ = httpPost(base+"/v1/pty/send", mustJSON(ptySendReq{ID: po.ID, Data: b64("go\n")}))
+    var st statusResp
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        if st = status(); !st.Running { break }
+        time.Sleep(50 * time.Millisecond)
+    }
+    if st.Running || st.RC == nil || *st.RC != 134 || st.Signal == nil || st.Signal.Name != "SIGABRT" || st.Signal.Number != 6 {
+        t.Fatalf("expected SIGABRT exit: %+v", st)
+    }
+}
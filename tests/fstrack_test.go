@@ -0,0 +1,85 @@
+package tests
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+type fsChange struct {
+    Path   string `json:"path"`
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256"`
+}
+
+type trackResp struct {
+    RC      int `json:"rc"`
+    Changes *struct {
+        Created   []fsChange `json:"created"`
+        Modified  []fsChange `json:"modified"`
+        Deleted   []fsChange `json:"deleted"`
+        Truncated bool       `json:"truncated"`
+    } `json:"changes"`
+    Error string `json:"error"`
+}
+
+func paths(list []fsChange) []string {
+    out := []string{}
+    for _, c := range list { out = append(out, c.Path) }
+    return out
+}
+
+func TestShellRunTracksFileChanges(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    dir := t.TempDir()
+    for name, data := range map[string]string{"a.txt": "a", "b.txt": "b", "keep.txt": "k", ".git/HEAD": "ref", "h.txt": "1"} {
+        p := filepath.Join(dir, name)
+        _ = os.MkdirAll(filepath.Dir(p), 0o755)
+        if err := os.WriteFile(p, []byte(data), 0o644); err != nil { t.Fatal(err) }
+    }
+    old := time.Unix(1000000000, 0)
+    if err := os.Chtimes(filepath.Join(dir, "h.txt"), old, old); err != nil { t.Fatal(err) }
+
+    script := "echo new > c.txt; echo more >> a.txt; rm b.txt; mkdir out; echo o > out/o.bin; echo x > .git/HEAD; " +
+        "printf 2 > h.txt; touch -d @1000000000 h.txt"
+    var out trackResp
+    shellRun(t, base, map[string]interface{}{
+        "argv":  []string{"/bin/sh", "-c", script},
+        "cwd":   dir,
+        "track": map[string]interface{}{"roots": []string{"."}, "ignore": []string{".git"}},
+    }, &out)
+    if out.RC != 0 || out.Changes == nil { t.Fatalf("run: %+v", out) }
+    if got := paths(out.Changes.Created); !reflect.DeepEqual(got, []string{"c.txt", "out/o.bin"}) { t.Fatalf("created=%v", got) }
+    if got := paths(out.Changes.Modified); !reflect.DeepEqual(got, []string{"a.txt"}) { t.Fatalf("modified=%v", got) }
+    if got := paths(out.Changes.Deleted); !reflect.DeepEqual(got, []string{"b.txt"}) { t.Fatalf("deleted=%v", got) }
+    if out.Changes.Created[0].Size != 4 { t.Fatalf("c.txt size: %+v", out.Changes.Created[0]) }
+
+    // same size and mtime: only a hash comparison notices the rewrite
+    out = trackResp{}
+    shellRun(t, base, map[string]interface{}{
+        "argv":  []string{"/bin/sh", "-c", "printf 3 > h.txt; touch -d @1000000000 h.txt"},
+        "cwd":   dir,
+        "track": map[string]interface{}{"roots": []string{"h.txt"}, "hash": true},
+    }, &out)
+    if out.Changes == nil || len(out.Changes.Modified) != 1 || out.Changes.Modified[0].Path != "h.txt" || len(out.Changes.Modified[0].SHA256) != 64 {
+        t.Fatalf("hash tracking: %+v", out.Changes)
+    }
+
+    // tree size limit
+    out = trackResp{}
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/true"}, "cwd": dir, "track": map[string]interface{}{"max_files": 2}}, &out)
+    if out.Changes == nil || !out.Changes.Truncated { t.Fatalf("expected truncated snapshot: %+v", out.Changes) }
+
+    // jobs have no post-run step to report changes in
+    b, err := httpPost(base+"/v1/jobs/start", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "track": map[string]interface{}{}}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "track is only supported") { t.Fatalf("job track: %s", b) }
+    b, err = httpPost(base+"/v1/jobs/start", mustJSON(map[string]interface{}{"argv": []string{"/bin/true"}, "cache": map[string]interface{}{}}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(b), "cache is only supported") { t.Fatalf("job cache: %s", b) }
+}
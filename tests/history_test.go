@@ -0,0 +1,45 @@
+package tests
+
+import (
+    "encoding/json"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestPTYHistorySurvivesClose(t *testing.T) {
+    hist := filepath.Join(t.TempDir(), "history.jsonl")
+    base, stop := startServer(t, "-history", hist)
+    defer stop()
+
+    oreq := map[string]interface{}{
+        "argv":   []string{"/bin/sh", "-c", "echo history_token; exit 3"},
+        "labels": map[string]string{"run": "nightly"},
+    }
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    time.Sleep(300 * time.Millisecond)
+    if _, err := httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID})); err != nil { t.Fatal(err) }
+
+    hb, err := httpPost(base+"/v1/pty/history", mustJSON(map[string]interface{}{"labels": map[string]string{"run": "nightly"}}))
+    if err != nil { t.Fatal(err) }
+    var hr struct {
+        Sessions []struct {
+            ID       string `json:"id"`
+            ExitCode *int   `json:"exit_code"`
+            BytesOut int64  `json:"bytes_out"`
+            LogPath  string `json:"log_path"`
+        } `json:"sessions"`
+    }
+    if err := json.Unmarshal(hb, &hr); err != nil { t.Fatal(err) }
+    if len(hr.Sessions) != 1 || hr.Sessions[0].ID != po.ID { t.Fatalf("unexpected history: %s", hb) }
+    e := hr.Sessions[0]
+    if e.ExitCode == nil || *e.ExitCode != 3 || e.BytesOut == 0 || e.LogPath == "" { t.Fatalf("incomplete entry: %s", hb) }
+
+    // label filter excludes non-matching sessions
+    hb, _ = httpPost(base+"/v1/pty/history", mustJSON(map[string]interface{}{"labels": map[string]string{"run": "other"}}))
+    if err := json.Unmarshal(hb, &hr); err != nil { t.Fatal(err) }
+    if len(hr.Sessions) != 0 { t.Fatalf("filter did not apply: %s", hb) }
+}
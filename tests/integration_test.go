@@ -80,12 +80,12 @@ func pickPort(t *testing.T) string {
     return port
 }
 
-func startServer(t *testing.T) (baseURL string, stop func()) {
+func startServer(t *testing.T, extraArgs ...string) (baseURL string, stop func()) {
     t.Helper()
     root := modRoot(t)
     aitermd, _, _ := buildBinaries(t)
     port := pickPort(t)
-    cmd := exec.Command(aitermd, "-addr", ":"+port)
+    cmd := exec.Command(aitermd, append([]string{"-addr", ":"+port}, extraArgs...)...)
     cmd.Env = append(os.Environ(), fmt.Sprintf("PATH=%s:%s", filepath.Join(root,"bin"), os.Getenv("PATH")))
     cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
     if err := cmd.Start(); err != nil { t.Fatalf("start server: %v", err) }
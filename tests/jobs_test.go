@@ -0,0 +1,124 @@
+package tests
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+)
+
+type jobStatusResp struct {
+    ID    string `json:"id"`
+    State string `json:"state"`
+    Done  bool   `json:"done"`
+    RC    int    `json:"rc"`
+}
+
+type jobReadResp struct {
+    Chunks []struct {
+        Seq    uint64 `json:"seq"`
+        Stream string `json:"stream"`
+        Data   string `json:"data"`
+    } `json:"chunks"`
+    Done bool `json:"done"`
+}
+
+func startJob(t *testing.T, base string, req interface{}) string {
+    t.Helper()
+    b, err := httpPost(base+"/v1/jobs/start", mustJSON(req))
+    if err != nil { t.Fatal(err) }
+    var out struct{ ID string `json:"id"` }
+    if err := json.Unmarshal(b, &out); err != nil || out.ID == "" { t.Fatalf("start: %s", b) }
+    return out.ID
+}
+
+func TestJobsStreamWaitAndCancel(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    id := startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "echo one; sleep 0.3; echo two >&2; exit 4"}})
+    stdout, stderr := "", ""
+    since := uint64(0)
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        b, err := httpPost(base+"/v1/jobs/read", mustJSON(map[string]interface{}{"id": id, "since_seq": since, "timeout_ms": 300}))
+        if err != nil { t.Fatal(err) }
+        var rr jobReadResp
+        if err := json.Unmarshal(b, &rr); err != nil { t.Fatal(err) }
+        for _, c := range rr.Chunks {
+            if c.Stream == "stderr" { stderr += string(mustB64(t, c.Data)) } else { stdout += string(mustB64(t, c.Data)) }
+            since = c.Seq
+        }
+        if rr.Done { break }
+    }
+    if stdout != "one\n" || stderr != "two\n" { t.Fatalf("stdout=%q stderr=%q", stdout, stderr) }
+    var st jobStatusResp
+    b, _ := httpPost(base+"/v1/jobs/wait", mustJSON(map[string]interface{}{"id": id}))
+    if err := json.Unmarshal(b, &st); err != nil { t.Fatal(err) }
+    if st.State != "exited" || st.RC != 4 || !st.Done { t.Fatalf("wait: %s", b) }
+
+    // timeouts and cancellation
+    tid := startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sleep", "5"}, "timeout_ms": 200})
+    cid := startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sleep", "5"}})
+    b, _ = httpPost(base+"/v1/jobs/wait", mustJSON(map[string]interface{}{"id": tid, "timeout_ms": 3000}))
+    if err := json.Unmarshal(b, &st); err != nil { t.Fatal(err) }
+    if st.State != "timeout" { t.Fatalf("timeout job: %s", b) }
+    b, _ = httpPost(base+"/v1/jobs/cancel", mustJSON(map[string]interface{}{"id": cid}))
+    if err := json.Unmarshal(b, &st); err != nil { t.Fatal(err) }
+    if st.State != "canceled" { t.Fatalf("cancel: %s", b) }
+
+    var list struct{ Jobs []jobStatusResp `json:"jobs"` }
+    b, _ = httpPost(base+"/v1/jobs/list", []byte("{}"))
+    if err := json.Unmarshal(b, &list); err != nil { t.Fatal(err) }
+    if len(list.Jobs) != 3 { t.Fatalf("list: %s", b) }
+}
+
+func TestJobsApplyOutputCaps(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    readAll := func(id string) string {
+        t.Helper()
+        out := ""
+        since := uint64(0)
+        deadline := time.Now().Add(5 * time.Second)
+        for time.Now().Before(deadline) {
+            b, err := httpPost(base+"/v1/jobs/read", mustJSON(map[string]interface{}{"id": id, "since_seq": since, "timeout_ms": 300}))
+            if err != nil { t.Fatal(err) }
+            var rr jobReadResp
+            if err := json.Unmarshal(b, &rr); err != nil { t.Fatal(err) }
+            for _, c := range rr.Chunks {
+                out += string(mustB64(t, c.Data))
+                since = c.Seq
+            }
+            if rr.Done { return out }
+        }
+        t.Fatalf("job %s never finished: %q", id, out)
+        return ""
+    }
+    type capStatus struct {
+        State           string `json:"state"`
+        StdoutBytes     int64  `json:"stdout_bytes"`
+        StdoutTruncated bool   `json:"stdout_truncated"`
+        LimitExceeded   bool   `json:"limit_exceeded"`
+        Error           string `json:"error"`
+    }
+    wait := func(id string) capStatus {
+        t.Helper()
+        var st capStatus
+        b, _ := httpPost(base+"/v1/jobs/wait", mustJSON(map[string]interface{}{"id": id}))
+        if err := json.Unmarshal(b, &st); err != nil { t.Fatal(err) }
+        return st
+    }
+
+    // head and tail are passed on, the middle is dropped
+    id := startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "printf 0123456789; sleep 0.1; printf abcdefghij"}, "max_stdout_bytes": 8, "keep_tail": true})
+    if got := readAll(id); got != "0123ghij" { t.Fatalf("keep_tail: %q", got) }
+    if st := wait(id); st.StdoutBytes != 20 || !st.StdoutTruncated { t.Fatalf("keep_tail status: %+v", st) }
+
+    id = startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "printf 0123456789"}, "max_stdout_bytes": 4})
+    if got := readAll(id); got != "0123" { t.Fatalf("head: %q", got) }
+
+    // the kill limit ends the job
+    id = startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "yes"}, "kill_after_bytes": 100000})
+    if st := wait(id); st.State != "failed" || !st.LimitExceeded || st.Error == "" { t.Fatalf("kill limit: %+v", st) }
+}
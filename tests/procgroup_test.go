@@ -0,0 +1,137 @@
+package tests
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// procAlive reports whether pid exists and is not a zombie.
+func procAlive(pid int) bool {
+    b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+    if err != nil { return false }
+    i := strings.LastIndexByte(string(b), ')')
+    return i < 0 || i+2 >= len(b) || b[i+2] != 'Z'
+}
+
+// readPIDFile waits for a pid written by the command under test.
+func readPIDFile(t *testing.T, path string) int {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        if b, err := os.ReadFile(path); err == nil {
+            if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil { return pid }
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+    t.Fatalf("no pid written to %s", path)
+    return 0
+}
+
+// assertReaped fails if pid is still running shortly after teardown.
+func assertReaped(t *testing.T, pid int) {
+    t.Helper()
+    deadline := time.Now().Add(2 * time.Second)
+    for time.Now().Before(deadline) {
+        if !procAlive(pid) { return }
+        time.Sleep(50 * time.Millisecond)
+    }
+    _ = killPID(pid)
+    t.Fatalf("pid %d survived teardown", pid)
+}
+
+func killPID(pid int) error {
+    p, err := os.FindProcess(pid)
+    if err != nil { return err }
+    return p.Kill()
+}
+
+func TestShellRunKillsProcessGroup(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+    dir := t.TempDir()
+
+    var out struct {
+        RC         int    `json:"rc"`
+        DurationMS int64  `json:"duration_ms"`
+        Error      string `json:"error"`
+    }
+
+    // timeout: the grandchild is torn down with the shell
+    pidfile := filepath.Join(dir, "timeout.pid")
+    shellRun(t, base, map[string]interface{}{
+        "argv":          []string{"/bin/sh", "-c", "sleep 300 & echo $! > " + pidfile + "; wait"},
+        "timeout_ms":    300,
+        "kill_grace_ms": 500,
+    }, &out)
+    if !strings.Contains(out.Error, "timeout") || out.DurationMS > 3000 { t.Fatalf("timeout run: %+v", out) }
+    assertReaped(t, readPIDFile(t, pidfile))
+
+    // a clean exit leaves the group alone; a background child holding
+    // stdout still does not hang the run
+    pidfile = filepath.Join(dir, "bg.pid")
+    out.Error = ""
+    shellRun(t, base, map[string]interface{}{
+        "argv":          []string{"/bin/sh", "-c", "sleep 300 & echo $! > " + pidfile},
+        "kill_grace_ms": 300,
+    }, &out)
+    if out.RC != 0 || out.Error != "" || out.DurationMS > 3000 { t.Fatalf("background run: %+v", out) }
+    bg := readPIDFile(t, pidfile)
+    time.Sleep(200 * time.Millisecond)
+    if !procAlive(bg) { t.Fatalf("clean exit killed background pid %d", bg) }
+    _ = killPID(bg)
+
+    // SIGTERM is ignored: SIGKILL follows after the grace period
+    pidfile = filepath.Join(dir, "trap.pid")
+    shellRun(t, base, map[string]interface{}{
+        "argv":          []string{"/bin/sh", "-c", "trap '' TERM; sleep 300 & echo $! > " + pidfile + "; wait"},
+        "timeout_ms":    200,
+        "kill_grace_ms": 700,
+    }, &out)
+    if out.DurationMS < 800 || out.DurationMS > 4000 { t.Fatalf("expected SIGKILL after grace, took %dms: %+v", out.DurationMS, out) }
+    assertReaped(t, readPIDFile(t, pidfile))
+}
+
+func TestJobCancelKillsProcessGroup(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+    pidfile := filepath.Join(t.TempDir(), "job.pid")
+
+    id := startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "sleep 300 & echo $! > " + pidfile + "; wait"}, "kill_grace_ms": 500})
+    pid := readPIDFile(t, pidfile)
+    b, err := httpPost(base+"/v1/jobs/cancel", mustJSON(map[string]string{"id": id}))
+    if err != nil { t.Fatal(err) }
+    var st jobStatusResp
+    if err := json.Unmarshal(b, &st); err != nil { t.Fatal(err) }
+    if st.State != "canceled" { t.Fatalf("cancel: %s", b) }
+    assertReaped(t, pid)
+}
+
+func TestPTYCloseKillsSession(t *testing.T) {
+    base, stop := startServer(t, "-kill-grace", "500ms")
+    defer stop()
+    dir := t.TempDir()
+
+    oreq := ptyOpenReq{Argv: []string{"/bin/bash", "--noprofile", "--norc", "-i"}, Rows: 24, Cols: 80, Env: map[string]string{"TERM": "dumb", "PS1": ""}}
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+
+    // a job-controlled background process (own process group) and one ignoring SIGHUP/SIGTERM
+    bg, stubborn := filepath.Join(dir, "bg.pid"), filepath.Join(dir, "stubborn.pid")
+    cmd := "sleep 300 & echo $! > " + bg + "\n" +
+        "(trap '' HUP TERM; exec sleep 300) & echo $! > " + stubborn + "\n"
+    _, _ = httpPost(base+"/v1/pty/send", mustJSON(ptySendReq{ID: po.ID, Data: b64(cmd)}))
+    p1, p2 := readPIDFile(t, bg), readPIDFile(t, stubborn)
+
+    start := time.Now()
+    if _, err := httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID})); err != nil { t.Fatal(err) }
+    if time.Since(start) > 4*time.Second { t.Fatalf("close took %s", time.Since(start)) }
+    assertReaped(t, p1)
+    assertReaped(t, p2)
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+type ptyEventsResp struct {
+    Events []struct {
+        Seq      uint64 `json:"seq"`
+        ChunkSeq uint64 `json:"chunk_seq"`
+        Kind     string `json:"kind"`
+        Value    string `json:"value"`
+        ExitCode *int   `json:"exit_code"`
+    } `json:"events"`
+    Title  string `json:"title"`
+    Cwd    string `json:"cwd"`
+    Closed bool   `json:"closed"`
+}
+
+func TestPTYEventsFromOSC(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    script := `printf '\033]0;build\007'; printf '\033]7;file://host/tmp/some%%20dir\033\\'; ` +
+        `printf '\033]133;A\007$ \033]133;B\007'; printf '\033]133;C\007out\n\033]133;D;2\007\007'; sleep 2`
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(ptyOpenReq{Argv: []string{"/bin/sh", "-c", script}, Rows: 24, Cols: 80}))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    var kinds []string
+    var er ptyEventsResp
+    since := uint64(0)
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) && len(kinds) < 7 {
+        eb, err := httpPost(base+"/v1/pty/events", mustJSON(map[string]interface{}{"id": po.ID, "since_seq": since, "timeout_ms": 300}))
+        if err != nil { t.Fatal(err) }
+        if err := json.Unmarshal(eb, &er); err != nil { t.Fatal(err) }
+        for _, e := range er.Events {
+            kinds = append(kinds, e.Kind)
+            since = e.Seq
+            if e.ChunkSeq == 0 { t.Fatalf("event without chunk seq: %s", eb) }
+            if e.Kind == "command_finished" && (e.ExitCode == nil || *e.ExitCode != 2) { t.Fatalf("bad exit code: %s", eb) }
+        }
+    }
+    want := []string{"title", "cwd", "prompt_start", "command_start", "command_executed", "command_finished", "bell"}
+    if len(kinds) != len(want) { t.Fatalf("events=%v want %v", kinds, want) }
+    for i := range want {
+        if kinds[i] != want[i] { t.Fatalf("events=%v want %v", kinds, want) }
+    }
+    if er.Title != "build" || er.Cwd != "/tmp/some dir" { t.Fatalf("state title=%q cwd=%q", er.Title, er.Cwd) }
+}
+
+func TestPTYAutoResponders(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    script := `printf 'Continue? [y/N] '; read a; echo "first:$a"; printf 'Password: '; read b; echo "second:$b"; sleep 2`
+    oreq := map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", script},
+        "responders": []map[string]interface{}{
+            {"id": "confirm", "pattern": `Continue\? \[y/N\] $`, "response": "y\n", "once": true},
+        },
+    }
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatalf("%v: %s", err, ob) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    waitFor := func(token string) string {
+        acc := ""
+        since := uint64(0)
+        deadline := time.Now().Add(5 * time.Second)
+        for time.Now().Before(deadline) {
+            rb, err := httpPost(base+"/v1/pty/read", mustJSON(ptyReadReq{ID: po.ID, Since: since, Max: 1 << 16, TimeoutMS: 300}))
+            if err != nil { t.Fatal(err) }
+            var rr ptyReadResp
+            if err := json.Unmarshal(rb, &rr); err != nil { t.Fatal(err) }
+            for _, c := range rr.Chunks {
+                acc += string(mustB64(t, c.Data))
+                since = c.Seq
+            }
+            if strings.Contains(acc, token) { return acc }
+        }
+        t.Fatalf("missing %q in %q", token, acc)
+        return ""
+    }
+    waitFor("Password: ")
+    waitFor("first:y")
+
+    // add a rule at runtime; the pending prompt is answered immediately
+    rb, err := httpPost(base+"/v1/pty/responders", mustJSON(map[string]interface{}{
+        "id": po.ID, "action": "add", "rules": []map[string]interface{}{{"pattern": "Password: $", "response": "hunter2\n"}},
+    }))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(rb), `"added":["r1"]`) { t.Fatalf("add: %s", rb) }
+    waitFor("second:hunter2")
+
+    var er ptyEventsResp
+    eb, _ := httpPost(base+"/v1/pty/events", mustJSON(map[string]interface{}{"id": po.ID}))
+    if err := json.Unmarshal(eb, &er); err != nil { t.Fatal(err) }
+    var fired []string
+    for _, e := range er.Events {
+        if e.Kind == "responder" { fired = append(fired, e.Value) }
+    }
+    if len(fired) != 2 || fired[0] != "confirm" || fired[1] != "r1" { t.Fatalf("responder events: %s", eb) }
+
+    // IDs are unique per session; generated IDs skip ones a caller claimed
+    rb, err = httpPost(base+"/v1/pty/responders", mustJSON(map[string]interface{}{
+        "id": po.ID, "action": "add", "rules": []map[string]interface{}{{"id": "confirm", "pattern": "x", "response": "y"}},
+    }))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(rb), "already in use") { t.Fatalf("duplicate id: %s", rb) }
+    rb, err = httpPost(base+"/v1/pty/responders", mustJSON(map[string]interface{}{
+        "id": po.ID, "action": "add", "rules": []map[string]interface{}{{"pattern": "x", "response": "y"}, {"id": "r2", "pattern": "z", "response": "y"}},
+    }))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(rb), `"added":["r3","r2"]`) { t.Fatalf("auto id: %s", rb) }
+}
+
+func TestPTYResponderSecrets(t *testing.T) {
+    const value = "s3cr3t-value-123"
+    file := filepath.Join(t.TempDir(), "secrets.env")
+    if err := os.WriteFile(file, []byte("TOKEN="+value+"\n"), 0o600); err != nil { t.Fatal(err) }
+    base, stop := startServer(t, "-secrets", file)
+    defer stop()
+
+    // the response is expanded like pty.send input; the rule keeps the placeholder
+    oreq := map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", `stty -echo; printf 'Password: '; read p; test "$p" = ` + value + ` && echo matched; sleep 2`},
+        "responders": []map[string]interface{}{{"id": "pw", "pattern": "Password: $", "response": "{{secret:TOKEN}}\n"}},
+    }
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatalf("%v: %s", err, ob) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+    acc := ""
+    since := uint64(0)
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) && !strings.Contains(acc, "matched") {
+        rb, err := httpPost(base+"/v1/pty/read", mustJSON(ptyReadReq{ID: po.ID, Since: since, Max: 1 << 16, TimeoutMS: 300}))
+        if err != nil { t.Fatal(err) }
+        var rr ptyReadResp
+        if err := json.Unmarshal(rb, &rr); err != nil { t.Fatal(err) }
+        for _, c := range rr.Chunks {
+            acc += string(mustB64(t, c.Data))
+            since = c.Seq
+        }
+    }
+    if !strings.Contains(acc, "matched") { t.Fatalf("secret not expanded: %q", acc) }
+    rb, err := httpPost(base+"/v1/pty/responders", mustJSON(map[string]interface{}{"id": po.ID}))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(rb), "{{secret:TOKEN}}") || strings.Contains(string(rb), value) { t.Fatalf("list: %s", rb) }
+
+    // unknown names are rejected when the rule is added
+    rb, err = httpPost(base+"/v1/pty/responders", mustJSON(map[string]interface{}{
+        "id": po.ID, "action": "add", "rules": []map[string]interface{}{{"pattern": "x", "response": "{{secret:NOPE}}"}},
+    }))
+    if err != nil { t.Fatal(err) }
+    if !strings.Contains(string(rb), "unknown secret") { t.Fatalf("unknown secret accepted: %s", rb) }
+}
+
+func TestPTYRespondersAnswerInOrder(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    // both prompts arrive together; the delayed first answer must not be overtaken
+    oreq := map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", `printf 'first? second? '; read a; read b; echo "got:$a,$b"; sleep 2`},
+        "responders": []map[string]interface{}{
+            {"pattern": `first\? `, "response": "1\n", "delay_ms": 300},
+            {"pattern": `second\? `, "response": "2\n"},
+        },
+    }
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatalf("%v: %s", err, ob) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    acc := ""
+    since := uint64(0)
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) && !strings.Contains(acc, "got:") {
+        rb, err := httpPost(base+"/v1/pty/read", mustJSON(ptyReadReq{ID: po.ID, Since: since, Max: 1 << 16, TimeoutMS: 300}))
+        if err != nil { t.Fatal(err) }
+        var rr ptyReadResp
+        if err := json.Unmarshal(rb, &rr); err != nil { t.Fatal(err) }
+        for _, c := range rr.Chunks {
+            acc += string(mustB64(t, c.Data))
+            since = c.Seq
+        }
+    }
+    if !strings.Contains(acc, "got:1,2") { t.Fatalf("answers out of order: %q", acc) }
+}
+
+func mustB64(t *testing.T, s string) []byte {
+    t.Helper()
+    b, err := base64.StdEncoding.DecodeString(s)
+    if err != nil { t.Fatal(err) }
+    return b
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+    "testing"
+)
+
+type retryResp struct {
+    RC       int    `json:"rc"`
+    Stdout   string `json:"stdout"`
+    Error    string `json:"error"`
+    Attempts []struct {
+        Attempt    int    `json:"attempt"`
+        RC         int    `json:"rc"`
+        TimedOut   bool   `json:"timed_out"`
+        DurationMS int64  `json:"duration_ms"`
+        Stdout     string `json:"stdout"`
+        Stderr     string `json:"stderr"`
+        Retried    bool   `json:"retried"`
+        BackoffMS  int64  `json:"backoff_ms"`
+    } `json:"attempts"`
+}
+
+// flaky fails with rc 75 and "lock busy" until its third run in dir.
+const flaky = `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; echo attempt $n
+[ $n -ge 3 ] || { echo "lock busy" >&2; exit 75; }`
+
+func TestShellRunRetry(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    var out retryResp
+    shellRun(t, base, map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", flaky}, "cwd": t.TempDir(),
+        "retry": map[string]interface{}{"max_attempts": 5, "backoff_ms": 50, "on_exit_codes": []int{75}},
+    }, &out)
+    if out.RC != 0 || out.Stdout != b64("attempt 3\n") || len(out.Attempts) != 3 { t.Fatalf("retry: %+v", out) }
+    first := out.Attempts[0]
+    if first.Attempt != 1 || first.RC != 75 || !first.Retried || first.BackoffMS < 40 || first.Stdout != b64("attempt 1\n") || first.Stderr != b64("lock busy\n") { t.Fatalf("first attempt: %+v", first) }
+    if out.Attempts[1].BackoffMS <= first.BackoffMS || out.Attempts[2].Retried { t.Fatalf("backoff: %+v", out.Attempts) }
+
+    // a failure that matches neither filter is returned at once
+    out = retryResp{}
+    shellRun(t, base, map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", flaky}, "cwd": t.TempDir(),
+        "retry": map[string]interface{}{"stderr_regex": "database is locked", "on_exit_codes": []int{1}},
+    }, &out)
+    if out.RC != 75 || len(out.Attempts) != 1 || out.Attempts[0].Retried { t.Fatalf("no match: %+v", out) }
+
+    // the stderr filter alone also selects retries
+    out = retryResp{}
+    shellRun(t, base, map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", flaky}, "cwd": t.TempDir(),
+        "retry": map[string]interface{}{"stderr_regex": "lock (busy|held)", "backoff_ms": 10, "jitter": 0},
+    }, &out)
+    if out.RC != 0 || len(out.Attempts) != 3 || out.Attempts[0].BackoffMS != 10 || out.Attempts[1].BackoffMS != 20 { t.Fatalf("stderr regex: %+v", out) }
+
+    // each attempt gets its own timeout
+    out = retryResp{}
+    shellRun(t, base, map[string]interface{}{
+        "argv":  []string{"/bin/sleep", "5"},
+        "retry": map[string]interface{}{"max_attempts": 2, "attempt_timeout_ms": 200, "backoff_ms": 10},
+    }, &out)
+    if len(out.Attempts) != 2 || !out.Attempts[0].TimedOut || !out.Attempts[1].TimedOut || out.Attempts[1].DurationMS > 2000 { t.Fatalf("attempt timeout: %+v", out) }
+
+    out = retryResp{}
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/true"}, "retry": map[string]interface{}{"jitter": 2}}, &out)
+    if out.Error == "" { t.Fatalf("accepted jitter 2: %+v", out) }
+}
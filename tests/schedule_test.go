@@ -0,0 +1,131 @@
+package tests
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+type scheduleRun struct {
+    Trigger string `json:"trigger"`
+    Result  struct {
+        RC     int    `json:"rc"`
+        Stdout string `json:"stdout"`
+    } `json:"result"`
+}
+
+type scheduleStatus struct {
+    ID        string        `json:"id"`
+    NextRunMS int64         `json:"next_run_ms"`
+    Runs      int64         `json:"runs"`
+    Failures  int64         `json:"failures"`
+    History   []scheduleRun `json:"history"`
+    Error     string        `json:"error"`
+}
+
+func scheduleCall(t *testing.T, base, path string, req interface{}) scheduleStatus {
+    t.Helper()
+    b, err := httpPost(base+"/v1/schedules/"+path, mustJSON(req))
+    if err != nil { t.Fatal(err) }
+    var out scheduleStatus
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatalf("decode %s: %v", b, err) }
+    return out
+}
+
+func waitSchedule(t *testing.T, base, id string, cond func(scheduleStatus) bool) scheduleStatus {
+    t.Helper()
+    deadline := time.Now().Add(10 * time.Second)
+    for {
+        st := scheduleCall(t, base, "get", map[string]string{"id": id})
+        if cond(st) { return st }
+        if time.Now().After(deadline) { t.Fatalf("schedule %s: condition not met: %+v", id, st) }
+        time.Sleep(100 * time.Millisecond)
+    }
+}
+
+func TestScheduleInterval(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    sc := scheduleCall(t, base, "create", map[string]interface{}{
+        "interval_ms": 1000, "history_limit": 2,
+        "run": map[string]interface{}{"argv": []string{"/bin/sh", "-c", "date +%s%N; exit 3"}},
+    })
+    if sc.ID == "" || sc.Error != "" { t.Fatalf("create: %+v", sc) }
+    // ~4 MB of base64 output per run: two fit the history byte budget
+    big := scheduleCall(t, base, "create", map[string]interface{}{
+        "interval_ms": 1000, "run": map[string]interface{}{"argv": []string{"/bin/sh", "-c", "head -c 3000000 /dev/zero"}},
+    })
+    if big.Error != "" { t.Fatalf("create: %+v", big) }
+    st := waitSchedule(t, base, sc.ID, func(st scheduleStatus) bool { return st.Runs >= 3 })
+    if len(st.History) != 2 || st.Failures != st.Runs || st.History[0].Trigger != "interval" || st.History[0].Result.RC != 3 { t.Fatalf("history: %+v", st) }
+    newest, _ := strconv.ParseInt(strings.TrimSpace(string(mustB64(t, st.History[0].Result.Stdout))), 10, 64)
+    older, _ := strconv.ParseInt(strings.TrimSpace(string(mustB64(t, st.History[1].Result.Stdout))), 10, 64)
+    if newest == 0 || newest <= older { t.Fatalf("history not newest first: %+v", st.History) }
+    if bst := waitSchedule(t, base, big.ID, func(st scheduleStatus) bool { return st.Runs >= 3 }); len(bst.History) != 2 { t.Fatalf("history of %d runs kept %d", bst.Runs, len(bst.History)) }
+    scheduleCall(t, base, "delete", map[string]string{"id": big.ID})
+
+    // concurrent updates leave one trigger loop, which pausing stops
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            scheduleCall(t, base, "update", map[string]interface{}{"id": sc.ID, "spec": map[string]interface{}{
+                "interval_ms": 1000, "run": map[string]interface{}{"argv": []string{"/bin/true"}},
+            }})
+        }()
+    }
+    wg.Wait()
+
+    // pausing clears the next run; deleting removes the schedule
+    up := scheduleCall(t, base, "update", map[string]interface{}{"id": sc.ID, "spec": map[string]interface{}{
+        "interval_ms": 1000, "paused": true, "run": map[string]interface{}{"argv": []string{"/bin/true"}},
+    }})
+    if up.Error != "" || up.NextRunMS != 0 { t.Fatalf("pause: %+v", up) }
+    time.Sleep(500 * time.Millisecond) // let a run in progress finish
+    before := scheduleCall(t, base, "get", map[string]string{"id": sc.ID})
+    time.Sleep(2500 * time.Millisecond)
+    if after := scheduleCall(t, base, "get", map[string]string{"id": sc.ID}); after.Runs != before.Runs { t.Fatalf("paused schedule still runs: %d -> %d", before.Runs, after.Runs) }
+    if del := scheduleCall(t, base, "delete", map[string]string{"id": sc.ID}); del.Error != "" { t.Fatalf("delete: %+v", del) }
+    if gone := scheduleCall(t, base, "get", map[string]string{"id": sc.ID}); gone.Error == "" { t.Fatal("schedule survived delete") }
+}
+
+func TestScheduleWatchAndCron(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("a"), 0o644); err != nil { t.Fatal(err) }
+    sc := scheduleCall(t, base, "create", map[string]interface{}{
+        "watch": []string{"input.txt"}, "watch_poll_ms": 100,
+        "run": map[string]interface{}{"argv": []string{"/bin/cat", "input.txt"}, "cwd": dir},
+    })
+    if sc.Error != "" { t.Fatalf("create: %+v", sc) }
+    time.Sleep(400 * time.Millisecond)
+    if st := scheduleCall(t, base, "get", map[string]string{"id": sc.ID}); st.Runs != 0 || st.NextRunMS != 0 { t.Fatalf("ran without a change: %+v", st) }
+    if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("changed"), 0o644); err != nil { t.Fatal(err) }
+    st := waitSchedule(t, base, sc.ID, func(st scheduleStatus) bool { return st.Runs == 1 })
+    if st.History[0].Trigger != "watch" || st.History[0].Result.Stdout != b64("changed") { t.Fatalf("watch run: %+v", st.History) }
+
+    cron := scheduleCall(t, base, "create", map[string]interface{}{"cron": "0 0 1 1 *", "run": map[string]interface{}{"argv": []string{"/bin/true"}}})
+    now := time.Now()
+    want := time.Date(now.Year()+1, 1, 1, 0, 0, 0, 0, time.Local).UnixMilli()
+    waitSchedule(t, base, cron.ID, func(st scheduleStatus) bool { return st.NextRunMS == want })
+    // a day field written to cover every day is still unrestricted
+    every := scheduleCall(t, base, "create", map[string]interface{}{"cron": "0 0 1 1 */1", "run": map[string]interface{}{"argv": []string{"/bin/true"}}})
+    waitSchedule(t, base, every.ID, func(st scheduleStatus) bool { return st.NextRunMS == want })
+
+    for _, bad := range []map[string]interface{}{
+        {"cron": "61 * * * *", "run": map[string]interface{}{"argv": []string{"/bin/true"}}},
+        {"run": map[string]interface{}{"argv": []string{"/bin/true"}}},
+        {"interval_ms": 10, "run": map[string]interface{}{"argv": []string{"/bin/true"}}},
+    } {
+        if st := scheduleCall(t, base, "create", bad); st.Error == "" || strings.Contains(st.Error, "decode") { t.Fatalf("accepted %v: %+v", bad, st) }
+    }
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestPTYReadServesEvictedOutputFromDisk(t *testing.T) {
+    base, stop := startServer(t, "-log-segment-bytes", "262144", "-log-max-segments", "0", "-log-gzip")
+    defer stop()
+
+    // ~2.3 MiB of output overflows the 1 MiB in-memory buffer
+    oreq := ptyOpenReq{Argv: []string{"/bin/sh", "-c", "seq 1 400000; sleep 5"}, Rows: 24, Cols: 80}
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    // follow until the last line shows up
+    since := uint64(0)
+    tail := ""
+    deadline := time.Now().Add(15 * time.Second)
+    for time.Now().Before(deadline) && !strings.Contains(tail, "400000") {
+        rb, err := httpPost(base+"/v1/pty/read", mustJSON(ptyReadReq{ID: po.ID, Since: since, Max: 1 << 20, TimeoutMS: 300}))
+        if err != nil { t.Fatal(err) }
+        var rr ptyReadResp
+        if err := json.Unmarshal(rb, &rr); err != nil { t.Fatal(err) }
+        for _, c := range rr.Chunks {
+            b, _ := base64.StdEncoding.DecodeString(c.Data)
+            tail = string(b)
+            since = c.Seq
+        }
+    }
+    if !strings.Contains(tail, "400000") { t.Fatalf("never saw end of output, tail=%q", tail) }
+
+    // history from seq 0 must start at seq 1 even though it was evicted
+    rb, err := httpPost(base+"/v1/pty/read", mustJSON(ptyReadReq{ID: po.ID, Since: 0, Max: 4096, TimeoutMS: 300}))
+    if err != nil { t.Fatal(err) }
+    var rr ptyReadResp
+    if err := json.Unmarshal(rb, &rr); err != nil { t.Fatal(err) }
+    if len(rr.Chunks) == 0 || rr.Chunks[0].Seq != 1 { t.Fatalf("expected history from seq 1, got %s", rb) }
+    first, _ := base64.StdEncoding.DecodeString(rr.Chunks[0].Data)
+    if !strings.HasPrefix(string(first), "1\r\n2\r\n") { t.Fatalf("unexpected first chunk %q", first) }
+
+    // rotated segments are gzipped alongside their index
+    time.Sleep(300 * time.Millisecond)
+    gz, _ := filepath.Glob(filepath.Join("/tmp/aiterm/sessions", po.ID+".log.*.gz"))
+    idx, _ := filepath.Glob(filepath.Join("/tmp/aiterm/sessions", po.ID+".idx.*"))
+    if len(gz) == 0 || len(idx) == 0 { t.Fatalf("expected rotated segments, gz=%v idx=%v", gz, idx) }
+    if _, err := os.Stat(filepath.Join("/tmp/aiterm/sessions", po.ID+".idx")); err != nil { t.Fatal(err) }
+}
+
+func TestPTYLogPruneKeepsCompressedSegmentsInStep(t *testing.T) {
+    base, stop := startServer(t, "-log-segment-bytes", "65536", "-log-max-segments", "2", "-log-gzip")
+    defer stop()
+
+    oreq := ptyOpenReq{Argv: []string{"/bin/sh", "-c", "seq 1 200000; sleep 5"}, Rows: 24, Cols: 80}
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    since := uint64(0)
+    tail := ""
+    deadline := time.Now().Add(15 * time.Second)
+    for time.Now().Before(deadline) && !strings.Contains(tail, "200000") {
+        rb, err := httpPost(base+"/v1/pty/read", mustJSON(ptyReadReq{ID: po.ID, Since: since, Max: 1 << 20, TimeoutMS: 300}))
+        if err != nil { t.Fatal(err) }
+        var rr ptyReadResp
+        if err := json.Unmarshal(rb, &rr); err != nil { t.Fatal(err) }
+        for _, c := range rr.Chunks {
+            b, _ := base64.StdEncoding.DecodeString(c.Data)
+            tail = string(b)
+            since = c.Seq
+        }
+    }
+    if !strings.Contains(tail, "200000") { t.Fatalf("never saw end of output, tail=%q", tail) }
+
+    // pruning waits for compression, so no segment outlives its index
+    time.Sleep(300 * time.Millisecond)
+    logs, _ := filepath.Glob(filepath.Join("/tmp/aiterm/sessions", po.ID+".log.*"))
+    idx, _ := filepath.Glob(filepath.Join("/tmp/aiterm/sessions", po.ID+".idx.*"))
+    if len(idx) != 2 || len(logs) != 2 { t.Fatalf("expected 2 rotated segments, logs=%v idx=%v", logs, idx) }
+    for _, p := range logs {
+        if _, err := os.Stat(strings.Replace(strings.TrimSuffix(p, ".gz"), ".log.", ".idx.", 1)); err != nil { t.Fatalf("orphaned segment %s", p) }
+    }
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
+    "testing"
+    "time"
+)
+
+type serviceStatus struct {
+    ID       string `json:"id"`
+    State    string `json:"state"`
+    Ready    bool   `json:"ready"`
+    PID      int    `json:"pid"`
+    Restarts int    `json:"restarts"`
+    LastRC   *int   `json:"last_rc"`
+    Error    string `json:"error"`
+}
+
+func serviceCall(t *testing.T, base, path string, req interface{}) serviceStatus {
+    t.Helper()
+    b, err := httpPost(base+"/v1/services/"+path, mustJSON(req))
+    if err != nil { t.Fatal(err) }
+    var out serviceStatus
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatalf("decode %s: %v", b, err) }
+    return out
+}
+
+func waitService(t *testing.T, base, id string, cond func(serviceStatus) bool) serviceStatus {
+    t.Helper()
+    deadline := time.Now().Add(10 * time.Second)
+    for {
+        st := serviceCall(t, base, "status", map[string]string{"id": id})
+        if cond(st) { return st }
+        if time.Now().After(deadline) { t.Fatalf("service %s: condition not met: %+v", id, st) }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
+func TestServiceRestartOnFailure(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    sv := serviceCall(t, base, "start", map[string]interface{}{
+        "run":     map[string]interface{}{"argv": []string{"/bin/sh", "-c", "echo run; exit 3"}},
+        "restart": "on-failure", "max_restarts": 2, "backoff_ms": 100,
+    })
+    if sv.ID == "" || sv.Error != "" { t.Fatalf("start: %+v", sv) }
+    st := waitService(t, base, sv.ID, func(st serviceStatus) bool { return st.State == "failed" })
+    if st.Restarts != 2 || st.LastRC == nil || *st.LastRC != 3 || st.PID != 0 { t.Fatalf("status: %+v", st) }
+
+    b, err := httpPost(base+"/v1/services/logs", mustJSON(map[string]interface{}{"id": sv.ID}))
+    if err != nil { t.Fatal(err) }
+    var logs struct {
+        Chunks []struct {
+            Seq    uint64 `json:"seq"`
+            Stream string `json:"stream"`
+            Data   string `json:"data"`
+        } `json:"chunks"`
+        Done bool `json:"done"`
+    }
+    if err := json.Unmarshal(b, &logs); err != nil { t.Fatal(err) }
+    var text strings.Builder
+    for _, c := range logs.Chunks {
+        d, _ := base64.StdEncoding.DecodeString(c.Data)
+        text.Write(d)
+    }
+    if !logs.Done || text.String() != "run\nrun\nrun\n" || logs.Chunks[0].Stream != "stdout" { t.Fatalf("logs: %s", b) }
+
+    // a clean exit is not restarted under on-failure
+    ok := serviceCall(t, base, "start", map[string]interface{}{
+        "run": map[string]interface{}{"argv": []string{"/bin/true"}}, "restart": "on-failure",
+    })
+    if st := waitService(t, base, ok.ID, func(st serviceStatus) bool { return st.State == "exited" }); st.Restarts != 0 { t.Fatalf("restarted: %+v", st) }
+
+    if bad := serviceCall(t, base, "start", map[string]interface{}{"run": map[string]interface{}{"argv": []string{"/bin/true"}}, "restart": "sometimes"}); bad.Error == "" { t.Fatalf("accepted bad policy: %+v", bad) }
+}
+
+func TestServiceReadiness(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+    aitermd, _, _ := buildBinaries(t)
+
+    // a second daemon is a handy TCP server
+    port := pickPort(t)
+    sv := serviceCall(t, base, "start", map[string]interface{}{
+        "run":           map[string]interface{}{"argv": []string{aitermd, "-addr", "127.0.0.1:" + port}},
+        "restart":       "always",
+        "ready":         map[string]interface{}{"tcp": "127.0.0.1:" + port, "interval_ms": 50},
+        "wait_ready_ms": 5000,
+    })
+    if !sv.Ready || sv.State != "running" || sv.PID == 0 { t.Fatalf("tcp readiness: %+v", sv) }
+    re := serviceCall(t, base, "restart", map[string]string{"id": sv.ID})
+    if re.Error != "" { t.Fatalf("restart: %+v", re) }
+    waitService(t, base, sv.ID, func(st serviceStatus) bool { return st.Ready && st.PID != sv.PID && st.Restarts == 1 })
+    if st := serviceCall(t, base, "stop", map[string]interface{}{"id": sv.ID}); st.State != "stopped" || st.PID != 0 { t.Fatalf("stop: %+v", st) }
+
+    logSv := serviceCall(t, base, "start", map[string]interface{}{
+        "run":           map[string]interface{}{"argv": []string{"/bin/sh", "-c", "sleep 0.3; echo listening on 1234; exec sleep 30"}},
+        "ready":         map[string]interface{}{"log_regex": `listening on \d+`},
+        "wait_ready_ms": 5000,
+    })
+    if !logSv.Ready { t.Fatalf("log readiness: %+v", logSv) }
+    serviceCall(t, base, "stop", map[string]interface{}{"id": logSv.ID, "remove": true})
+    if gone := serviceCall(t, base, "status", map[string]string{"id": logSv.ID}); gone.Error == "" { t.Fatal("service survived remove") }
+
+    // a probe that never passes kills the instance and counts as a failure
+    slow := serviceCall(t, base, "start", map[string]interface{}{
+        "run":           map[string]interface{}{"argv": []string{"/bin/sleep", "30"}},
+        "ready":         map[string]interface{}{"command": []string{"/bin/false"}, "timeout_ms": 300},
+        "wait_ready_ms": 5000,
+    })
+    if slow.Ready || slow.State != "failed" || !strings.Contains(slow.Error, "timed out") { t.Fatalf("probe timeout: %+v", slow) }
+
+    b, err := httpPost(base+"/v1/services/list", nil)
+    if err != nil { t.Fatal(err) }
+    var list struct{ Services []serviceStatus `json:"services"` }
+    if err := json.Unmarshal(b, &list); err != nil || len(list.Services) != 2 { t.Fatalf("list: %s", b) }
+}
+
+func TestServiceRestartRaces(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    // cutting a backoff short does not use up an automatic restart
+    sv := serviceCall(t, base, "start", map[string]interface{}{
+        "run":     map[string]interface{}{"argv": []string{"/bin/sh", "-c", "exit 3"}},
+        "restart": "on-failure", "max_restarts": 1, "backoff_ms": 3000,
+    })
+    waitService(t, base, sv.ID, func(st serviceStatus) bool { return st.State == "backoff" })
+    serviceCall(t, base, "restart", map[string]string{"id": sv.ID})
+    st := waitService(t, base, sv.ID, func(st serviceStatus) bool {
+        return st.Restarts == 1 && (st.State == "backoff" || st.State == "failed")
+    })
+    if st.State != "backoff" { t.Fatalf("restart during backoff counted: %+v", st) }
+    serviceCall(t, base, "stop", map[string]interface{}{"id": sv.ID})
+
+    // concurrent restarts of a finished service start one supervisor
+    dir := t.TempDir()
+    sv = serviceCall(t, base, "start", map[string]interface{}{
+        "run":     map[string]interface{}{"argv": []string{"/bin/sh", "-c", "[ -e started ] || { touch started; exit 0; }; echo $$ >> pids; exec sleep 30"}, "cwd": dir},
+        "restart": "never",
+    })
+    waitService(t, base, sv.ID, func(st serviceStatus) bool { return st.State == "exited" })
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, _ = httpPost(base+"/v1/services/restart", mustJSON(map[string]string{"id": sv.ID}))
+        }()
+    }
+    wg.Wait()
+    waitService(t, base, sv.ID, func(st serviceStatus) bool { return st.State == "running" && st.PID != 0 })
+    time.Sleep(300 * time.Millisecond)
+    serviceCall(t, base, "stop", map[string]interface{}{"id": sv.ID})
+    b, err := os.ReadFile(filepath.Join(dir, "pids"))
+    if err != nil { t.Fatal(err) }
+    for _, f := range strings.Fields(string(b)) {
+        pid, _ := strconv.Atoi(f)
+        if syscall.Kill(pid, 0) == nil { t.Fatalf("instance %d outlived stop: pids %q", pid, b) }
+    }
+}
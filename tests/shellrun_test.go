@@ -0,0 +1,163 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "strings"
+    "testing"
+    "time"
+)
+
+// shellRun posts an arbitrary shell.run request and decodes the response into out.
+func shellRun(t *testing.T, base string, req interface{}, out interface{}) {
+    t.Helper()
+    b, err := httpPost(base+"/v1/shell/run", mustJSON(req))
+    if err != nil { t.Fatal(err) }
+    if err := json.Unmarshal(b, out); err != nil { t.Fatalf("decode %s: %v", b, err) }
+}
+
+func TestShellRunInPTYContext(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    dir := t.TempDir()
+    oreq := ptyOpenReq{Argv: []string{"/bin/bash", "--noprofile", "--norc", "-i"}, Rows: 24, Cols: 80, Env: map[string]string{"TERM": "dumb", "PS1": "", "CTX_TOKEN": "from_pty"}}
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+    _, _ = httpPost(base+"/v1/pty/send", mustJSON(ptySendReq{ID: po.ID, Data: b64("cd " + dir + "\n")}))
+
+    var out struct {
+        RC      int    `json:"rc"`
+        Stdout  string `json:"stdout"`
+        Context *struct {
+            PID int    `json:"pid"`
+            Cwd string `json:"cwd"`
+        } `json:"context"`
+    }
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "pwd; echo $CTX_TOKEN"}, "pty_id": po.ID}, &out)
+        if out.Context != nil && out.Context.Cwd == dir { break }
+        time.Sleep(100 * time.Millisecond)
+    }
+    if out.Context == nil || out.Context.PID == 0 || out.Context.Cwd != dir { t.Fatalf("unexpected context: %+v", out.Context) }
+    got, _ := base64.StdEncoding.DecodeString(out.Stdout)
+    if strings.TrimSpace(string(got)) != dir+"\nfrom_pty" { t.Fatalf("stdout=%q", got) }
+
+    // an explicit env_policy mode is kept instead of inheriting the session's env
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "echo \"[$CTX_TOKEN]\""}, "pty_id": po.ID, "env_policy": map[string]string{"mode": "empty"}}, &out)
+    got, _ = base64.StdEncoding.DecodeString(out.Stdout)
+    if strings.TrimSpace(string(got)) != "[]" { t.Fatalf("empty mode stdout=%q", got) }
+}
+
+func TestShellRunOutputCaps(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    type capResp struct {
+        RC              int    `json:"rc"`
+        Stdout          string `json:"stdout"`
+        StdoutBytes     int64  `json:"stdout_bytes"`
+        StderrBytes     int64  `json:"stderr_bytes"`
+        StdoutTruncated bool   `json:"stdout_truncated"`
+        StderrTruncated bool   `json:"stderr_truncated"`
+        LimitExceeded   bool   `json:"limit_exceeded"`
+        Error           string `json:"error"`
+    }
+
+    // head only
+    var head capResp
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "seq 1 1000"}, "max_stdout_bytes": 10}, &head)
+    got, _ := base64.StdEncoding.DecodeString(head.Stdout)
+    if string(got) != "1\n2\n3\n4\n5\n" || !head.StdoutTruncated || head.StderrTruncated || head.StdoutBytes != 3893 {
+        t.Fatalf("head: %+v stdout=%q", head, got)
+    }
+
+    // head and tail
+    var both capResp
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "seq 1 1000"}, "max_stdout_bytes": 20, "keep_tail": true}, &both)
+    got, _ = base64.StdEncoding.DecodeString(both.Stdout)
+    if !strings.HasPrefix(string(got), "1\n2\n3\n4\n5\n") || !strings.HasSuffix(string(got), "\n999\n1000\n") || len(got) != 20 || !both.StdoutTruncated {
+        t.Fatalf("keep_tail: %+v stdout=%q", both, got)
+    }
+
+    // untruncated
+    var small capResp
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/echo", "hi"}, "max_stdout_bytes": 10}, &small)
+    if small.StdoutTruncated || small.StdoutBytes != 3 { t.Fatalf("small: %+v", small) }
+
+    // hard limit kills a runaway writer
+    var killed capResp
+    start := time.Now()
+    shellRun(t, base, map[string]interface{}{"argv": []string{"yes"}, "max_stdout_bytes": 64, "kill_after_bytes": 1 << 20, "timeout_ms": 10000}, &killed)
+    if time.Since(start) > 5*time.Second { t.Fatalf("kill_after_bytes did not stop the command in time") }
+    if !killed.LimitExceeded || killed.RC == 0 || !killed.StdoutTruncated || killed.StdoutBytes <= 1<<20 || killed.Error == "" {
+        t.Fatalf("killed: %+v", killed)
+    }
+}
+
+func TestShellRunPipeline(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    type stage struct {
+        Argv   []string `json:"argv"`
+        RC     int      `json:"rc"`
+        Stderr string   `json:"stderr"`
+        Usage  *struct {
+            MaxRSSKB int64 `json:"max_rss_kb"`
+        } `json:"usage"`
+    }
+    type pipeResp struct {
+        RC     int     `json:"rc"`
+        Stdout string  `json:"stdout"`
+        Stderr string  `json:"stderr"`
+        Stages []stage `json:"stages"`
+        Error  string  `json:"error"`
+    }
+
+    var out pipeResp
+    shellRun(t, base, map[string]interface{}{
+        "pipeline": []map[string]interface{}{
+            {"argv": []string{"/bin/cat"}},
+            {"argv": []string{"/usr/bin/sort"}, "env": map[string]string{"LC_ALL": "C"}},
+            {"argv": []string{"/usr/bin/head", "-n", "2"}},
+        },
+        "stdin": b64("pear\napple\nfig\n"),
+    }, &out)
+    got, _ := base64.StdEncoding.DecodeString(out.Stdout)
+    if out.RC != 0 || string(got) != "apple\nfig\n" || len(out.Stages) != 3 || out.Error != "" { t.Fatalf("sort pipeline: %+v stdout=%q", out, got) }
+    for i, st := range out.Stages {
+        if st.RC != 0 || st.Usage == nil || st.Usage.MaxRSSKB <= 0 { t.Fatalf("stage %d: %+v", i, st) }
+    }
+
+    // pipefail: the rightmost failing stage decides rc; stderr stays per stage
+    out = pipeResp{}
+    shellRun(t, base, map[string]interface{}{
+        "pipeline": []map[string]interface{}{
+            {"argv": []string{"/bin/sh", "-c", "echo data; echo first >&2; exit 3"}},
+            {"argv": []string{"/bin/sh", "-c", "cat; echo second >&2; exit 5"}},
+            {"argv": []string{"/bin/cat"}},
+        },
+    }, &out)
+    got, _ = base64.StdEncoding.DecodeString(out.Stdout)
+    e0, _ := base64.StdEncoding.DecodeString(out.Stages[0].Stderr)
+    e1, _ := base64.StdEncoding.DecodeString(out.Stages[1].Stderr)
+    if out.RC != 5 || string(got) != "data\n" || out.Stages[0].RC != 3 || out.Stages[1].RC != 5 || out.Stages[2].RC != 0 {
+        t.Fatalf("pipefail: %+v", out)
+    }
+    if string(e0) != "first\n" || string(e1) != "second\n" { t.Fatalf("stage stderr: %q %q", e0, e1) }
+
+    // a stage that cannot start fails the whole pipeline
+    out = pipeResp{}
+    shellRun(t, base, map[string]interface{}{
+        "pipeline": []map[string]interface{}{
+            {"argv": []string{"/bin/echo", "x"}},
+            {"argv": []string{"/nonexistent/tool"}},
+        },
+    }, &out)
+    if out.RC != 127 || !strings.Contains(out.Error, "stage 1") { t.Fatalf("missing binary: %+v", out) }
+}
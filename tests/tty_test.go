@@ -0,0 +1,62 @@
+package tests
+
+import (
+    "encoding/base64"
+    "strings"
+    "testing"
+)
+
+type ttyResp struct {
+    RC       int    `json:"rc"`
+    Stdout   string `json:"stdout"`
+    Stderr   string `json:"stderr"`
+    Screen   string `json:"screen"`
+    TimedOut bool   `json:"timed_out"`
+    Error    string `json:"error"`
+}
+
+func TestShellRunTTY(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    var out ttyResp
+    shellRun(t, base, map[string]interface{}{
+        "argv": []string{"/bin/sh", "-c", "[ -t 0 ] && [ -t 1 ] && echo is-a-tty; stty size; echo to-stderr >&2; exit 5"},
+        "tty":  true, "rows": 30, "cols": 100,
+    }, &out)
+    stdout, _ := base64.StdEncoding.DecodeString(out.Stdout)
+    if out.RC != 5 || string(stdout) != "is-a-tty\r\n30 100\r\nto-stderr\r\n" || out.Stderr != "" { t.Fatalf("tty: %+v (%q)", out, stdout) }
+
+    // the screen shows the result of redraws, not the raw stream
+    out = ttyResp{}
+    shellRun(t, base, map[string]interface{}{
+        "argv":   []string{"/bin/sh", "-c", `printf 'progress 10%%\rprogress 100%%\nline2\033[1A\033[2K\r\033[32mfinal\033[0m\n'`},
+        "tty":    true,
+        "screen": true,
+    }, &out)
+    if out.RC != 0 || out.Screen != "final\nline2" { t.Fatalf("screen: %+v", out) }
+
+    // stdin is typed in and ended with Ctrl-D; the terminal echoes it
+    out = ttyResp{}
+    shellRun(t, base, map[string]interface{}{
+        "argv": []string{"/bin/cat"}, "tty": true, "screen": true, "stdin": b64("hello\n"), "timeout_ms": 5000,
+    }, &out)
+    if out.RC != 0 || out.TimedOut || out.Screen != "hello\nhello" { t.Fatalf("stdin: %+v", out) }
+
+    out = ttyResp{}
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/sleep", "5"}, "tty": true, "timeout_ms": 300}, &out)
+    if !out.TimedOut || !strings.Contains(out.Error, "timeout") { t.Fatalf("timeout: %+v", out) }
+
+    out = ttyResp{}
+    shellRun(t, base, map[string]interface{}{"tty": true, "pipeline": []map[string]interface{}{{"argv": []string{"/bin/true"}}}}, &out)
+    if !strings.Contains(out.Error, "tty") { t.Fatalf("pipeline: %+v", out) }
+
+    // sizes are bounded; a rendered screen is bounded well below the tty limit
+    for _, size := range []map[string]interface{}{{"rows": 70000}, {"cols": -1}, {"rows": 5000, "screen": true}} {
+        req := map[string]interface{}{"argv": []string{"/bin/true"}, "tty": true}
+        for k, v := range size { req[k] = v }
+        out = ttyResp{}
+        shellRun(t, base, req, &out)
+        if !strings.Contains(out.Error, "at most") && !strings.Contains(out.Error, "between") { t.Fatalf("size %v: %+v", size, out) }
+    }
+}
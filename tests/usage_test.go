@@ -0,0 +1,72 @@
+package tests
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+)
+
+type usageJSON struct {
+    CPUMS       int64 `json:"cpu_ms"`
+    MaxRSSKB    int64 `json:"max_rss_kb"`
+    MinorFaults int64 `json:"minor_faults"`
+    Procs       int   `json:"procs"`
+}
+
+func TestShellRunUsage(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    var out struct {
+        RC    int        `json:"rc"`
+        Usage *usageJSON `json:"usage"`
+    }
+    // burn CPU in a child so the reaped-descendant accounting is exercised
+    shellRun(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "i=0; while [ $i -lt 200000 ]; do i=$((i+1)); done & wait"}}, &out)
+    if out.RC != 0 || out.Usage == nil { t.Fatalf("unexpected result: %+v", out) }
+    if out.Usage.CPUMS <= 0 || out.Usage.MaxRSSKB <= 0 || out.Usage.MinorFaults <= 0 { t.Fatalf("usage not collected: %+v", *out.Usage) }
+}
+
+func TestPTYUsageLiveAndFinal(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    oreq := ptyOpenReq{Argv: []string{"/bin/bash", "--noprofile", "--norc", "-i"}, Rows: 24, Cols: 80, Env: map[string]string{"TERM": "dumb", "PS1": ""}}
+    ob, err := httpPost(base+"/v1/pty/open", mustJSON(oreq))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(ob, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+
+    type usageResp struct {
+        Usage usageJSON `json:"usage"`
+        Live  bool      `json:"live"`
+        Error string    `json:"error"`
+    }
+    usage := func() usageResp {
+        b, err := httpPost(base+"/v1/pty/usage", mustJSON(map[string]string{"id": po.ID}))
+        if err != nil { t.Fatal(err) }
+        var ur usageResp
+        if err := json.Unmarshal(b, &ur); err != nil { t.Fatalf("decode %s: %v", b, err) }
+        return ur
+    }
+
+    _, _ = httpPost(base+"/v1/pty/send", mustJSON(ptySendReq{ID: po.ID, Data: b64("sleep 30 &\n")}))
+    var ur usageResp
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        ur = usage()
+        if ur.Live && ur.Usage.Procs >= 2 { break }
+        time.Sleep(100 * time.Millisecond)
+    }
+    if !ur.Live || ur.Usage.Procs < 2 || ur.Usage.MaxRSSKB <= 0 { t.Fatalf("live usage should cover the process tree: %+v", ur) }
+
+    _, _ = httpPost(base+"/v1/pty/send", mustJSON(ptySendReq{ID: po.ID, Data: b64("kill %1; exit\n")}))
+    deadline = time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        ur = usage()
+        if !ur.Live { break }
+        time.Sleep(100 * time.Millisecond)
+    }
+    if ur.Live || ur.Error != "" || ur.Usage.MaxRSSKB <= 0 || ur.Usage.Procs != 0 { t.Fatalf("expected final usage: %+v", ur) }
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "os/exec"
+    "path/filepath"
+    "testing"
+)
+
+type waitResp struct {
+    Fired     bool   `json:"fired"`
+    TimedOut  bool   `json:"timed_out"`
+    Index     int    `json:"index"`
+    Kind      string `json:"kind"`
+    Match     string `json:"match"`
+    RC        *int   `json:"rc"`
+    ElapsedMS int64  `json:"elapsed_ms"`
+    Error     string `json:"error"`
+}
+
+func waitCall(t *testing.T, base string, req interface{}) waitResp {
+    t.Helper()
+    b, err := httpPost(base+"/v1/wait", mustJSON(req))
+    if err != nil { t.Fatal(err) }
+    var out waitResp
+    if err := json.Unmarshal(b, &out); err != nil { t.Fatalf("decode %s: %v", b, err) }
+    return out
+}
+
+func TestWaitConditions(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+    aitermd, _, _ := buildBinaries(t)
+
+    // tcp: a second daemon starts listening; the first condition never fires
+    port := pickPort(t)
+    daemon := startJob(t, base, map[string]interface{}{"argv": []string{aitermd, "-addr", "127.0.0.1:" + port}})
+    defer httpPost(base+"/v1/jobs/cancel", mustJSON(map[string]string{"id": daemon}))
+    w := waitCall(t, base, map[string]interface{}{"timeout_ms": 5000, "conditions": []map[string]interface{}{
+        {"file": "/nonexistent/never"}, {"tcp": "127.0.0.1:" + port},
+    }})
+    if !w.Fired || w.Index != 1 || w.Kind != "tcp" { t.Fatalf("tcp: %+v", w) }
+
+    // file content appears after a delay
+    dir := t.TempDir()
+    startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "sleep 0.3; echo ready on 8080 > " + filepath.Join(dir, "state")}})
+    w = waitCall(t, base, map[string]interface{}{"cwd": dir, "conditions": []map[string]interface{}{{"file": "state", "file_regex": `ready on \d+`}}})
+    if !w.Fired || w.Match != "ready on 8080" || w.ElapsedMS < 200 { t.Fatalf("file: %+v", w) }
+
+    // job and pid exits
+    job := startJob(t, base, map[string]interface{}{"argv": []string{"/bin/sh", "-c", "sleep 0.2; exit 4"}})
+    w = waitCall(t, base, map[string]interface{}{"conditions": []map[string]interface{}{{"job_id": job}}})
+    if w.Kind != "job" || w.RC == nil || *w.RC != 4 { t.Fatalf("job: %+v", w) }
+    sleeper := exec.Command("/bin/sleep", "0.2")
+    if err := sleeper.Start(); err != nil { t.Fatal(err) }
+    defer sleeper.Wait()
+    w = waitCall(t, base, map[string]interface{}{"conditions": []map[string]interface{}{{"pid": sleeper.Process.Pid}}})
+    if !w.Fired || w.Kind != "pid" { t.Fatalf("pid: %+v", w) }
+
+    // timeout
+    w = waitCall(t, base, map[string]interface{}{"timeout_ms": 300, "conditions": []map[string]interface{}{{"tcp": "127.0.0.1:" + pickPort(t)}}})
+    if w.Fired || !w.TimedOut || w.Index != -1 || w.ElapsedMS < 300 { t.Fatalf("timeout: %+v", w) }
+
+    for _, bad := range []map[string]interface{}{
+        {"tcp": "127.0.0.1:1", "file": "x"},
+        {"pty_id": "nope", "pty_regex": "x"},
+        {"file": "x", "file_regex": "("},
+    } {
+        if w := waitCall(t, base, map[string]interface{}{"conditions": []map[string]interface{}{bad}}); w.Error == "" { t.Fatalf("accepted %v: %+v", bad, w) }
+    }
+}
+
+func TestWaitPTYOutput(t *testing.T) {
+    base, stop := startServer(t)
+    defer stop()
+
+    b, err := httpPost(base+"/v1/pty/open", mustJSON(ptyOpenReq{Argv: []string{"/bin/bash", "--noprofile", "--norc"}, Rows: 24, Cols: 80, Env: map[string]string{"TERM": "dumb", "PS1": ""}}))
+    if err != nil { t.Fatal(err) }
+    var po ptyOpenResp
+    if err := json.Unmarshal(b, &po); err != nil { t.Fatal(err) }
+    defer httpPost(base+"/v1/pty/close", mustJSON(map[string]string{"id": po.ID}))
+    send := base64.StdEncoding.EncodeToString([]byte("sleep 0.3; echo server-up-$((6*7))\n"))
+    if _, err := httpPost(base+"/v1/pty/send", mustJSON(ptySendReq{ID: po.ID, Data: send})); err != nil { t.Fatal(err) }
+    w := waitCall(t, base, map[string]interface{}{"conditions": []map[string]interface{}{{"pty_id": po.ID, "pty_regex": `server-up-\d+`}}})
+    if !w.Fired || w.Kind != "pty" || w.Match != "server-up-42" || w.ElapsedMS < 200 { t.Fatalf("pty: %+v", w) }
+}